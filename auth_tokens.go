@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/yarpc/yab/credprovider"
+	"github.com/yarpc/yab/transport"
+)
+
+const _defaultCredentialsHeader = "Authorization"
+
+// authTokens adds auth tokens from a credential provider to requests.
+type authTokens struct {
+	source *credprovider.Source
+	header string
+}
+
+// newAuthTokens returns the auth tokens for the credentials option, or nil if
+// it's not set. Credential providers make HTTP requests using client.
+func newAuthTokens(opts RequestOptions, client *http.Client) (*authTokens, error) {
+	if opts.Credentials == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(opts.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := credprovider.NewSource(u, client)
+	if err != nil {
+		return nil, err
+	}
+
+	header := opts.CredentialsHeader
+	if header == "" {
+		header = _defaultCredentialsHeader
+	}
+	return &authTokens{source: source, header: header}, nil
+}
+
+// Apply adds the current token to the request, and is registered as a
+// request interceptor so it's applied to each call. The token is sent as an
+// HTTP header for HTTP, and as an application header otherwise, which gRPC
+// sends as metadata. Tokens are refreshed in the background while the cached
+// token is valid, so refreshing them doesn't affect latencies.
+func (a *authTokens) Apply(ctx context.Context, req *transport.Request) (*transport.Request, error) {
+	// Waiting for a token is limited by the request's context, so cancelled
+	// and timed out calls don't wait for the fetch to finish.
+	ctx, cancel := context.WithTimeout(ctx, credprovider.FetchTimeout)
+	defer cancel()
+
+	token, err := a.source.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed while fetching credentials: %v", err)
+	}
+
+	if transport.ProtocolFromContext(ctx) == transport.HTTP {
+		req.TransportHeaders = withHeader(req.TransportHeaders, a.header, token.Value)
+	} else {
+		req.Headers = withHeader(req.Headers, a.header, token.Value)
+	}
+	return req, nil
+}
+
+// withHeader returns a copy of the headers with the given header set.
+func withHeader(headers map[string]string, k, v string) map[string]string {
+	copied := make(map[string]string, len(headers)+1)
+	for hk, hv := range headers {
+		copied[hk] = hv
+	}
+	copied[k] = v
+	return copied
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuthTokensErrors(t *testing.T) {
+	tests := []struct {
+		msg         string
+		credentials string
+		wantErr     string
+	}{
+		{
+			msg:         "invalid URL",
+			credentials: "oauth2+https://auth/%zz",
+			wantErr:     "invalid URL escape",
+		},
+		{
+			msg:         "unknown scheme",
+			credentials: "ldap://token",
+			wantErr:     `no credential provider available for scheme "ldap"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := newAuthTokens(RequestOptions{Credentials: tt.credentials}, nil /* client */)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestAuthTokensNotConfigured(t *testing.T) {
+	auth, err := newAuthTokens(RequestOptions{}, nil /* client */)
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestAuthTokensApply(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("Bearer abc\n"), 0600))
+
+	tests := []struct {
+		msg                  string
+		protocol             transport.Protocol
+		header               string
+		wantHeaders          map[string]string
+		wantTransportHeaders map[string]string
+	}{
+		{
+			msg:                  "TChannel",
+			protocol:             transport.TChannel,
+			wantHeaders:          map[string]string{"foo": "bar", "Authorization": "Bearer abc"},
+			wantTransportHeaders: map[string]string{"baz": "qux"},
+		},
+		{
+			msg:                  "gRPC",
+			protocol:             transport.GRPC,
+			wantHeaders:          map[string]string{"foo": "bar", "Authorization": "Bearer abc"},
+			wantTransportHeaders: map[string]string{"baz": "qux"},
+		},
+		{
+			msg:                  "HTTP",
+			protocol:             transport.HTTP,
+			wantHeaders:          map[string]string{"foo": "bar"},
+			wantTransportHeaders: map[string]string{"baz": "qux", "Authorization": "Bearer abc"},
+		},
+		{
+			msg:                  "custom header",
+			protocol:             transport.HTTP,
+			header:               "X-Auth",
+			wantHeaders:          map[string]string{"foo": "bar"},
+			wantTransportHeaders: map[string]string{"baz": "qux", "X-Auth": "Bearer abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			auth, err := newAuthTokens(RequestOptions{
+				Credentials:       tokenFile,
+				CredentialsHeader: tt.header,
+			}, nil /* client */)
+			require.NoError(t, err)
+			defer transport.RegisterInterceptor(auth)()
+
+			req := &transport.Request{
+				Method:           "foo",
+				Headers:          map[string]string{"foo": "bar"},
+				TransportHeaders: map[string]string{"baz": "qux"},
+			}
+			ct := &captureTransport{protocol: tt.protocol}
+			_, err = transport.Call(context.Background(), ct, req)
+			require.NoError(t, err)
+			require.Len(t, ct.requests, 1)
+			got := ct.requests[0]
+			assert.Equal(t, "foo", got.Method)
+			assert.Equal(t, tt.wantHeaders, got.Headers, "unexpected headers")
+			assert.Equal(t, tt.wantTransportHeaders, got.TransportHeaders, "unexpected transport headers")
+
+			assert.Equal(t, map[string]string{"foo": "bar"}, req.Headers, "request should not be modified")
+			assert.Equal(t, map[string]string{"baz": "qux"}, req.TransportHeaders, "request should not be modified")
+
+			gotStream, err := transport.InterceptStreamRequest(context.Background(), ct, &transport.StreamRequest{Request: req})
+			require.NoError(t, err)
+			assert.Equal(t, got, gotStream.Request, "stream request should match request")
+		})
+	}
+}
+
+func TestAuthTokensApplyError(t *testing.T) {
+	auth, err := newAuthTokens(RequestOptions{Credentials: filepath.Join(t.TempDir(), "missing")}, nil /* client */)
+	require.NoError(t, err)
+	defer transport.RegisterInterceptor(auth)()
+
+	ct := &captureTransport{protocol: transport.HTTP}
+	_, err = transport.Call(context.Background(), ct, &transport.Request{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed while fetching credentials")
+	}
+	assert.Empty(t, ct.requests, "request should not be made without credentials")
+
+	_, err = transport.InterceptStreamRequest(context.Background(), ct, &transport.StreamRequest{Request: &transport.Request{}})
+	assert.Error(t, err)
+}
@@ -21,11 +21,13 @@
 package main
 
 import (
-	"math/rand"
+	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/peerselect"
 	"github.com/yarpc/yab/transport"
 
 	"github.com/opentracing/opentracing-go"
@@ -38,19 +40,45 @@ type peerTransport struct {
 
 // benchmarkCaller exposes method to dispatch requests for benchmark.
 type benchmarkCaller interface {
-	// Call dispatches a request using the provided transport.
-	Call(transport.Transport) (benchmarkCallReporter, error)
+	// Call dispatches a request using the provided transport. The request
+	// is cancelled if ctx is cancelled.
+	Call(context.Context, transport.Transport) (benchmarkCallReporter, error)
 
 	// CallMethodType returns the type of the RPC method invoked by `Call`.
 	CallMethodType() encoding.MethodType
 }
 
+// protocolCallers is a benchmarkCaller for peers that use mixed protocols.
+// It calls each transport using the caller for the transport's protocol.
+type protocolCallers map[transport.Protocol]benchmarkCaller
+
+func (c protocolCallers) Call(ctx context.Context, t transport.Transport) (benchmarkCallReporter, error) {
+	b, ok := c[t.Protocol()]
+	if !ok {
+		return nil, fmt.Errorf("no request for %v peers", t.Protocol())
+	}
+	return b.Call(ctx, t)
+}
+
+// CallMethodType returns Unary, as only unary methods can be called using
+// peers with mixed protocols.
+func (c protocolCallers) CallMethodType() encoding.MethodType {
+	return encoding.Unary
+}
+
 // benchmarkCallReporter exposes method to access benchmark call report like latency.
 type benchmarkCallReporter interface {
 	// Latency returns the time taken to send request and receive response.
 	Latency() time.Duration
 }
 
+// benchmarkTracedCallReporter exposes the trace ID of a benchmark call that
+// was sampled for tracing.
+type benchmarkTracedCallReporter interface {
+	// TraceID returns the trace ID, or an empty string if the call wasn't sampled.
+	TraceID() string
+}
+
 // benchmarkStreamCallReporter exposes method to access benchmark stream call report
 // like stream messages send and received.
 type benchmarkStreamCallReporter interface {
@@ -63,26 +91,31 @@ type benchmarkStreamCallReporter interface {
 
 type benchmarkCallLatencyReport struct {
 	latency time.Duration
+	traceID string
 }
 
 func newBenchmarkCallLatencyReport(latency time.Duration) benchmarkCallLatencyReport {
-	return benchmarkCallLatencyReport{latency}
+	return benchmarkCallLatencyReport{latency: latency}
 }
 
 func (r benchmarkCallLatencyReport) Latency() time.Duration {
 	return r.latency
 }
 
+func (r benchmarkCallLatencyReport) TraceID() string {
+	return r.traceID
+}
+
 // warmTransport warms up a transport and returns it. The transport is warmed
 // up by making some number of requests through it.
-func warmTransport(b benchmarkCaller, opts TransportOptions, resolved resolvedProtocolEncoding, warmupRequests int) (transport.Transport, error) {
-	transport, err := getTransport(opts, resolved, opentracing.NoopTracer{})
+func warmTransport(b benchmarkCaller, opts TransportOptions, resolved resolvedProtocolEncoding, tracer opentracing.Tracer, warmupRequests int) (transport.Transport, error) {
+	transport, err := getTransport(opts, resolved, tracer)
 	if err != nil {
 		return nil, err
 	}
 
 	for i := 0; i < warmupRequests; i++ {
-		_, err := b.Call(transport)
+		_, err := b.Call(context.Background(), transport)
 		if err != nil {
 			return nil, err
 		}
@@ -91,19 +124,111 @@ func warmTransport(b benchmarkCaller, opts TransportOptions, resolved resolvedPr
 	return transport, nil
 }
 
-func peerBalancer(peers []string) func(i int) (string, int) {
-	numPeers := len(peers)
-	startOffset := rand.Intn(numPeers)
-	return func(i int) (string, int) {
-		offset := (startOffset + i) % numPeers
-		return peers[offset], offset
+// connectTransport creates a transport and, if the transport supports it,
+// waits for its connection to be established.
+func connectTransport(opts TransportOptions, resolved resolvedProtocolEncoding, tracer opentracing.Tracer, timeout time.Duration) (transport.Transport, error) {
+	t, err := getTransport(opts, resolved, tracer)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, ok := t.(transport.Connector)
+	if !ok {
+		return t, nil
+	}
+
+	if timeout == 0 {
+		timeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := connector.Connect(ctx); err != nil {
+		closeTransport(t)
+		return nil, err
+	}
+	return t, nil
+}
+
+// closeTransport closes the transport if it's a TransportCloser.
+func closeTransport(t transport.Transport) {
+	if closer, ok := t.(transport.TransportCloser); ok {
+		closer.Close()
+	}
+}
+
+// warmHedgeTransports returns a warmed up transport for each connection,
+// connected to the peer that its requests are hedged to.
+func warmHedgeTransports(b benchmarkCaller, connections []peerTransport, tOpts TransportOptions, resolved resolvedProtocolEncoding, tracer opentracing.Tracer, warmupRequests int) ([]transport.Transport, error) {
+	transports := make([]transport.Transport, len(connections))
+	errs := make([]error, len(connections))
+
+	var wg sync.WaitGroup
+	for i, c := range connections {
+		wg.Add(1)
+		go func(i, peerID int, tOpts TransportOptions) {
+			defer wg.Done()
+
+			tOpts.Peers = []string{tOpts.Peers[hedgePeer(peerID, len(tOpts.Peers))]}
+			tOpts.PeerWeights = nil
+			transports[i], errs[i] = warmTransport(b, tOpts, resolved, tracer, warmupRequests)
+		}(i, c.peerID, tOpts)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return transports, nil
+}
+
+// benchmarkPeerStrategy returns the strategy used to assign benchmark
+// connections to peers. Connections are weighted by default if the peer
+// list has weights.
+func benchmarkPeerStrategy(tOpts TransportOptions) string {
+	if tOpts.PeerStrategy == "" {
+		if len(tOpts.PeerWeights) > 0 {
+			return peerselect.Weighted
+		}
+		return peerselect.RoundRobin
+	}
+	return tOpts.PeerStrategy
+}
+
+// connectionPeers returns the index of the peer used by each of n benchmark
+// connections. Connections are long-lived, so with the least-pending strategy,
+// each connection is assigned to the peer with the fewest connections, and
+// with the weighted strategy, connections are assigned in proportion to the
+// peer weights rather than at random.
+func connectionPeers(n int, tOpts TransportOptions) ([]int, error) {
+	strategy := benchmarkPeerStrategy(tOpts)
+	if strategy == peerselect.Weighted {
+		return peerselect.Spread(n, len(tOpts.Peers), tOpts.PeerWeights)
+	}
+
+	chooser, err := peerselect.New(strategy, tOpts.Peers, tOpts.PeerWeights)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]int, n)
+	for i := range peers {
+		peers[i], _ = chooser.Choose(tOpts.ShardKey)
 	}
+	return peers, nil
 }
 
 // warmTransports returns n transports that have been warmed up.
 // No requests may fail during the warmup period.
-func warmTransports(b benchmarkCaller, n int, tOpts TransportOptions, resolved resolvedProtocolEncoding, warmupRequests int) ([]peerTransport, error) {
-	peerFor := peerBalancer(tOpts.Peers)
+func warmTransports(b benchmarkCaller, n int, tOpts TransportOptions, resolved resolvedProtocolEncoding, tracer opentracing.Tracer, warmupRequests int) ([]peerTransport, error) {
+	peers, err := connectionPeers(n, tOpts)
+	if err != nil {
+		return nil, err
+	}
+
 	transports := make([]peerTransport, n)
 	errs := make([]error, n)
 
@@ -113,10 +238,11 @@ func warmTransports(b benchmarkCaller, n int, tOpts TransportOptions, resolved r
 		go func(i int, tOpts TransportOptions) {
 			defer wg.Done()
 
-			peerHostPort, peerIndex := peerFor(i)
-			tOpts.Peers = []string{peerHostPort}
+			peerIndex := peers[i]
+			tOpts.Peers = []string{tOpts.Peers[peerIndex]}
+			tOpts.PeerWeights = nil
 
-			tp, err := warmTransport(b, tOpts, resolved, warmupRequests)
+			tp, err := warmTransport(b, tOpts, resolved, tracer, warmupRequests)
 			transports[i] = peerTransport{tp, peerIndex}
 			errs[i] = err
 		}(i, tOpts)
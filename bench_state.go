@@ -28,6 +28,11 @@ import (
 	"github.com/yarpc/yab/statsd"
 )
 
+type sampledTrace struct {
+	traceID string
+	latency time.Duration
+}
+
 type benchmarkState struct {
 	statter       statsd.Client
 	errors        map[string]int
@@ -36,14 +41,33 @@ type benchmarkState struct {
 	totalRequests int
 	latencies     []time.Duration
 
+	connectLatencies []time.Duration
+	sampledTraces    []sampledTrace
+
+	// Failed connections are counted separately from failed requests.
+	connectErrors      map[string]int
+	totalConnectErrors int
+
 	totalStreamMessagesSent     int
 	totalStreamMessagesReceived int
+
+	// countsWireBytes is set if the transport counts the bytes on the wire.
+	countsWireBytes    bool
+	totalBytesSent     int64
+	totalBytesReceived int64
+
+	// Hedged requests are counted separately, and the latencies of requests
+	// without hedging are recorded for comparison.
+	totalHedges       int
+	totalHedgeWins    int
+	unhedgedLatencies []time.Duration
 }
 
 func newBenchmarkState(statter statsd.Client) *benchmarkState {
 	return &benchmarkState{
-		statter: statter,
-		errors:  make(map[string]int),
+		statter:       statter,
+		errors:        make(map[string]int),
+		connectErrors: make(map[string]int),
 	}
 }
 
@@ -67,12 +91,24 @@ func (s *benchmarkState) merge(other *benchmarkState) {
 	for k, v := range other.errors {
 		s.errors[k] += v
 	}
+	for k, v := range other.connectErrors {
+		s.connectErrors[k] += v
+	}
+	s.totalConnectErrors += other.totalConnectErrors
 	s.latencies = append(s.latencies, other.latencies...)
+	s.connectLatencies = append(s.connectLatencies, other.connectLatencies...)
+	s.sampledTraces = append(s.sampledTraces, other.sampledTraces...)
 	s.totalErrors += other.totalErrors
 	s.totalSuccess += other.totalSuccess
 	s.totalRequests += other.totalRequests
 	s.totalStreamMessagesReceived += other.totalStreamMessagesReceived
 	s.totalStreamMessagesSent += other.totalStreamMessagesSent
+	s.countsWireBytes = s.countsWireBytes || other.countsWireBytes
+	s.totalBytesSent += other.totalBytesSent
+	s.totalBytesReceived += other.totalBytesReceived
+	s.totalHedges += other.totalHedges
+	s.totalHedgeWins += other.totalHedgeWins
+	s.unhedgedLatencies = append(s.unhedgedLatencies, other.unhedgedLatencies...)
 }
 
 func (s *benchmarkState) recordLatency(d time.Duration) {
@@ -83,17 +119,78 @@ func (s *benchmarkState) recordLatency(d time.Duration) {
 	s.statter.Timing("latency", d)
 }
 
+func (s *benchmarkState) recordSampledTrace(traceID string, d time.Duration) {
+	s.sampledTraces = append(s.sampledTraces, sampledTrace{traceID, d})
+}
+
+func (s *benchmarkState) recordConnectLatency(d time.Duration) {
+	s.connectLatencies = append(s.connectLatencies, d)
+	s.statter.Inc("connect")
+	s.statter.Timing("connect.latency", d)
+}
+
+func (s *benchmarkState) recordConnectError(err error) {
+	s.connectErrors[errorToMessage(err)]++
+	s.totalConnectErrors++
+	s.statter.Inc("connect.error")
+}
+
 func (s *benchmarkState) recordStreamMessages(sent, received int) {
 	s.totalStreamMessagesSent += sent
 	s.totalStreamMessagesReceived += received
 }
 
+func (s *benchmarkState) recordWireBytes(sent, received int64) {
+	s.countsWireBytes = true
+	s.totalBytesSent += sent
+	s.totalBytesReceived += received
+}
+
+func (s *benchmarkState) recordHedge(r benchmarkHedgedCallReporter) {
+	if r.Hedged() {
+		s.totalHedges++
+		s.statter.Inc("hedge")
+	}
+	if r.HedgeWon() {
+		s.totalHedgeWins++
+		s.statter.Inc("hedge.win")
+	}
+	if latency, ok := r.UnhedgedLatency(); ok {
+		s.unhedgedLatencies = append(s.unhedgedLatencies, latency)
+	}
+}
+
 // Returns a mapping of quantiles to latency values
 func (s *benchmarkState) getLatencies() map[float64]time.Duration {
-	sort.Sort(byDuration(s.latencies))
+	return getQuantiles(s.latencies)
+}
+
+// Returns a mapping of quantiles to the latencies of requests without hedging
+func (s *benchmarkState) getUnhedgedLatencies() map[float64]time.Duration {
+	return getQuantiles(s.unhedgedLatencies)
+}
+
+// Returns a mapping of quantiles to connection setup latency values
+func (s *benchmarkState) getConnectLatencies() map[float64]time.Duration {
+	return getQuantiles(s.connectLatencies)
+}
+
+// getSlowestTraces returns up to n sampled traces, slowest first.
+func (s *benchmarkState) getSlowestTraces(n int) []sampledTrace {
+	sort.Slice(s.sampledTraces, func(i, j int) bool {
+		return s.sampledTraces[i].latency > s.sampledTraces[j].latency
+	})
+	if len(s.sampledTraces) < n {
+		n = len(s.sampledTraces)
+	}
+	return s.sampledTraces[:n]
+}
+
+func getQuantiles(latencies []time.Duration) map[float64]time.Duration {
+	sort.Sort(byDuration(latencies))
 	latencyValues := make(map[float64]time.Duration, len(_quantiles))
 	for _, quantile := range _quantiles {
-		latencyValues[quantile] = s.getQuantile(quantile)
+		latencyValues[quantile] = getQuantile(latencies, quantile)
 	}
 	return latencyValues
 }
@@ -115,16 +212,21 @@ func (s *benchmarkState) getErrorSummary() *ErrorSummary {
 }
 
 func (s *benchmarkState) getQuantile(q float64) time.Duration {
+	return getQuantile(s.latencies, q)
+}
+
+// getQuantile returns the quantile q of the given sorted latencies.
+func getQuantile(latencies []time.Duration, q float64) time.Duration {
 	if q < 0 || q > 1 {
 		panic(fmt.Sprintf("got unexpected quantile: %v, must be in range [0, 1]", q))
 	}
 
-	numLatencies := len(s.latencies)
+	numLatencies := len(latencies)
 	switch numLatencies {
 	case 0:
 		return 0
 	case 1:
-		return s.latencies[0]
+		return latencies[0]
 	}
 
 	lastIndex := numLatencies - 1
@@ -132,14 +234,14 @@ func (s *benchmarkState) getQuantile(q float64) time.Duration {
 	exactIdx := q * float64(lastIndex)
 	leftIdx := int(exactIdx)
 	if leftIdx >= lastIndex {
-		return s.latencies[lastIndex]
+		return latencies[lastIndex]
 	}
 
 	rightIdx := leftIdx + 1
 	rightBias := exactIdx - float64(leftIdx)
 	leftBias := 1 - rightBias
 
-	return time.Duration(float64(s.latencies[leftIdx])*leftBias + float64(s.latencies[rightIdx])*rightBias)
+	return time.Duration(float64(latencies[leftIdx])*leftBias + float64(latencies[rightIdx])*rightBias)
 }
 
 type byDuration []time.Duration
@@ -149,8 +251,13 @@ func (p byDuration) Less(i, j int) bool { return p[i] < p[j] }
 func (p byDuration) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 // errorToMessage takes an error and converts it to a message that's stored.
-// It strips out digits and replaces them with a single X.
+// It strips out digits and replaces them with a single X. HTTP error
+// responses are grouped by their status code.
 func errorToMessage(err error) string {
+	if statusErr, ok := asHTTPStatusError(err); ok {
+		return fmt.Sprintf("HTTP call got non-success response code: %v", statusErr.StatusCode)
+	}
+
 	origMsg := err.Error()
 	consecutiveDigits := 0
 	buf := make([]byte, 0, len(origMsg))
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/yarpc/yab/statsd"
+	"github.com/yarpc/yab/transport"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -175,6 +176,10 @@ func TestErrorToMessage(t *testing.T) {
 		{errors.New("has two 22 digits"), "has two X digits"},
 		{errors.New("has lots 12345 digits"), "has lots X digits"},
 		{errors.New("has an ip 10.2.40.5"), "has an ip X.X.X.X"},
+		{
+			&transport.HTTPStatusError{StatusCode: 503, Response: &transport.Response{Body: []byte("error 123")}},
+			"HTTP call got non-success response code: 503",
+		},
 	}
 
 	for _, tt := range tests {
@@ -238,3 +243,21 @@ func TestBenchmarkStateGetQuantileSuccess(t *testing.T) {
 		assert.Equal(t, tt.want, got, "P%v of %v mismatch", tt.q, tt.latencies)
 	}
 }
+
+func TestBenchmarkStateSlowestTraces(t *testing.T) {
+	state1 := newBenchmarkState(statsd.Noop)
+	state1.recordSampledTrace("a", 3*time.Millisecond)
+	state1.recordSampledTrace("b", time.Millisecond)
+
+	state2 := newBenchmarkState(statsd.Noop)
+	state2.recordSampledTrace("c", 5*time.Millisecond)
+	state2.recordSampledTrace("d", 2*time.Millisecond)
+
+	state1.merge(state2)
+	assert.Equal(t, []sampledTrace{
+		{"c", 5 * time.Millisecond},
+		{"a", 3 * time.Millisecond},
+		{"d", 2 * time.Millisecond},
+	}, state1.getSlowestTraces(3), "Unexpected slowest traces")
+	assert.Len(t, state1.getSlowestTraces(10), 4, "Should return all traces if there are fewer than requested")
+}
@@ -21,9 +21,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"os/signal"
@@ -34,22 +36,40 @@ import (
 
 	"github.com/yarpc/yab/encoding"
 	"github.com/yarpc/yab/limiter"
+	"github.com/yarpc/yab/ratelimit"
 	"github.com/yarpc/yab/sorted"
 	"github.com/yarpc/yab/statsd"
 	"github.com/yarpc/yab/transport"
 
+	"github.com/opentracing/opentracing-go"
 	"go.uber.org/zap"
 )
 
 var (
-	errNegativeDuration = errors.New("duration cannot be negative")
-	errNegativeMaxReqs  = errors.New("max requests cannot be negative")
+	errNegativeDuration  = errors.New("duration cannot be negative")
+	errNegativeMaxReqs   = errors.New("max requests cannot be negative")
+	errNegativeReconnect = errors.New("reconnect-every cannot be negative")
+	errTraceSampleRate   = errors.New("trace sample rate must be between 0 and 1")
+	errHedgeReconnect    = errors.New("hedging cannot be used with reconnect-every")
+	errBurstArrival      = errors.New("burst can only be used with the burst arrival")
+
+	errNegativePeerRefresh     = errors.New("peer-refresh cannot be negative")
+	errPeerRefreshReconnect    = errors.New("peer-refresh cannot be used with reconnect-every")
+	errPeerRefreshHedge        = errors.New("peer-refresh cannot be used with hedging")
+	errPeerRefreshPerPeerStats = errors.New("peer-refresh cannot be used with per-peer-stats")
 
 	// using a global _quantiles slice mainly for ease of testing, and not passing
 	// the same array around to multiple functions
 	_quantiles = []float64{0.5000, 0.9000, 0.9500, 0.9900, 0.9990, 0.9995, 1.0000}
 )
 
+// maxReportedTraces is the number of slowest sampled traces in the report.
+const maxReportedTraces = 10
+
+// maxConnectAttempts is the number of times a reconnecting worker tries to
+// connect before a call, after which the worker stops.
+const maxConnectAttempts = 3
+
 // Parameters holds values of all benchmark parameters
 type Parameters struct {
 	CPUs        int    `json:"cpus"`
@@ -58,6 +78,37 @@ type Parameters struct {
 	MaxRequests int    `json:"maxRequests"`
 	MaxDuration string `json:"maxDuration"`
 	MaxRPS      int    `json:"maxRPS"`
+
+	// PeerStrategy is how benchmark connections are assigned to peers.
+	PeerStrategy string `json:"peerStrategy"`
+
+	// Compressor is the compressor used for gRPC requests, if any.
+	Compressor string `json:"compressor,omitempty"`
+
+	// Protocols are the protocols used by peers. It is omitted unless peers
+	// use mixed protocols.
+	Protocols []string `json:"protocols,omitempty"`
+
+	// ReconnectEvery is the number of requests made on a connection before
+	// it's replaced. It is omitted when connections are reused.
+	ReconnectEvery int `json:"reconnectEvery,omitempty"`
+
+	// Arrival, Burst and ArrivalSeed describe how requests are spaced when
+	// the RPS is limited. They are omitted for the default uniform arrival.
+	Arrival     string `json:"arrival,omitempty"`
+	Burst       int    `json:"burst,omitempty"`
+	ArrivalSeed int64  `json:"arrivalSeed,omitempty"`
+
+	// TraceSampleRate is the fraction of requests that are traced.
+	TraceSampleRate float64 `json:"traceSampleRate,omitempty"`
+
+	// Hedge is the delay before requests are hedged, either a duration or a
+	// percentile. It is omitted when requests are not hedged.
+	Hedge string `json:"hedge,omitempty"`
+
+	// PeerRefresh is how often the peer list is refreshed. It is omitted
+	// when the peer list is only resolved once.
+	PeerRefresh string `json:"peerRefresh,omitempty"`
 }
 
 // Summary stores the benchmarking summary
@@ -74,6 +125,73 @@ type ErrorSummary struct {
 	ErrorsCount map[string]int `json:"errorsCount"`
 }
 
+// ConnectSummary stores the connection setup latencies when connections are
+// re-established during the benchmark. Failed connections aren't requests,
+// so they're counted separately from the errors in ErrorSummary.
+type ConnectSummary struct {
+	TotalConnections int               `json:"totalConnections"`
+	Latencies        map[string]string `json:"latencies"`
+	TotalErrors      int               `json:"totalErrors"`
+	ErrorsCount      map[string]int    `json:"errorsCount,omitempty"`
+}
+
+// HedgeSummary stores the results of hedging requests. The unhedged
+// latencies are those of the requests sent first, as if they weren't hedged.
+type HedgeSummary struct {
+	TotalHedges       int               `json:"totalHedges"`
+	HedgeRate         float64           `json:"hedgeRate"`
+	TotalWins         int               `json:"totalWins"`
+	WinRate           float64           `json:"winRate"`
+	UnhedgedLatencies map[string]string `json:"unhedgedLatencies"`
+}
+
+// PeerRefreshSummary stores the changes to the peer list when it's refreshed
+// during the benchmark. Connections to removed peers are moved to the
+// current peers, and the previous connections are drained.
+type PeerRefreshSummary struct {
+	TotalRefreshes    int              `json:"totalRefreshes"`
+	FailedRefreshes   int              `json:"failedRefreshes"`
+	ConnectionsMoved  int              `json:"connectionsMoved"`
+	FailedConnections int              `json:"failedConnections"`
+	Changes           []PeerListChange `json:"changes,omitempty"`
+
+	// Connections is the number of connections to each peer at the end of
+	// the benchmark.
+	Connections map[string]int `json:"connections"`
+}
+
+// PeerListChange is a change to the peer list, which happened the elapsed
+// time after the benchmark started.
+type PeerListChange struct {
+	Elapsed    string   `json:"elapsed"`
+	Added      []string `json:"added,omitempty"`
+	Removed    []string `json:"removed,omitempty"`
+	TotalPeers int      `json:"totalPeers"`
+}
+
+// SampledTrace identifies a traced request and its latency.
+type SampledTrace struct {
+	TraceID string `json:"traceID"`
+	Latency string `json:"latency"`
+}
+
+// WireSummary stores the bytes of request and response messages on the
+// wire, after compression.
+type WireSummary struct {
+	TotalBytesSent          int64 `json:"totalBytesSent"`
+	TotalBytesReceived      int64 `json:"totalBytesReceived"`
+	BytesSentPerRequest     int64 `json:"bytesSentPerRequest"`
+	BytesReceivedPerRequest int64 `json:"bytesReceivedPerRequest"`
+}
+
+// ProtocolSummary stores the results for peers that use one protocol, when
+// peers use mixed protocols.
+type ProtocolSummary struct {
+	TotalRequests int               `json:"totalRequests"`
+	Latencies     map[string]string `json:"latencies"`
+	ErrorSummary  *ErrorSummary     `json:"errorSummary,omitempty"`
+}
+
 // StreamSummary stores summary of stream messages sent and received
 type StreamSummary struct {
 	TotalStreamMessagesSent     int `json:"totalStreamMessagesSent"`
@@ -92,6 +210,27 @@ type BenchmarkOutput struct {
 	// StreamSummary is available only for streaming benchmark. It is nil and
 	// omitted in unary benchmark.
 	StreamSummary *StreamSummary `json:"streamSummary,omitempty"`
+
+	// ConnectSummary is available only when --reconnect-every is set.
+	ConnectSummary *ConnectSummary `json:"connectSummary,omitempty"`
+
+	// WireSummary is available only for transports that count the bytes
+	// on the wire, such as gRPC.
+	WireSummary *WireSummary `json:"wireSummary,omitempty"`
+
+	// HedgeSummary is available only when --hedge is set.
+	HedgeSummary *HedgeSummary `json:"hedgeSummary,omitempty"`
+
+	// PeerRefreshSummary is available only when --peer-refresh is set.
+	PeerRefreshSummary *PeerRefreshSummary `json:"peerRefreshSummary,omitempty"`
+
+	// SlowestTraces lists the slowest sampled requests when
+	// --trace-sample-rate is set.
+	SlowestTraces []SampledTrace `json:"slowestTraces,omitempty"`
+
+	// Protocols has the results for each protocol, keyed by protocol, when
+	// peers use mixed protocols.
+	Protocols map[string]*ProtocolSummary `json:"protocols,omitempty"`
 }
 
 // setGoMaxProcs sets runtime.GOMAXPROCS if the option is set
@@ -119,6 +258,39 @@ func (o BenchmarkOptions) validate() error {
 	if o.MaxRequests < 0 {
 		return errNegativeMaxReqs
 	}
+	if o.ReconnectEvery < 0 {
+		return errNegativeReconnect
+	}
+	if o.TraceSampleRate < 0 || o.TraceSampleRate > 1 {
+		return errTraceSampleRate
+	}
+	if err := ratelimit.ValidateArrival(o.Arrival); err != nil {
+		return err
+	}
+	if o.Burst != 0 && o.Arrival != ratelimit.Burst {
+		return errBurstArrival
+	}
+	if o.Hedge != "" {
+		if _, err := parseHedgeDelay(o.Hedge); err != nil {
+			return err
+		}
+		if o.ReconnectEvery > 0 {
+			return errHedgeReconnect
+		}
+	}
+	if o.PeerRefresh < 0 {
+		return errNegativePeerRefresh
+	}
+	if o.PeerRefresh > 0 {
+		switch {
+		case o.ReconnectEvery > 0:
+			return errPeerRefreshReconnect
+		case o.Hedge != "":
+			return errPeerRefreshHedge
+		case o.PerPeerStats:
+			return errPeerRefreshPerPeerStats
+		}
+	}
 
 	return nil
 }
@@ -133,20 +305,96 @@ func (o BenchmarkOptions) enabled() bool {
 
 func runWorker(t transport.Transport, b benchmarkCaller, s *benchmarkState, run *limiter.Run, logger *zap.Logger) {
 	for cur := run; cur.More(); {
-		callReport, err := b.Call(t)
+		makeBenchmarkCall(t, b, s, logger)
+	}
+}
+
+// runReconnectingWorker is like runWorker, but uses a new transport created by
+// connect for every reconnectEvery calls. The previous transport is closed
+// before a new one is created. Failed connections are retried for the same
+// call, so they don't use up requests, and the worker stops if it can't
+// connect after maxConnectAttempts.
+func runReconnectingWorker(connect func() (transport.Transport, error), reconnectEvery int, b benchmarkCaller, s *benchmarkState, run *limiter.Run, logger *zap.Logger) {
+	var (
+		t     transport.Transport
+		calls int
+	)
+	release := func() {
+		if sent, received, ok := wireBytes(t); ok {
+			s.recordWireBytes(sent, received)
+		}
+		closeTransport(t)
+	}
+	defer func() { release() }()
+
+	for cur := run; cur.More(); {
+		if t == nil || calls >= reconnectEvery {
+			release()
+			t, calls = nil, 0
+
+			if t = connectWithRetries(connect, s, logger); t == nil {
+				logger.Warn("Stopping worker after failing to connect.", zap.Int("attempts", maxConnectAttempts))
+				return
+			}
+		}
+
+		calls++
+		makeBenchmarkCall(t, b, s, logger)
+	}
+}
+
+// connectWithRetries returns a new transport created by connect, trying up
+// to maxConnectAttempts times. It returns nil if every attempt fails.
+func connectWithRetries(connect func() (transport.Transport, error), s *benchmarkState, logger *zap.Logger) transport.Transport {
+	for i := 0; i < maxConnectAttempts; i++ {
+		start := time.Now()
+		t, err := connect()
 		if err != nil {
-			s.recordError(err)
-			// TODO: Add information about which peer specifically failed.
-			logger.Info("Failed while making call.", zap.Error(err))
+			s.recordConnectError(err)
+			logger.Info("Failed while connecting.", zap.Error(err))
 			continue
 		}
+		s.recordConnectLatency(time.Since(start))
+		return t
+	}
+	return nil
+}
+
+// wireBytes returns the bytes on the wire sent and received by the transport,
+// if the transport counts them.
+func wireBytes(t transport.Transport) (sent, received int64, ok bool) {
+	counter, ok := t.(transport.WireCounter)
+	if !ok {
+		return 0, 0, false
+	}
+	sent, received = counter.WireBytes()
+	return sent, received, true
+}
 
-		s.recordLatency(callReport.Latency())
+func makeBenchmarkCall(t transport.Transport, b benchmarkCaller, s *benchmarkState, logger *zap.Logger) {
+	callReport, err := b.Call(context.Background(), t)
+	if err != nil {
+		s.recordError(err)
+		// TODO: Add information about which peer specifically failed.
+		logger.Info("Failed while making call.", zap.Error(err))
+		return
+	}
+
+	s.recordLatency(callReport.Latency())
+
+	if hedgedCallReport, ok := callReport.(benchmarkHedgedCallReporter); ok {
+		s.recordHedge(hedgedCallReport)
+	}
 
-		if streamCallReport, ok := callReport.(benchmarkStreamCallReporter); ok {
-			s.recordStreamMessages(streamCallReport.StreamMessagesSent(), streamCallReport.StreamMessagesReceived())
+	if tracedCallReport, ok := callReport.(benchmarkTracedCallReporter); ok {
+		if traceID := tracedCallReport.TraceID(); traceID != "" {
+			s.recordSampledTrace(traceID, callReport.Latency())
 		}
 	}
+
+	if streamCallReport, ok := callReport.(benchmarkStreamCallReporter); ok {
+		s.recordStreamMessages(streamCallReport.StreamMessagesSent(), streamCallReport.StreamMessagesReceived())
+	}
 }
 
 func runBenchmark(out output, logger *zap.Logger, allOpts Options, resolved resolvedProtocolEncoding, methodName string, b benchmarkCaller) {
@@ -167,6 +415,19 @@ func runBenchmark(out output, logger *zap.Logger, allOpts Options, resolved reso
 		}
 	}
 
+	var arrival ratelimit.ArrivalOptions
+	if opts.RPS > 0 {
+		// Fill in the defaults here so the seed and burst can be reported,
+		// and the seed reused to reproduce the run.
+		arrival = ratelimit.ArrivalOptions{
+			Arrival: opts.Arrival,
+			Burst:   opts.Burst,
+			Seed:    opts.ArrivalSeed,
+		}.WithDefaults(opts.RPS)
+		opts.Burst = arrival.Burst
+		opts.ArrivalSeed = arrival.Seed
+	}
+
 	goMaxProcs := opts.setGoMaxProcs()
 	numConns := opts.getNumConnections(goMaxProcs)
 
@@ -177,6 +438,36 @@ func runBenchmark(out output, logger *zap.Logger, allOpts Options, resolved reso
 		MaxRequests: opts.MaxRequests,
 		MaxDuration: opts.MaxDuration.String(),
 		MaxRPS:      opts.RPS,
+
+		PeerStrategy:    benchmarkPeerStrategy(allOpts.TOpts),
+		ReconnectEvery:  opts.ReconnectEvery,
+		TraceSampleRate: opts.TraceSampleRate,
+		Hedge:           opts.Hedge,
+	}
+	if opts.PeerRefresh > 0 {
+		parameters.PeerRefresh = opts.PeerRefresh.String()
+	}
+
+	protocols := benchmarkProtocols(allOpts.TOpts.Peers, resolved.protocol)
+	for _, p := range protocols {
+		if len(protocols) > 1 {
+			parameters.Protocols = append(parameters.Protocols, p.String())
+		}
+		if p == transport.GRPC {
+			parameters.Compressor = allOpts.TOpts.GRPCCompressor
+		}
+	}
+
+	// Arrivals only apply when the RPS is limited.
+	if opts.RPS > 0 {
+		switch opts.Arrival {
+		case ratelimit.Poisson:
+			parameters.Arrival = opts.Arrival
+			parameters.ArrivalSeed = opts.ArrivalSeed
+		case ratelimit.Burst:
+			parameters.Arrival = opts.Arrival
+			parameters.Burst = opts.Burst
+		}
 	}
 
 	// If format is JSON, benchmark parameters are printed after benchmark is run to maintain a single JSON blob
@@ -191,13 +482,53 @@ func runBenchmark(out output, logger *zap.Logger, allOpts Options, resolved reso
 		printParameters(out, parameters)
 	}
 
+	tracer, closer := getBenchmarkTracer(allOpts, out)
+	if closer != nil {
+		defer closer.Close()
+	}
+
 	// Warm up number of connections.
 	logger.Debug("Warming up connections.", zap.Int("numConns", numConns))
-	connections, err := warmTransports(b, numConns, allOpts.TOpts, resolved, opts.WarmupRequests)
+	connections, err := warmTransports(b, numConns, allOpts.TOpts, resolved, tracer, opts.WarmupRequests)
 	if err != nil {
 		out.Fatalf("Failed to warmup connections for benchmark: %v", err)
 	}
 
+	var hedges []transport.Transport
+	var hedgeAfter *hedgeDelay
+	var unhedged *unhedgedLatencies
+	if opts.Hedge != "" {
+		if b.CallMethodType() != encoding.Unary {
+			out.Fatalf("Hedging is only supported for unary methods\n")
+		}
+		if len(allOpts.TOpts.Peers) < 2 {
+			out.Fatalf("Hedging requires at least 2 peers\n")
+		}
+
+		// The delay was checked when validating options.
+		hedgeAfter, _ = parseHedgeDelay(opts.Hedge)
+		unhedged = &unhedgedLatencies{}
+		hedges, err = warmHedgeTransports(b, connections, allOpts.TOpts, resolved, tracer, opts.WarmupRequests)
+		if err != nil {
+			out.Fatalf("Failed to warmup connections for hedging: %v", err)
+		}
+	}
+
+	var refresher *peerRefresher
+	if opts.PeerRefresh > 0 {
+		if allOpts.TOpts.ResolvedPeerList == "" {
+			out.Fatalf("Peer refresh requires a peer list (-P)\n")
+		}
+		if len(protocols) > 1 {
+			out.Fatalf("Peer refresh requires peers that use a single protocol\n")
+		}
+
+		refresher, err = newPeerRefresher(allOpts, resolved, tracer, connections, logger)
+		if err != nil {
+			out.Fatalf("Failed to set up peer refresh: %v\n", err)
+		}
+	}
+
 	globalStatter, err := statsd.NewClient(logger, opts.StatsdHostPort, allOpts.TOpts.ServiceName, methodName)
 	if err != nil {
 		out.Fatalf("Failed to create statsd client for benchmark: %v", err)
@@ -224,19 +555,81 @@ func runBenchmark(out output, logger *zap.Logger, allOpts Options, resolved reso
 		}
 	}
 
-	run := limiter.New(opts.MaxRequests, opts.RPS, opts.MaxDuration)
+	// The protocol of each connection is recorded while its transport is
+	// open, since reconnecting workers close the warmed up connections.
+	connProtocols := make([]string, len(connections))
+	for i, c := range connections {
+		connProtocols[i] = c.Transport.Protocol().String()
+	}
+
+	if opts.ReconnectEvery > 0 {
+		// Each caller creates its own connections, so the warmed up
+		// connections are no longer needed.
+		for _, c := range connections {
+			closeTransport(c.Transport)
+		}
+	}
+
+	rateLimiter := ratelimit.NewInfinite()
+	if opts.RPS > 0 {
+		rateLimiter, err = ratelimit.NewArrival(opts.RPS, arrival)
+		if err != nil {
+			out.Fatalf("Failed to create rate limiter for benchmark: %v", err)
+		}
+	}
+
+	// Connections are warmed up, so only count the bytes on the wire
+	// from the start of the benchmark.
+	type wireSnapshot struct{ sent, received int64 }
+	wireStart := make([]wireSnapshot, len(connections))
+	for i, c := range connections {
+		wireStart[i].sent, wireStart[i].received, _ = wireBytes(c.Transport)
+	}
+
+	run := limiter.NewWithLimiter(opts.MaxRequests, rateLimiter, opts.MaxDuration)
 	stopOnInterrupt(out, run)
 
 	logger.Info("Benchmark starting.", zap.Any("options", opts))
 	start := time.Now()
+	if refresher != nil {
+		refresher.run(start)
+	}
 	for i, c := range connections {
 		for j := 0; j < opts.Concurrency; j++ {
 			state := states[i*opts.Concurrency+j]
 
 			wg.Add(1)
+			if refresher != nil {
+				go func(c *refreshingConn) {
+					defer wg.Done()
+					runRefreshingWorker(c, b, state, run, logger)
+				}(refresher.conns[i])
+				continue
+			}
+
+			if opts.ReconnectEvery > 0 {
+				tOpts := allOpts.TOpts
+				tOpts.Peers = []string{allOpts.TOpts.Peers[c.peerID]}
+				tOpts.PeerWeights = nil
+				connect := func() (transport.Transport, error) {
+					return connectTransport(tOpts, resolved, tracer, allOpts.ROpts.Timeout.Duration())
+				}
+
+				go func() {
+					defer wg.Done()
+					runReconnectingWorker(connect, opts.ReconnectEvery, b, state, run, logger)
+				}()
+				continue
+			}
+
+			caller := b
+			if hedges != nil {
+				caller = hedgedCaller{benchmarkCaller: b, hedge: hedges[i], delay: hedgeAfter, unhedged: unhedged}
+			}
+
 			go func(t transport.Transport) {
 				defer wg.Done()
-				runWorker(t, b, state, run, logger)
+				runWorker(t, caller, state, run, logger)
 			}(c.Transport)
 		}
 	}
@@ -244,11 +637,51 @@ func runBenchmark(out output, logger *zap.Logger, allOpts Options, resolved reso
 	// Wait for all the worker goroutines to end.
 	wg.Wait()
 	total := time.Since(start)
+	if refresher != nil {
+		refresher.close()
+	}
+
+	var protocolSummaries map[string]*ProtocolSummary
+	if len(protocols) > 1 {
+		protocolStates := make(map[string]*benchmarkState)
+		for i, protocol := range connProtocols {
+			if protocolStates[protocol] == nil {
+				protocolStates[protocol] = newBenchmarkState(nil)
+			}
+			for j := 0; j < opts.Concurrency; j++ {
+				protocolStates[protocol].merge(states[i*opts.Concurrency+j])
+			}
+		}
+
+		protocolSummaries = make(map[string]*ProtocolSummary, len(protocolStates))
+		for protocol, s := range protocolStates {
+			protocolSummaries[protocol] = &ProtocolSummary{
+				TotalRequests: s.totalRequests,
+				Latencies:     formatLatencies(s.getLatencies()),
+				ErrorSummary:  s.getErrorSummary(),
+			}
+		}
+	}
+
 	// Merge all the states into 0
 	overall := states[0]
 	for _, s := range states[1:] {
 		overall.merge(s)
 	}
+	if unhedged != nil {
+		// Primary requests whose hedge won may still be in flight.
+		overall.unhedgedLatencies = append(overall.unhedgedLatencies, unhedged.wait()...)
+	}
+	switch {
+	case refresher != nil:
+		refresher.mergeWireBytes(overall)
+	case opts.ReconnectEvery == 0:
+		for i, c := range connections {
+			if sent, received, ok := wireBytes(c.Transport); ok {
+				overall.recordWireBytes(sent-wireStart[i].sent, received-wireStart[i].received)
+			}
+		}
+	}
 
 	logger.Info("Benchmark complete.",
 		zap.Duration("totalDuration", total),
@@ -280,25 +713,116 @@ func runBenchmark(out output, logger *zap.Logger, allOpts Options, resolved reso
 		}
 	}
 
+	var connectSummary *ConnectSummary
+	if opts.ReconnectEvery > 0 {
+		connectSummary = &ConnectSummary{
+			TotalConnections: len(overall.connectLatencies),
+			Latencies:        formatLatencies(overall.getConnectLatencies()),
+			TotalErrors:      overall.totalConnectErrors,
+		}
+		if len(overall.connectErrors) > 0 {
+			connectSummary.ErrorsCount = overall.connectErrors
+		}
+	}
+
+	var wireSummary *WireSummary
+	if overall.countsWireBytes {
+		wireSummary = &WireSummary{
+			TotalBytesSent:     overall.totalBytesSent,
+			TotalBytesReceived: overall.totalBytesReceived,
+		}
+		if overall.totalRequests > 0 {
+			wireSummary.BytesSentPerRequest = overall.totalBytesSent / int64(overall.totalRequests)
+			wireSummary.BytesReceivedPerRequest = overall.totalBytesReceived / int64(overall.totalRequests)
+		}
+	}
+
+	var hedgeSummary *HedgeSummary
+	if opts.Hedge != "" {
+		hedgeSummary = &HedgeSummary{
+			TotalHedges:       overall.totalHedges,
+			TotalWins:         overall.totalHedgeWins,
+			UnhedgedLatencies: formatLatencies(overall.getUnhedgedLatencies()),
+		}
+		if overall.totalRequests > 0 {
+			hedgeSummary.HedgeRate = 100 * float64(overall.totalHedges) / float64(overall.totalRequests)
+		}
+		if overall.totalHedges > 0 {
+			hedgeSummary.WinRate = 100 * float64(overall.totalHedgeWins) / float64(overall.totalHedges)
+		}
+	}
+
+	var peerRefreshSummary *PeerRefreshSummary
+	if refresher != nil {
+		peerRefreshSummary = refresher.getSummary()
+	}
+
+	var slowestTraces []SampledTrace
+	for _, t := range overall.getSlowestTraces(maxReportedTraces) {
+		slowestTraces = append(slowestTraces, SampledTrace{
+			TraceID: t.traceID,
+			Latency: t.latency.String(),
+		})
+	}
+
 	if formatAsJSON {
-		outputJSON(out, parameters, latencyValues, summary, streamSummary, errors)
+		outputJSON(out, parameters, latencyValues, summary, streamSummary, connectSummary, wireSummary, hedgeSummary, peerRefreshSummary, slowestTraces, protocolSummaries, errors)
 	} else {
-		outputPlaintext(out, latencyValues, summary, streamSummary, errors)
+		outputPlaintext(out, latencyValues, summary, streamSummary, connectSummary, wireSummary, hedgeSummary, peerRefreshSummary, slowestTraces, protocolSummaries, errors)
+	}
+}
+
+// benchmarkProtocols returns the protocols used to call the peers, in the
+// order that they're first seen.
+func benchmarkProtocols(peers []string, resolved transport.Protocol) []transport.Protocol {
+	if len(peers) == 0 {
+		return []transport.Protocol{resolved}
+	}
+
+	var protocols []transport.Protocol
+	seen := make(map[transport.Protocol]bool)
+	for _, peer := range peers {
+		// A single peer never has mixed protocols.
+		p, _ := peersProtocol([]string{peer}, resolved)
+		if !seen[p] {
+			seen[p] = true
+			protocols = append(protocols, p)
+		}
+	}
+	return protocols
+}
+
+// getBenchmarkTracer returns a Jaeger tracer if benchmark requests are
+// sampled for tracing, and a no-op tracer otherwise.
+func getBenchmarkTracer(opts Options, out output) (opentracing.Tracer, io.Closer) {
+	if opts.BOpts.TraceSampleRate == 0 {
+		return opentracing.NoopTracer{}, nil
 	}
+	return createJaegerTracer(opts, out)
 }
 
-func outputJSON(out output, parameters Parameters, latencyValues map[float64]time.Duration, summary Summary, streamSummary *StreamSummary, errorSummary *ErrorSummary) {
+func formatLatencies(latencyValues map[float64]time.Duration) map[string]string {
 	latencies := make(map[string]string, len(_quantiles))
 	for _, quantile := range _quantiles {
 		latencies[fmt.Sprintf("%.4f", quantile)] = latencyValues[quantile].String()
 	}
+	return latencies
+}
 
+func outputJSON(out output, parameters Parameters, latencyValues map[float64]time.Duration, summary Summary, streamSummary *StreamSummary, connectSummary *ConnectSummary, wireSummary *WireSummary, hedgeSummary *HedgeSummary, peerRefreshSummary *PeerRefreshSummary, slowestTraces []SampledTrace, protocolSummaries map[string]*ProtocolSummary, errorSummary *ErrorSummary) {
 	benchmarkOutput := BenchmarkOutput{
-		Parameters:    parameters,
-		Latencies:     latencies,
-		Summary:       summary,
-		ErrorSummary:  errorSummary,
-		StreamSummary: streamSummary,
+		Parameters:     parameters,
+		Latencies:      formatLatencies(latencyValues),
+		Summary:        summary,
+		ErrorSummary:   errorSummary,
+		StreamSummary:  streamSummary,
+		ConnectSummary: connectSummary,
+		WireSummary:    wireSummary,
+		HedgeSummary:   hedgeSummary,
+		SlowestTraces:  slowestTraces,
+		Protocols:      protocolSummaries,
+
+		PeerRefreshSummary: peerRefreshSummary,
 	}
 
 	jsonOutput, err := json.MarshalIndent(&benchmarkOutput, "" /* prefix */, "  " /* indent */)
@@ -308,13 +832,50 @@ func outputJSON(out output, parameters Parameters, latencyValues map[float64]tim
 	out.Printf("%s\n", jsonOutput)
 }
 
-func outputPlaintext(out output, latencyValues map[float64]time.Duration, summary Summary, streamSummary *StreamSummary, errorSummary *ErrorSummary) {
+func outputPlaintext(out output, latencyValues map[float64]time.Duration, summary Summary, streamSummary *StreamSummary, connectSummary *ConnectSummary, wireSummary *WireSummary, hedgeSummary *HedgeSummary, peerRefreshSummary *PeerRefreshSummary, slowestTraces []SampledTrace, protocolSummaries map[string]*ProtocolSummary, errorSummary *ErrorSummary) {
 	// Print errors
 	printErrors(out, errorSummary)
 
 	// Print out latencies
 	printLatencies(out, latencyValues)
 
+	if connectSummary != nil {
+		out.Printf("Connect latencies:\n")
+		for _, quantile := range _quantiles {
+			out.Printf("  %.4f: %v\n", quantile, connectSummary.Latencies[fmt.Sprintf("%.4f", quantile)])
+		}
+		if len(connectSummary.ErrorsCount) > 0 {
+			out.Printf("Connect errors:\n")
+			for _, k := range sorted.MapKeys(connectSummary.ErrorsCount) {
+				out.Printf("  %4d: %v\n", connectSummary.ErrorsCount[k], k)
+			}
+		}
+	}
+
+	if hedgeSummary != nil {
+		out.Printf("Latencies without hedging:\n")
+		for _, quantile := range _quantiles {
+			out.Printf("  %.4f: %v\n", quantile, hedgeSummary.UnhedgedLatencies[fmt.Sprintf("%.4f", quantile)])
+		}
+	}
+
+	if len(protocolSummaries) > 0 {
+		for _, protocol := range sorted.MapKeys(protocolSummaries) {
+			printProtocolSummary(out, protocol, protocolSummaries[protocol])
+		}
+	}
+
+	if peerRefreshSummary != nil {
+		printPeerListChanges(out, peerRefreshSummary)
+	}
+
+	if len(slowestTraces) > 0 {
+		out.Printf("Slowest traced requests:\n")
+		for _, t := range slowestTraces {
+			out.Printf("  %v: %v\n", t.Latency, t.TraceID)
+		}
+	}
+
 	// Print out summary
 	out.Printf("Elapsed time (seconds):         %.2f\n", summary.ElapsedTimeSeconds)
 	out.Printf("Total requests:                 %v\n", summary.TotalRequests)
@@ -324,6 +885,32 @@ func outputPlaintext(out output, latencyValues map[float64]time.Duration, summar
 		out.Printf("Total stream messages sent:     %v\n", streamSummary.TotalStreamMessagesSent)
 		out.Printf("Total stream messages received: %v\n", streamSummary.TotalStreamMessagesReceived)
 	}
+
+	if connectSummary != nil {
+		out.Printf("Total connections:              %v\n", connectSummary.TotalConnections)
+		out.Printf("Total connect errors:           %v\n", connectSummary.TotalErrors)
+	}
+
+	if wireSummary != nil {
+		out.Printf("Total bytes sent:               %v\n", wireSummary.TotalBytesSent)
+		out.Printf("Total bytes received:           %v\n", wireSummary.TotalBytesReceived)
+		out.Printf("Bytes sent per request:         %v\n", wireSummary.BytesSentPerRequest)
+		out.Printf("Bytes received per request:     %v\n", wireSummary.BytesReceivedPerRequest)
+	}
+
+	if hedgeSummary != nil {
+		out.Printf("Total hedges:                   %v\n", hedgeSummary.TotalHedges)
+		out.Printf("Hedge rate:                     %.4f%%\n", hedgeSummary.HedgeRate)
+		out.Printf("Hedge wins:                     %v\n", hedgeSummary.TotalWins)
+		out.Printf("Hedge win rate:                 %.4f%%\n", hedgeSummary.WinRate)
+	}
+
+	if peerRefreshSummary != nil {
+		out.Printf("Total peer refreshes:           %v\n", peerRefreshSummary.TotalRefreshes)
+		out.Printf("Failed peer refreshes:          %v\n", peerRefreshSummary.FailedRefreshes)
+		out.Printf("Connections moved:              %v\n", peerRefreshSummary.ConnectionsMoved)
+		out.Printf("Failed connections:             %v\n", peerRefreshSummary.FailedConnections)
+	}
 }
 
 func printParameters(out output, parameters Parameters) {
@@ -334,6 +921,31 @@ func printParameters(out output, parameters Parameters) {
 	out.Printf("  Max requests:    %v\n", parameters.MaxRequests)
 	out.Printf("  Max duration:    %v\n", parameters.MaxDuration)
 	out.Printf("  Max RPS:         %v\n", parameters.MaxRPS)
+	out.Printf("  Peer strategy:   %v\n", parameters.PeerStrategy)
+	if parameters.Compressor != "" {
+		out.Printf("  Compressor:      %v\n", parameters.Compressor)
+	}
+	if len(parameters.Protocols) > 0 {
+		out.Printf("  Protocols:       %v\n", strings.Join(parameters.Protocols, ", "))
+	}
+	switch parameters.Arrival {
+	case ratelimit.Poisson:
+		out.Printf("  Arrival:         %v (seed %v)\n", parameters.Arrival, parameters.ArrivalSeed)
+	case ratelimit.Burst:
+		out.Printf("  Arrival:         %v (burst %v)\n", parameters.Arrival, parameters.Burst)
+	}
+	if parameters.ReconnectEvery > 0 {
+		out.Printf("  Reconnect every: %v requests\n", parameters.ReconnectEvery)
+	}
+	if parameters.Hedge != "" {
+		out.Printf("  Hedge after:     %v\n", parameters.Hedge)
+	}
+	if parameters.PeerRefresh != "" {
+		out.Printf("  Peer refresh:    %v\n", parameters.PeerRefresh)
+	}
+	if parameters.TraceSampleRate > 0 {
+		out.Printf("  Trace sample rate: %v\n", parameters.TraceSampleRate)
+	}
 }
 
 func printLatencies(out output, latencyValues map[float64]time.Duration) {
@@ -343,6 +955,42 @@ func printLatencies(out output, latencyValues map[float64]time.Duration) {
 	}
 }
 
+func printProtocolSummary(out output, protocol string, summary *ProtocolSummary) {
+	out.Printf("Protocol %v:\n", protocol)
+	out.Printf("  Total requests: %v\n", summary.TotalRequests)
+	out.Printf("  Latencies:\n")
+	for _, quantile := range _quantiles {
+		out.Printf("    %.4f: %v\n", quantile, summary.Latencies[fmt.Sprintf("%.4f", quantile)])
+	}
+	if errorSum := summary.ErrorSummary; errorSum != nil {
+		out.Printf("  Errors:\n")
+		for _, k := range sorted.MapKeys(errorSum.ErrorsCount) {
+			out.Printf("    %4d: %v\n", errorSum.ErrorsCount[k], k)
+		}
+		out.Printf("  Error rate: %.4f%%\n", errorSum.ErrorRate)
+	}
+}
+
+func printPeerListChanges(out output, summary *PeerRefreshSummary) {
+	if len(summary.Changes) > 0 {
+		out.Printf("Peer list changes:\n")
+		for _, c := range summary.Changes {
+			out.Printf("  %v: %v peers\n", c.Elapsed, c.TotalPeers)
+			for _, peer := range c.Added {
+				out.Printf("    + %v\n", peer)
+			}
+			for _, peer := range c.Removed {
+				out.Printf("    - %v\n", peer)
+			}
+		}
+	}
+
+	out.Printf("Connections by peer:\n")
+	for _, peer := range sorted.MapKeys(summary.Connections) {
+		out.Printf("  %v: %v\n", peer, summary.Connections[peer])
+	}
+}
+
 func printErrors(out output, errorSum *ErrorSummary) {
 	if errorSum == nil {
 		return
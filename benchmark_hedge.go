@@ -0,0 +1,309 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+)
+
+const (
+	// _hedgeMinSamples is the number of latencies that must be observed
+	// before requests are hedged using a percentile delay. The delay is
+	// recomputed each time this many more latencies are observed.
+	_hedgeMinSamples = 100
+
+	// _hedgeWindow is the number of recent latencies used to compute a
+	// percentile delay.
+	_hedgeWindow = 1000
+)
+
+// hedgeDelay decides how long to wait before hedging a request, either a
+// fixed delay or a percentile of the latencies of unhedged requests.
+type hedgeDelay struct {
+	fixed      time.Duration
+	percentile float64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	observed  int
+	current   time.Duration
+	ready     bool
+}
+
+// parseHedgeDelay parses a fixed delay such as "20ms", or a percentile such
+// as "p95" or "p99.9".
+func parseHedgeDelay(s string) (*hedgeDelay, error) {
+	if strings.HasPrefix(s, "p") {
+		p, err := strconv.ParseFloat(s[1:], 64)
+		if err != nil || p <= 0 || p >= 100 {
+			return nil, fmt.Errorf("invalid hedge delay %q, percentile must be between p0 and p100", s)
+		}
+		return &hedgeDelay{percentile: p / 100}, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hedge delay %q, must be a duration or a percentile such as p95", s)
+	}
+	if d < 0 {
+		return nil, fmt.Errorf("invalid hedge delay %q, cannot be negative", s)
+	}
+	return &hedgeDelay{fixed: d}, nil
+}
+
+// get returns the delay before a request is hedged, and false if requests
+// should not be hedged yet.
+func (d *hedgeDelay) get() (time.Duration, bool) {
+	if d.percentile == 0 {
+		return d.fixed, true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.current, d.ready
+}
+
+// observe records the latency of a request that was sent without waiting
+// for a hedge, which is used to compute percentile delays.
+func (d *hedgeDelay) observe(latency time.Duration) {
+	if d.percentile == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.latencies) < _hedgeWindow {
+		d.latencies = append(d.latencies, latency)
+	} else {
+		d.latencies[d.observed%_hedgeWindow] = latency
+	}
+	d.observed++
+	if d.observed%_hedgeMinSamples != 0 {
+		return
+	}
+
+	sorted := make([]time.Duration, len(d.latencies))
+	copy(sorted, d.latencies)
+	sort.Sort(byDuration(sorted))
+	d.current = getQuantile(sorted, d.percentile)
+	d.ready = true
+}
+
+// hedgedCaller is a benchmarkCaller that sends a duplicate request using
+// the hedge transport, which is connected to a different peer, if a request
+// hasn't completed after the delay. The first successful response wins.
+type hedgedCaller struct {
+	benchmarkCaller
+
+	hedge    transport.Transport
+	delay    *hedgeDelay
+	unhedged *unhedgedLatencies
+}
+
+type hedgeResult struct {
+	report benchmarkCallReporter
+	err    error
+
+	// done is the time from the start of the request until the call
+	// completed, including any time waiting to hedge.
+	done time.Duration
+}
+
+func (c hedgedCaller) Call(ctx context.Context, t transport.Transport) (benchmarkCallReporter, error) {
+	delay, ok := c.delay.get()
+	if !ok {
+		report, err := c.benchmarkCaller.Call(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		c.delay.observe(report.Latency())
+		return newHedgeCallReport(report, report.Latency()), nil
+	}
+
+	start := time.Now()
+	call := func(ctx context.Context, t transport.Transport, results chan<- hedgeResult) {
+		report, err := c.benchmarkCaller.Call(ctx, t)
+		results <- hedgeResult{report, err, time.Since(start)}
+	}
+
+	primaryResults := make(chan hedgeResult, 1)
+	go call(ctx, t, primaryResults)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case primary := <-primaryResults:
+		if primary.err != nil {
+			return nil, primary.err
+		}
+		c.delay.observe(primary.report.Latency())
+		return newHedgeCallReport(primary.report, primary.report.Latency()), nil
+	case <-timer.C:
+	}
+
+	// The hedge is cancelled if the primary request wins, but the primary
+	// request is never cancelled so its latency without hedging is known.
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+	defer cancelHedge()
+	hedgeResults := make(chan hedgeResult, 1)
+	go call(hedgeCtx, c.hedge, hedgeResults)
+
+	var primary, hedge *hedgeResult
+	for primary == nil || hedge == nil {
+		select {
+		case r := <-primaryResults:
+			primary = &r
+			if r.err == nil {
+				c.delay.observe(r.done)
+				report := newHedgeCallReport(r.report, r.done)
+				report.hedged = true
+				return report, nil
+			}
+		case r := <-hedgeResults:
+			hedge = &r
+			if r.err == nil {
+				if primary == nil {
+					// The primary request's latency is recorded once it
+					// completes, without holding up the caller.
+					c.unhedged.recordLater(primaryResults, c.delay)
+				}
+				report := newHedgeCallReport(r.report, r.done)
+				report.hedged = true
+				report.hedgeWon = true
+				report.hasUnhedged = false
+				return report, nil
+			}
+		}
+	}
+
+	// Both requests failed.
+	return nil, primary.err
+}
+
+func (c hedgedCaller) CallMethodType() encoding.MethodType {
+	return encoding.Unary
+}
+
+// benchmarkHedgedCallReporter exposes the result of a hedged benchmark call.
+type benchmarkHedgedCallReporter interface {
+	// Hedged returns whether a hedge request was sent.
+	Hedged() bool
+
+	// HedgeWon returns whether the hedge request completed first.
+	HedgeWon() bool
+
+	// UnhedgedLatency returns the latency of the request without hedging,
+	// and false if it's not known when the call completes, because the
+	// request failed or is recorded once it completes.
+	UnhedgedLatency() (time.Duration, bool)
+}
+
+type hedgeCallReport struct {
+	latency         time.Duration
+	traceID         string
+	hedged          bool
+	hedgeWon        bool
+	unhedgedLatency time.Duration
+	hasUnhedged     bool
+}
+
+func newHedgeCallReport(r benchmarkCallReporter, latency time.Duration) hedgeCallReport {
+	report := hedgeCallReport{latency: latency, unhedgedLatency: latency, hasUnhedged: true}
+	if traced, ok := r.(benchmarkTracedCallReporter); ok {
+		report.traceID = traced.TraceID()
+	}
+	return report
+}
+
+func (r hedgeCallReport) Latency() time.Duration {
+	return r.latency
+}
+
+func (r hedgeCallReport) TraceID() string {
+	return r.traceID
+}
+
+func (r hedgeCallReport) Hedged() bool {
+	return r.hedged
+}
+
+func (r hedgeCallReport) HedgeWon() bool {
+	return r.hedgeWon
+}
+
+func (r hedgeCallReport) UnhedgedLatency() (time.Duration, bool) {
+	return r.unhedgedLatency, r.hasUnhedged
+}
+
+// unhedgedLatencies records the latencies of primary requests that complete
+// after their hedge has won.
+type unhedgedLatencies struct {
+	wg sync.WaitGroup
+
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+// recordLater records the latency of the result once it's received, if the
+// request succeeds.
+func (u *unhedgedLatencies) recordLater(results <-chan hedgeResult, delay *hedgeDelay) {
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+
+		r := <-results
+		if r.err != nil {
+			return
+		}
+		delay.observe(r.done)
+
+		u.mu.Lock()
+		u.latencies = append(u.latencies, r.done)
+		u.mu.Unlock()
+	}()
+}
+
+// wait waits for all pending requests to complete, and returns the
+// recorded latencies.
+func (u *unhedgedLatencies) wait() []time.Duration {
+	u.wg.Wait()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.latencies
+}
+
+// hedgePeer returns the index of the peer used to hedge requests to the
+// given peer, which is the next peer in the list.
+func hedgePeer(peer, numPeers int) int {
+	return (peer + 1) % numPeers
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// delayTransport is used with delayCaller to simulate a call that takes
+// latency and then fails with err.
+type delayTransport struct {
+	latency time.Duration
+	err     error
+
+	cancelled atomic.Bool
+}
+
+func (t *delayTransport) Call(ctx context.Context, r *transport.Request) (*transport.Response, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (t *delayTransport) Protocol() transport.Protocol { return transport.TChannel }
+
+func (t *delayTransport) Tracer() opentracing.Tracer { return nil }
+
+type delayCaller struct{}
+
+func (delayCaller) Call(ctx context.Context, t transport.Transport) (benchmarkCallReporter, error) {
+	dt := t.(*delayTransport)
+	select {
+	case <-time.After(dt.latency):
+		return newBenchmarkCallLatencyReport(dt.latency), dt.err
+	case <-ctx.Done():
+		dt.cancelled.Store(true)
+		return nil, ctx.Err()
+	}
+}
+
+func (delayCaller) CallMethodType() encoding.MethodType {
+	return encoding.Unary
+}
+
+func TestParseHedgeDelay(t *testing.T) {
+	tests := []struct {
+		delay          string
+		wantFixed      time.Duration
+		wantPercentile float64
+		wantErr        string
+	}{
+		{delay: "20ms", wantFixed: 20 * time.Millisecond},
+		{delay: "0s", wantFixed: 0},
+		{delay: "p95", wantPercentile: 0.95},
+		{delay: "p99.9", wantPercentile: 0.999},
+		{delay: "-1s", wantErr: "cannot be negative"},
+		{delay: "p0", wantErr: "percentile must be between"},
+		{delay: "p100", wantErr: "percentile must be between"},
+		{delay: "pfast", wantErr: "percentile must be between"},
+		{delay: "soon", wantErr: "must be a duration or a percentile"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseHedgeDelay(tt.delay)
+		if tt.wantErr != "" {
+			require.Error(t, err, "Expected error for %q", tt.delay)
+			assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error for %q", tt.delay)
+			continue
+		}
+
+		require.NoError(t, err, "Unexpected error for %q", tt.delay)
+		assert.Equal(t, tt.wantFixed, got.fixed, "Unexpected delay for %q", tt.delay)
+		assert.InDelta(t, tt.wantPercentile, got.percentile, 1e-9, "Unexpected percentile for %q", tt.delay)
+	}
+}
+
+func TestHedgeDelayPercentile(t *testing.T) {
+	d, err := parseHedgeDelay("p90")
+	require.NoError(t, err)
+
+	_, ok := d.get()
+	assert.False(t, ok, "Requests should not be hedged before latencies are observed")
+
+	for i := 1; i <= _hedgeMinSamples; i++ {
+		_, ok := d.get()
+		assert.False(t, ok, "Requests should not be hedged after %v latencies", i-1)
+		d.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	got, ok := d.get()
+	require.True(t, ok, "Requests should be hedged once enough latencies are observed")
+	assert.InDelta(t, 90*time.Millisecond, got, float64(time.Millisecond), "Unexpected delay")
+
+	// Only recent latencies are used for the delay.
+	for i := 0; i < _hedgeWindow; i++ {
+		d.observe(time.Second)
+	}
+	got, _ = d.get()
+	assert.Equal(t, time.Second, got, "Unexpected delay after latencies change")
+	assert.Len(t, d.latencies, _hedgeWindow, "Latencies should be bounded")
+}
+
+func TestHedgedCaller(t *testing.T) {
+	var (
+		fast    = delayTransport{latency: time.Millisecond}
+		slow    = delayTransport{latency: 500 * time.Millisecond}
+		failed  = delayTransport{latency: 200 * time.Millisecond, err: errors.New("failed")}
+		failing = delayTransport{err: errors.New("fail fast")}
+	)
+
+	tests := []struct {
+		msg          string
+		delay        string
+		primary      delayTransport
+		hedge        delayTransport
+		wantErr      string
+		wantHedged   bool
+		wantWon      bool
+		wantUnhedged bool
+		wantLater    bool
+		wantCancel   bool
+		wantMax      time.Duration
+	}{
+		{
+			msg:          "completes before delay",
+			delay:        "1s",
+			primary:      fast,
+			hedge:        slow,
+			wantUnhedged: true,
+			wantMax:      250 * time.Millisecond,
+		},
+		{
+			msg:     "fails before delay",
+			delay:   "100ms",
+			primary: failing,
+			hedge:   fast,
+			wantErr: "fail fast",
+		},
+		{
+			msg:        "hedge wins",
+			delay:      "10ms",
+			primary:    slow,
+			hedge:      fast,
+			wantHedged: true,
+			wantWon:    true,
+			wantLater:  true,
+			wantMax:    250 * time.Millisecond,
+		},
+		{
+			msg:          "primary wins after hedging",
+			delay:        "0s",
+			primary:      fast,
+			hedge:        slow,
+			wantHedged:   true,
+			wantUnhedged: true,
+			wantCancel:   true,
+			wantMax:      250 * time.Millisecond,
+		},
+		{
+			msg:        "hedge succeeds after primary fails",
+			delay:      "10ms",
+			primary:    failed,
+			hedge:      fast,
+			wantHedged: true,
+			wantWon:    true,
+			wantMax:    100 * time.Millisecond,
+		},
+		{
+			msg:     "both fail",
+			delay:   "10ms",
+			primary: failed,
+			hedge:   failed,
+			wantErr: "failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			delay, err := parseHedgeDelay(tt.delay)
+			require.NoError(t, err)
+
+			primary := &delayTransport{latency: tt.primary.latency, err: tt.primary.err}
+			hedge := &delayTransport{latency: tt.hedge.latency, err: tt.hedge.err}
+			unhedged := &unhedgedLatencies{}
+			c := hedgedCaller{benchmarkCaller: delayCaller{}, hedge: hedge, delay: delay, unhedged: unhedged}
+
+			start := time.Now()
+			report, err := c.Call(context.Background(), primary)
+			elapsed := time.Since(start)
+			later := unhedged.wait()
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			hedged, ok := report.(benchmarkHedgedCallReporter)
+			require.True(t, ok, "Expected hedged call report")
+			assert.Equal(t, tt.wantHedged, hedged.Hedged(), "Unexpected hedge")
+			assert.Equal(t, tt.wantWon, hedged.HedgeWon(), "Unexpected hedge win")
+			assert.True(t, report.Latency() < tt.wantMax, "Latency %v should be less than %v", report.Latency(), tt.wantMax)
+			assert.True(t, elapsed < tt.wantMax, "Call should return after %v, took %v", tt.wantMax, elapsed)
+			if tt.wantCancel {
+				assert.Eventually(t, hedge.cancelled.Load, time.Second, time.Millisecond, "Hedge should be cancelled")
+			} else {
+				assert.False(t, hedge.cancelled.Load(), "Hedge should not be cancelled")
+			}
+			assert.False(t, primary.cancelled.Load(), "Primary request should not be cancelled")
+
+			unhedgedLatency, ok := hedged.UnhedgedLatency()
+			assert.Equal(t, tt.wantUnhedged, ok, "Unexpected unhedged latency")
+			if ok {
+				assert.True(t, unhedgedLatency >= tt.primary.latency, "Unhedged latency %v should include the primary latency", unhedgedLatency)
+			}
+
+			if !tt.wantLater {
+				assert.Empty(t, later, "Unexpected unhedged latencies recorded later")
+				return
+			}
+			require.Len(t, later, 1, "Expected unhedged latency recorded later")
+			assert.True(t, later[0] >= tt.primary.latency, "Unhedged latency %v should include the primary latency", later[0])
+		})
+	}
+}
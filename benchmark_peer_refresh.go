@@ -0,0 +1,460 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/yarpc/yab/internal/httpclient"
+	"github.com/yarpc/yab/limiter"
+	"github.com/yarpc/yab/peerprovider"
+	"github.com/yarpc/yab/sorted"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+)
+
+var errRefreshedPeerListEmpty = errors.New("refreshed peer list is empty")
+
+// refreshConnTransport is a transport used by a refreshingConn, which counts
+// the calls in flight so it can be drained before it's closed.
+type refreshConnTransport struct {
+	transport.Transport
+
+	peer                   string
+	wireSent, wireReceived int64
+	inflight               sync.WaitGroup
+}
+
+func newRefreshConnTransport(t transport.Transport, peer string) *refreshConnTransport {
+	rt := &refreshConnTransport{Transport: t, peer: peer}
+	rt.wireSent, rt.wireReceived, _ = wireBytes(t)
+	return rt
+}
+
+// wireBytes returns the bytes on the wire since the transport was created,
+// which excludes any warmup requests.
+func (t *refreshConnTransport) wireBytes() (sent, received int64, ok bool) {
+	sent, received, ok = wireBytes(t.Transport)
+	return sent - t.wireSent, received - t.wireReceived, ok
+}
+
+// refreshingConn is a benchmark connection whose transport is replaced when
+// its peer is removed from the peer list, or when it's moved to a new peer.
+type refreshingConn struct {
+	mu  sync.Mutex
+	cur *refreshConnTransport
+}
+
+// acquire returns the current transport, which must be released by calling
+// inflight.Done once the call is complete.
+func (c *refreshingConn) acquire() *refreshConnTransport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cur.inflight.Add(1)
+	return c.cur
+}
+
+func (c *refreshingConn) peer() string {
+	return c.current().peer
+}
+
+// current returns the current transport without acquiring it.
+func (c *refreshingConn) current() *refreshConnTransport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cur
+}
+
+// swap replaces the current transport and returns the previous one. No new
+// calls are made using the previous transport once swap returns.
+func (c *refreshingConn) swap(t *refreshConnTransport) *refreshConnTransport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.cur
+	c.cur = t
+	return prev
+}
+
+// runRefreshingWorker is like runWorker, but uses the current transport of
+// the connection for each call.
+func runRefreshingWorker(c *refreshingConn, b benchmarkCaller, s *benchmarkState, run *limiter.Run, logger *zap.Logger) {
+	for cur := run; cur.More(); {
+		t := c.acquire()
+		makeBenchmarkCall(t.Transport, b, s, logger)
+		t.inflight.Done()
+	}
+}
+
+// peerRefresher periodically resolves the peer list during a benchmark. When
+// peers are added or removed, connections are moved so they're assigned to
+// the current peers using the benchmark peer strategy, and the connections
+// to previous peers are drained.
+type peerRefresher struct {
+	peerList *url.URL
+	interval time.Duration
+	timeout  time.Duration
+	protocol transport.Protocol
+	logger   *zap.Logger
+
+	// connect creates a new connection to the given peer.
+	connect func(peer string) (transport.Transport, error)
+
+	// choose filters and samples the refreshed peers, preferring the
+	// current peers when sampling.
+	choose func(peers []peerprovider.Peer, prefer []string) ([]peerprovider.Peer, error)
+
+	// assign returns the number of connections to assign to each peer.
+	assign func(peers []string, weights []int) (map[string]int, error)
+
+	conns   []*refreshingConn
+	peers   []string
+	targets map[string]int
+	start   time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	drains sync.WaitGroup
+
+	// mu guards the summary and wire bytes, which are updated when
+	// connections are moved and drained.
+	mu           sync.Mutex
+	summary      PeerRefreshSummary
+	wireSent     int64
+	wireReceived int64
+	countsWire   bool
+}
+
+// newPeerRefresher returns a peerRefresher for the warmed up connections,
+// which are now used by refreshing connections.
+func newPeerRefresher(allOpts Options, resolved resolvedProtocolEncoding, tracer opentracing.Tracer, connections []peerTransport, logger *zap.Logger) (*peerRefresher, error) {
+	u, err := url.Parse(allOpts.TOpts.ResolvedPeerList)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol, err := peersProtocol(allOpts.TOpts.Peers, resolved.protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := allOpts.TOpts.providerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &peerRefresher{
+		peerList: u,
+		interval: allOpts.BOpts.PeerRefresh,
+		timeout:  allOpts.TOpts.peerListTimeout(),
+		protocol: protocol,
+		logger:   logger,
+		peers:    allOpts.TOpts.Peers,
+		conns:    make([]*refreshingConn, len(connections)),
+		done:     make(chan struct{}),
+	}
+	r.ctx, r.cancel = context.WithCancel(httpclient.WithClient(context.Background(), client))
+	r.connect = func(peer string) (transport.Transport, error) {
+		tOpts := allOpts.TOpts
+		tOpts.Peers = []string{peer}
+		tOpts.PeerWeights = nil
+		return connectTransport(tOpts, resolved, tracer, allOpts.ROpts.Timeout.Duration())
+	}
+	r.choose = func(peers []peerprovider.Peer, prefer []string) ([]peerprovider.Peer, error) {
+		return selectPeers(peers, allOpts.TOpts, prefer)
+	}
+	r.assign = func(peers []string, weights []int) (map[string]int, error) {
+		tOpts := allOpts.TOpts
+		tOpts.Peers = peers
+		tOpts.PeerWeights = weights
+		return connectionCounts(len(connections), tOpts)
+	}
+
+	r.targets = make(map[string]int)
+	for i, c := range connections {
+		peer := allOpts.TOpts.Peers[c.peerID]
+		r.conns[i] = &refreshingConn{cur: newRefreshConnTransport(c.Transport, peer)}
+		r.targets[peer]++
+	}
+	return r, nil
+}
+
+// connectionCounts returns the number of n benchmark connections that are
+// assigned to each peer.
+func connectionCounts(n int, tOpts TransportOptions) (map[string]int, error) {
+	peers, err := connectionPeers(n, tOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, peerIndex := range peers {
+		counts[tOpts.Peers[peerIndex]]++
+	}
+	return counts, nil
+}
+
+// run refreshes the peer list every interval, starting the benchmark clock
+// used to report when changes happened.
+func (r *peerRefresher) run(start time.Time) {
+	r.start = start
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+				r.refresh()
+			}
+		}
+	}()
+}
+
+// close stops refreshing the peer list, cancelling any refresh in progress,
+// and waits for previous connections to be drained. It must be called after
+// the workers have stopped.
+func (r *peerRefresher) close() {
+	r.cancel()
+	<-r.done
+	r.drains.Wait()
+}
+
+func (r *peerRefresher) refresh() {
+	peers, err := r.resolve()
+	if r.ctx.Err() != nil {
+		// The benchmark ended during the refresh.
+		return
+	}
+	if err == nil {
+		err = r.update(splitPeerWeights(peers))
+	}
+
+	r.mu.Lock()
+	r.summary.TotalRefreshes++
+	if err != nil {
+		r.summary.FailedRefreshes++
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		r.logger.Warn("Failed to refresh peer list.", zap.Error(err))
+	}
+
+	// Connections that failed to move in a previous refresh are retried,
+	// even if the peer list hasn't changed since.
+	r.rebalance()
+}
+
+// update sets the peers and the number of connections to assign to each
+// peer, recording the change if peers were added or removed. Changes to the
+// weights of the current peers don't move connections.
+func (r *peerRefresher) update(peers []string, weights []int) error {
+	added, removed := diffPeers(r.peers, peers)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	targets, err := r.assign(peers, weights)
+	if err != nil {
+		return err
+	}
+
+	r.logger.Info("Peer list changed.", zap.Strings("added", added), zap.Strings("removed", removed))
+	r.mu.Lock()
+	r.summary.Changes = append(r.summary.Changes, PeerListChange{
+		Elapsed:    time.Since(r.start).Round(time.Millisecond).String(),
+		Added:      added,
+		Removed:    removed,
+		TotalPeers: len(peers),
+	})
+	r.mu.Unlock()
+
+	r.peers = peers
+	r.targets = targets
+	return nil
+}
+
+// resolve returns the peers in the peer list that can be called using the
+// benchmark's protocol, filtered and sampled like the initial peers. Peers
+// are resolved using the peer list timeout, capped at the refresh interval
+// so a slow peer provider doesn't delay the next refresh.
+func (r *peerRefresher) resolve() ([]peerprovider.Peer, error) {
+	timeout := r.timeout
+	if timeout <= 0 || timeout > r.interval {
+		timeout = r.interval
+	}
+	ctx, cancel := context.WithTimeout(r.ctx, timeout)
+	defer cancel()
+
+	resolved, err := peerprovider.ResolvePeers(ctx, r.peerList)
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []peerprovider.Peer
+	for _, peer := range resolved {
+		if p, _ := peersProtocol([]string{peer.HostPort}, r.protocol); p != r.protocol {
+			r.logger.Warn("Ignoring refreshed peer that uses a different protocol.",
+				zap.String("peer", peer.HostPort), zap.Stringer("protocol", p))
+			continue
+		}
+		peers = append(peers, peer)
+	}
+
+	if len(peers) == 0 {
+		return nil, errRefreshedPeerListEmpty
+	}
+	return r.choose(peers, r.peers)
+}
+
+// rebalance moves as few connections as possible so that the number of
+// connections to each peer matches the targets.
+func (r *peerRefresher) rebalance() {
+	counts := make(map[string]int)
+	var moves []*refreshingConn
+	for _, c := range r.conns {
+		peer := c.peer()
+		if counts[peer] < r.targets[peer] {
+			counts[peer]++
+			continue
+		}
+		moves = append(moves, c)
+	}
+
+	var wg sync.WaitGroup
+	for _, peer := range r.peers {
+		for counts[peer] < r.targets[peer] && len(moves) > 0 {
+			counts[peer]++
+			wg.Add(1)
+			go func(c *refreshingConn, peer string) {
+				defer wg.Done()
+				r.move(c, peer)
+			}(moves[0], peer)
+			moves = moves[1:]
+		}
+	}
+	wg.Wait()
+}
+
+// move connects to the peer and replaces the connection's transport, which
+// is closed once its calls in flight are complete. If the connection fails,
+// the current transport is used until the next refresh.
+func (r *peerRefresher) move(c *refreshingConn, peer string) {
+	t, err := r.connect(peer)
+	if err != nil {
+		r.mu.Lock()
+		r.summary.FailedConnections++
+		r.mu.Unlock()
+		r.logger.Warn("Failed to connect to refreshed peer.", zap.String("peer", peer), zap.Error(err))
+		return
+	}
+
+	prev := c.swap(newRefreshConnTransport(t, peer))
+
+	r.drains.Add(1)
+	go func() {
+		defer r.drains.Done()
+
+		prev.inflight.Wait()
+		r.recordWireBytes(prev)
+		closeTransport(prev.Transport)
+	}()
+
+	r.mu.Lock()
+	r.summary.ConnectionsMoved++
+	r.mu.Unlock()
+}
+
+func (r *peerRefresher) recordWireBytes(t *refreshConnTransport) {
+	sent, received, ok := t.wireBytes()
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.countsWire = true
+	r.wireSent += sent
+	r.wireReceived += received
+}
+
+// mergeWireBytes records the bytes on the wire of current and drained
+// connections in the benchmark state.
+func (r *peerRefresher) mergeWireBytes(s *benchmarkState) {
+	for _, c := range r.conns {
+		r.recordWireBytes(c.current())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.countsWire {
+		s.recordWireBytes(r.wireSent, r.wireReceived)
+	}
+}
+
+// getSummary returns the summary of refreshes, with the final number of
+// connections to each peer.
+func (r *peerRefresher) getSummary() *PeerRefreshSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summary := r.summary
+	summary.Connections = make(map[string]int)
+	for _, c := range r.conns {
+		summary.Connections[c.peer()]++
+	}
+	return &summary
+}
+
+// diffPeers returns the peers that were added and removed, in sorted order.
+func diffPeers(prev, cur []string) (added, removed []string) {
+	prevSet := make(map[string]struct{}, len(prev))
+	for _, p := range prev {
+		prevSet[p] = struct{}{}
+	}
+
+	addedSet := make(map[string]struct{})
+	for _, p := range cur {
+		if _, ok := prevSet[p]; !ok {
+			addedSet[p] = struct{}{}
+		}
+		delete(prevSet, p)
+	}
+
+	// Any peers left in the previous set were removed.
+	return sorted.MapKeys(addedSet), sorted.MapKeys(prevSet)
+}
@@ -0,0 +1,399 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/limiter"
+	"github.com/yarpc/yab/statsd"
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// writePeerList replaces the peer list file, so it's never read while it's
+// partially written.
+func writePeerList(t *testing.T, path string, peers ...string) {
+	var contents []byte
+	for _, peer := range peers {
+		contents = append(contents, peer+"\n"...)
+	}
+
+	tmp := path + ".tmp"
+	require.NoError(t, ioutil.WriteFile(tmp, contents, 0644), "failed to write peer list")
+	require.NoError(t, os.Rename(tmp, path), "failed to replace peer list")
+}
+
+func TestBenchmarkPeerRefresh(t *testing.T) {
+	var removedCalls, addedCalls atomic.Int32
+	removed := newServer(t)
+	defer removed.shutdown()
+	removed.register(fooMethod, methods.errorIf(func() bool {
+		removedCalls.Inc()
+		return false
+	}))
+
+	added := newServer(t)
+	defer added.shutdown()
+	added.register(fooMethod, methods.errorIf(func() bool {
+		addedCalls.Inc()
+		return false
+	}))
+
+	peerList := filepath.Join(t.TempDir(), "peers.txt")
+	writePeerList(t, peerList, removed.hostPort())
+
+	// Replace the peer once the benchmark is making calls.
+	go func() {
+		for removedCalls.Load() < 20 {
+			time.Sleep(time.Millisecond)
+		}
+		writePeerList(t, peerList, added.hostPort())
+	}()
+
+	tOpts := removed.transportOpts()
+	tOpts.ResolvedPeerList = peerList
+
+	buf, _, out := getOutput(t)
+	m := benchmarkMethodForTest(t, fooMethod, transport.TChannel)
+	runBenchmark(out, _testLogger, Options{
+		BOpts: BenchmarkOptions{
+			MaxDuration:    time.Second,
+			RPS:            500,
+			Connections:    2,
+			Concurrency:    2,
+			WarmupRequests: 1,
+			PeerRefresh:    20 * time.Millisecond,
+			Format:         "json",
+		},
+		TOpts: tOpts,
+	}, _resolvedTChannelThrift, fooMethod, m)
+
+	var benchmarkOutput BenchmarkOutput
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &benchmarkOutput))
+	assert.Equal(t, "20ms", benchmarkOutput.Parameters.PeerRefresh)
+	assert.Nil(t, benchmarkOutput.ErrorSummary, "Draining connections should not cause errors")
+
+	summary := benchmarkOutput.PeerRefreshSummary
+	require.NotNil(t, summary, "Missing peer refresh summary")
+	assert.NotZero(t, summary.TotalRefreshes, "Peer list should be refreshed")
+	assert.Equal(t, 2, summary.ConnectionsMoved, "Both connections should move to the added peer")
+	assert.Zero(t, summary.FailedConnections)
+	assert.Equal(t, map[string]int{added.hostPort(): 2}, summary.Connections)
+
+	require.Len(t, summary.Changes, 1, "Expected a single peer list change")
+	change := summary.Changes[0]
+	assert.Equal(t, []string{added.hostPort()}, change.Added)
+	assert.Equal(t, []string{removed.hostPort()}, change.Removed)
+	assert.Equal(t, 1, change.TotalPeers)
+
+	assert.NotZero(t, addedCalls.Load(), "Added peer should be called")
+}
+
+func TestBenchmarkPeerRefreshRequiresPeerList(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	var fatalMessage string
+	out := &testOutput{
+		fatalf: func(msg string, args ...interface{}) {
+			fatalMessage = fmt.Sprintf(msg, args...)
+		},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m := benchmarkMethodForTest(t, fooMethod, transport.TChannel)
+		runBenchmark(out, _testLogger, Options{
+			BOpts: BenchmarkOptions{MaxRequests: 1, PeerRefresh: time.Second, Format: "json"},
+			TOpts: s.transportOpts(),
+		}, _resolvedTChannelThrift, fooMethod, m)
+	}()
+	wg.Wait()
+	assert.Contains(t, fatalMessage, "Peer refresh requires a peer list")
+}
+
+// newTestPeerRefresher returns a peerRefresher for connections to the given
+// peers, which creates delayTransports when connections are moved.
+func newTestPeerRefresher(peers []string, connPeers ...string) *peerRefresher {
+	r := &peerRefresher{
+		interval: time.Second,
+		logger:   _testLogger,
+		peers:    peers,
+		targets:  make(map[string]int),
+		connect: func(peer string) (transport.Transport, error) {
+			if peer == "unreachable:1" {
+				return nil, errors.New("connection refused")
+			}
+			return &delayTransport{}, nil
+		},
+		assign: func(peers []string, weights []int) (map[string]int, error) {
+			return connectionCounts(len(connPeers), TransportOptions{Peers: peers, PeerWeights: weights})
+		},
+	}
+	for _, peer := range connPeers {
+		r.conns = append(r.conns, &refreshingConn{cur: newRefreshConnTransport(&delayTransport{}, peer)})
+		r.targets[peer]++
+	}
+	return r
+}
+
+func TestPeerRefresherUpdate(t *testing.T) {
+	tests := []struct {
+		msg        string
+		connPeers  []string
+		peers      []string
+		weights    []int
+		wantChange bool
+		wantConns  map[string]int
+		wantMoved  int
+		wantFailed int
+	}{
+		{
+			msg:       "unchanged",
+			connPeers: []string{"a:1", "b:1", "a:1", "b:1"},
+			peers:     []string{"a:1", "b:1"},
+			wantConns: map[string]int{"a:1": 2, "b:1": 2},
+		},
+		{
+			msg:        "peer added",
+			connPeers:  []string{"a:1", "a:1", "b:1", "b:1"},
+			peers:      []string{"a:1", "b:1", "c:1", "d:1"},
+			wantChange: true,
+			wantConns:  map[string]int{"a:1": 1, "b:1": 1, "c:1": 1, "d:1": 1},
+			wantMoved:  2,
+		},
+		{
+			msg:        "peer removed",
+			connPeers:  []string{"a:1", "b:1", "c:1", "a:1", "b:1", "c:1"},
+			peers:      []string{"a:1", "b:1"},
+			wantChange: true,
+			wantConns:  map[string]int{"a:1": 3, "b:1": 3},
+			wantMoved:  2,
+		},
+		{
+			msg:        "peer replaced",
+			connPeers:  []string{"a:1", "b:1"},
+			peers:      []string{"a:1", "c:1"},
+			wantChange: true,
+			wantConns:  map[string]int{"a:1": 1, "c:1": 1},
+			wantMoved:  1,
+		},
+		{
+			msg:        "weighted peer added",
+			connPeers:  []string{"a:1", "a:1", "a:1", "a:1"},
+			peers:      []string{"a:1", "b:1"},
+			weights:    []int{1, 3},
+			wantChange: true,
+			wantConns:  map[string]int{"a:1": 1, "b:1": 3},
+			wantMoved:  3,
+		},
+		{
+			msg:        "connection fails",
+			connPeers:  []string{"a:1", "b:1"},
+			peers:      []string{"a:1", "unreachable:1"},
+			wantChange: true,
+			wantConns:  map[string]int{"a:1": 1, "b:1": 1},
+			wantFailed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			r := newTestPeerRefresher(dedupePeers(tt.connPeers), tt.connPeers...)
+			require.NoError(t, r.update(tt.peers, tt.weights))
+			r.rebalance()
+			r.drains.Wait()
+
+			summary := r.getSummary()
+			if tt.wantChange {
+				assert.Len(t, summary.Changes, 1, "Expected peer list change")
+			} else {
+				assert.Empty(t, summary.Changes, "Unexpected peer list change")
+			}
+			assert.Equal(t, tt.wantConns, summary.Connections, "Unexpected connections")
+			assert.Equal(t, tt.wantMoved, summary.ConnectionsMoved, "Unexpected moved connections")
+			assert.Equal(t, tt.wantFailed, summary.FailedConnections, "Unexpected failed connections")
+		})
+	}
+}
+
+func TestPeerRefresherRetriesFailedConnections(t *testing.T) {
+	r := newTestPeerRefresher([]string{"a:1"}, "a:1")
+
+	var connectErr error = errors.New("connection refused")
+	connect := r.connect
+	r.connect = func(peer string) (transport.Transport, error) {
+		if connectErr != nil {
+			return nil, connectErr
+		}
+		return connect(peer)
+	}
+
+	require.NoError(t, r.update([]string{"b:1"}, nil /* weights */))
+	r.rebalance()
+	assert.Equal(t, "a:1", r.conns[0].peer(), "Connection should not move if the new peer is unreachable")
+
+	// The connection is moved once the peer is reachable, even though the
+	// peer list hasn't changed.
+	connectErr = nil
+	r.rebalance()
+	r.drains.Wait()
+	assert.Equal(t, "b:1", r.conns[0].peer(), "Connection should move once the peer is reachable")
+
+	summary := r.getSummary()
+	assert.Equal(t, 1, summary.ConnectionsMoved)
+	assert.Equal(t, 1, summary.FailedConnections)
+}
+
+func TestRefreshingConnDrain(t *testing.T) {
+	prev := &delayTransport{}
+	r := newTestPeerRefresher([]string{"a:1"})
+	c := &refreshingConn{cur: newRefreshConnTransport(prev, "a:1")}
+	r.conns = []*refreshingConn{c}
+
+	inflight := c.acquire()
+	r.move(c, "b:1")
+	cur := c.acquire()
+	cur.inflight.Done()
+	assert.NotSame(t, prev, cur.Transport, "New calls should use the new transport")
+
+	drained := make(chan struct{})
+	go func() {
+		r.drains.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("Connection drained with a call in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	inflight.inflight.Done()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("Connection not drained after the call in flight completed")
+	}
+}
+
+func TestRunRefreshingWorker(t *testing.T) {
+	c := &refreshingConn{cur: newRefreshConnTransport(&delayTransport{}, "a:1")}
+	state := newBenchmarkState(statsd.Noop)
+	run := limiter.New(5 /* maxRequests */, 0 /* rps */, 0 /* maxDuration */)
+
+	runRefreshingWorker(c, delayCaller{}, state, run, _testLogger)
+	assert.Equal(t, 5, state.totalRequests)
+
+	// All calls should be complete, so the transport can be drained.
+	c.cur.inflight.Wait()
+}
+
+func TestDiffPeers(t *testing.T) {
+	tests := []struct {
+		msg         string
+		prev, cur   []string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{
+			msg:  "unchanged",
+			prev: []string{"a:1", "b:1"},
+			cur:  []string{"b:1", "a:1"},
+		},
+		{
+			msg:         "added and removed",
+			prev:        []string{"c:1", "a:1"},
+			cur:         []string{"a:1", "d:1", "b:1"},
+			wantAdded:   []string{"b:1", "d:1"},
+			wantRemoved: []string{"c:1"},
+		},
+		{
+			msg:         "duplicates",
+			prev:        []string{"a:1", "a:1"},
+			cur:         []string{"b:1", "b:1"},
+			wantAdded:   []string{"b:1"},
+			wantRemoved: []string{"a:1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			added, removed := diffPeers(tt.prev, tt.cur)
+			assert.ElementsMatch(t, tt.wantAdded, added, "Unexpected added peers")
+			assert.ElementsMatch(t, tt.wantRemoved, removed, "Unexpected removed peers")
+		})
+	}
+}
+
+func dedupePeers(peers []string) []string {
+	var deduped []string
+	seen := make(map[string]bool)
+	for _, peer := range peers {
+		if !seen[peer] {
+			seen[peer] = true
+			deduped = append(deduped, peer)
+		}
+	}
+	return deduped
+}
+
+func TestBenchmarkOutputPeerRefresh(t *testing.T) {
+	summary := &PeerRefreshSummary{
+		TotalRefreshes:   4,
+		FailedRefreshes:  1,
+		ConnectionsMoved: 2,
+		Changes: []PeerListChange{
+			{Elapsed: "1.5s", Added: []string{"c:1"}, Removed: []string{"a:1"}, TotalPeers: 2},
+		},
+		Connections: map[string]int{"c:1": 2, "b:1": 2},
+	}
+
+	buf, _, out := getOutput(t)
+	outputPlaintext(out, nil, Summary{}, nil, nil, nil, nil, summary, nil, nil, nil)
+	got := buf.String()
+	assert.Contains(t, got, "Peer list changes:\n  1.5s: 2 peers\n    + c:1\n    - a:1\n")
+	assert.Contains(t, got, "Connections by peer:\n  b:1: 2\n  c:1: 2\n")
+	assert.Contains(t, got, "Total peer refreshes:           4\nFailed peer refreshes:          1\nConnections moved:              2\n")
+
+	buf, _, out = getOutput(t)
+	outputJSON(out, Parameters{PeerRefresh: "30s"}, nil, Summary{}, nil, nil, nil, nil, summary, nil, nil, nil)
+
+	var benchmarkOutput BenchmarkOutput
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &benchmarkOutput))
+	assert.Equal(t, "30s", benchmarkOutput.Parameters.PeerRefresh)
+	assert.Equal(t, summary, benchmarkOutput.PeerRefreshSummary)
+}
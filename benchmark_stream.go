@@ -21,6 +21,7 @@
 package main
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -37,11 +38,11 @@ type benchmarkStreamMethod struct {
 }
 
 // Call dispatches stream request on the provided transport.
-func (m benchmarkStreamMethod) Call(t transport.Transport) (benchmarkCallReporter, error) {
+func (m benchmarkStreamMethod) Call(ctx context.Context, t transport.Transport) (benchmarkCallReporter, error) {
 	streamIO := newStreamIOBenchmark(m.streamRequestMessages)
 
 	start := time.Now()
-	err := makeStreamRequest(t, m.streamRequest, m.serializer, streamIO, m.opts)
+	err := makeStreamRequest(ctx, t, m.streamRequest, m.serializer, streamIO, m.opts)
 	callReport := newBenchmarkStreamCallReport(time.Since(start), streamIO.streamMessagesReceived(), streamIO.streamMessagesSent())
 
 	if err != nil {
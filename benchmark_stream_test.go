@@ -21,6 +21,7 @@
 package main
 
 import (
+	"context"
 	"io"
 	"testing"
 	"time"
@@ -116,7 +117,7 @@ func TestBenchmarkMethodWarmTransportGRPCStreams(t *testing.T) {
 				ServiceName: "foo",
 				CallerName:  "test",
 				Peers:       []string{"grpc://" + lis.String()},
-			}, _resolvedGrpcProto, 1)
+			}, _resolvedGrpcProto, opentracing.NoopTracer{}, 1)
 			require.NoError(t, err)
 
 			for i, transport := range transports {
@@ -211,7 +212,7 @@ func TestStreamBenchmarkCallMethod(t *testing.T) {
 				Encoding:  _resolvedGrpcProto.enc.String(),
 			})
 
-			callReport, err := bench.Call(grpcTransport)
+			callReport, err := bench.Call(context.Background(), grpcTransport)
 			require.NoError(t, err)
 
 			streamCallReport, ok := callReport.(benchmarkStreamCallReporter)
@@ -24,13 +24,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/yarpc/yab/limiter"
+	"github.com/yarpc/yab/statsd"
 	"github.com/yarpc/yab/statsd/statsdtest"
 	"github.com/yarpc/yab/transport"
 
+	"github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/uber/tchannel-go/testutils"
@@ -94,6 +98,7 @@ func TestBenchmark(t *testing.T) {
 
 		bufStr := buf.String()
 		assert.Contains(t, bufStr, "Max RPS")
+		assert.Contains(t, bufStr, "Peer strategy:   round-robin")
 		assert.NotContains(t, bufStr, "Errors")
 
 		if tt.want != 0 {
@@ -128,6 +133,81 @@ func TestRunBenchmarkErrors(t *testing.T) {
 			},
 			wantErr: "duration cannot be negative",
 		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests:    1,
+				ReconnectEvery: -1,
+			},
+			wantErr: "reconnect-every cannot be negative",
+		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests:     1,
+				TraceSampleRate: 1.5,
+			},
+			wantErr: "trace sample rate must be between 0 and 1",
+		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests: 1,
+				Arrival:     "gaussian",
+			},
+			wantErr: `unknown arrival "gaussian"`,
+		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests: 1,
+				Arrival:     "poisson",
+				Burst:       10,
+			},
+			wantErr: "burst can only be used with the burst arrival",
+		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests: 1,
+				Hedge:       "soon",
+			},
+			wantErr: `invalid hedge delay "soon"`,
+		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests:    1,
+				Hedge:          "p95",
+				ReconnectEvery: 1,
+			},
+			wantErr: "hedging cannot be used with reconnect-every",
+		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests: 1,
+				PeerRefresh: -time.Second,
+			},
+			wantErr: "peer-refresh cannot be negative",
+		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests:    1,
+				PeerRefresh:    time.Second,
+				ReconnectEvery: 1,
+			},
+			wantErr: "peer-refresh cannot be used with reconnect-every",
+		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests: 1,
+				PeerRefresh: time.Second,
+				Hedge:       "p95",
+			},
+			wantErr: "peer-refresh cannot be used with hedging",
+		},
+		{
+			opts: BenchmarkOptions{
+				MaxRequests:  1,
+				PeerRefresh:  time.Second,
+				PerPeerStats: true,
+			},
+			wantErr: "peer-refresh cannot be used with per-peer-stats",
+		},
 	}
 
 	for _, tt := range tests {
@@ -236,7 +316,7 @@ func TestBenchmarkOutput(t *testing.T) {
 			format:        []string{"json", "JSON", "Json", "jsON", "jsoN"},
 			wantJSON:      true,
 			wantWarn:      "",
-			wantOutput:    []string{"summary", "benchmarkParameters", "maxRPS", "latencies"},
+			wantOutput:    []string{"summary", "benchmarkParameters", "maxRPS", `"peerStrategy": "round-robin"`, "latencies"},
 			notWantOutput: []string{"Errors", "Benchmark parameters", "Max RPS", "Unrecognized format option"},
 		},
 		{
@@ -387,3 +467,300 @@ func TestBenchmarkErrorsOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestBenchmarkReconnect(t *testing.T) {
+	var requests atomic.Int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool {
+		requests.Inc()
+		return false
+	}))
+	m := benchmarkMethodForTest(t, fooMethod, transport.TChannel)
+
+	tests := []struct {
+		format     string
+		wantOutput []string
+		noErrors   string
+	}{
+		{
+			format:     "text",
+			wantOutput: []string{"Reconnect every: 2 requests", "Connect latencies:", "Total connections:              5", "Total connect errors:           0"},
+			noErrors:   "Errors",
+		},
+		{
+			format:     "json",
+			wantOutput: []string{`"reconnectEvery": 2`, "connectSummary", `"totalConnections": 5`, `"totalErrors": 0`},
+			noErrors:   "errorSummary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			requests.Store(0)
+			buf, _, out := getOutput(t)
+			runBenchmark(out, _testLogger, Options{
+				BOpts: BenchmarkOptions{
+					MaxRequests:    10,
+					Connections:    1,
+					Concurrency:    1,
+					ReconnectEvery: 2,
+					Format:         tt.format,
+				},
+				TOpts: s.transportOpts(),
+			}, _resolvedTChannelThrift, fooMethod, m)
+
+			bufStr := buf.String()
+			for _, want := range tt.wantOutput {
+				assert.Contains(t, bufStr, want)
+			}
+			assert.NotContains(t, bufStr, tt.noErrors)
+			assert.EqualValues(t, 10, requests.Load(), "Unexpected number of requests")
+		})
+	}
+}
+
+func TestBenchmarkReconnectFailure(t *testing.T) {
+	s := newServer(t)
+	s.register(fooMethod, methods.echo())
+	m := benchmarkMethodForTest(t, fooMethod, transport.TChannel)
+
+	tOpts := s.transportOpts()
+	s.shutdown()
+
+	b := newBenchmarkState(statsd.Noop)
+	run := limiter.New(3 /* maxRequests */, 0 /* rps */, 0 /* maxDuration */)
+	connect := func() (transport.Transport, error) {
+		return connectTransport(tOpts, _resolvedTChannelThrift, opentracing.NoopTracer{}, time.Second)
+	}
+	runReconnectingWorker(connect, 1, m, b, run, _testLogger)
+
+	assert.Equal(t, maxConnectAttempts, b.totalConnectErrors, "Each failed connection should be a connect error")
+	assert.Len(t, b.connectErrors, 1, "Connect errors should be grouped by message")
+	assert.Zero(t, b.totalErrors, "Failed connections should not be call errors")
+	assert.Zero(t, b.totalRequests, "Failed connections should not be requests")
+	assert.Empty(t, b.connectLatencies, "No connections should be recorded")
+	assert.True(t, run.More(), "Failed connections should not use up requests")
+}
+
+func TestBenchmarkOutputSlowestTraces(t *testing.T) {
+	traces := []SampledTrace{
+		{TraceID: "abc", Latency: "5ms"},
+		{TraceID: "def", Latency: "3ms"},
+	}
+
+	buf, _, out := getOutput(t)
+	outputPlaintext(out, nil, Summary{}, nil, nil, nil, nil, nil, traces, nil, nil)
+	assert.Contains(t, buf.String(), "Slowest traced requests:\n  5ms: abc\n  3ms: def\n")
+
+	buf, _, out = getOutput(t)
+	outputJSON(out, Parameters{TraceSampleRate: 0.5}, nil, Summary{}, nil, nil, nil, nil, nil, traces, nil, nil)
+
+	var benchmarkOutput BenchmarkOutput
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &benchmarkOutput))
+	assert.Equal(t, 0.5, benchmarkOutput.Parameters.TraceSampleRate)
+	assert.Equal(t, traces, benchmarkOutput.SlowestTraces)
+}
+
+func TestBenchmarkOutputProtocols(t *testing.T) {
+	protocols := map[string]*ProtocolSummary{
+		"tchannel": {
+			TotalRequests: 3,
+			Latencies:     formatLatencies(map[float64]time.Duration{0.5: time.Millisecond}),
+		},
+		"http": {
+			TotalRequests: 2,
+			Latencies:     formatLatencies(nil),
+			ErrorSummary: &ErrorSummary{
+				TotalErrors: 1,
+				ErrorRate:   50,
+				ErrorsCount: map[string]int{"timeout": 1},
+			},
+		},
+	}
+
+	buf, _, out := getOutput(t)
+	outputPlaintext(out, nil, Summary{}, nil, nil, nil, nil, nil, nil, protocols, nil)
+	got := buf.String()
+	assert.Contains(t, got, "Protocol http:\n  Total requests: 2\n")
+	assert.Contains(t, got, "     1: timeout\n  Error rate: 50.0000%\n")
+	assert.Contains(t, got, "Protocol tchannel:\n  Total requests: 3\n  Latencies:\n    0.5000: 1ms\n")
+	assert.True(t, strings.Index(got, "Protocol http:") < strings.Index(got, "Protocol tchannel:"), "Protocols should be sorted")
+
+	buf, _, out = getOutput(t)
+	outputJSON(out, Parameters{Protocols: []string{"tchannel", "http"}}, nil, Summary{}, nil, nil, nil, nil, nil, nil, protocols, nil)
+
+	var benchmarkOutput BenchmarkOutput
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &benchmarkOutput))
+	assert.Equal(t, []string{"tchannel", "http"}, benchmarkOutput.Parameters.Protocols)
+	assert.Equal(t, protocols, benchmarkOutput.Protocols)
+}
+
+func TestBenchmarkProtocols(t *testing.T) {
+	tests := []struct {
+		peers    []string
+		resolved transport.Protocol
+		want     []transport.Protocol
+	}{
+		{
+			resolved: transport.GRPC,
+			want:     []transport.Protocol{transport.GRPC},
+		},
+		{
+			peers:    []string{"1.1.1.1:1", "2.2.2.2:2"},
+			resolved: transport.TChannel,
+			want:     []transport.Protocol{transport.TChannel},
+		},
+		{
+			peers:    []string{"http://1.1.1.1", "1.1.1.1:1", "grpc://2.2.2.2:2", "https://3.3.3.3"},
+			resolved: transport.TChannel,
+			want:     []transport.Protocol{transport.HTTP, transport.TChannel, transport.GRPC},
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, benchmarkProtocols(tt.peers, tt.resolved), "Unexpected protocols for %v", tt.peers)
+	}
+}
+
+func TestBenchmarkHedge(t *testing.T) {
+	var primaryCalls, hedgeCalls atomic.Int32
+	primary := newServer(t)
+	defer primary.shutdown()
+	primary.register(fooMethod, methods.errorIf(func() bool {
+		primaryCalls.Inc()
+		return false
+	}))
+	hedge := newServer(t)
+	defer hedge.shutdown()
+	hedge.register(fooMethod, methods.errorIf(func() bool {
+		hedgeCalls.Inc()
+		return false
+	}))
+
+	tOpts := primary.transportOpts()
+	tOpts.Peers = append(tOpts.Peers, hedge.hostPort())
+	tOpts.PeerStrategy = "round-robin"
+
+	buf, _, out := getOutput(t)
+	m := benchmarkMethodForTest(t, fooMethod, transport.TChannel)
+	runBenchmark(out, _testLogger, Options{
+		BOpts: BenchmarkOptions{
+			MaxRequests: 20,
+			Connections: 1,
+			Concurrency: 1,
+			Hedge:       "0s",
+			Format:      "json",
+		},
+		TOpts: tOpts,
+	}, _resolvedTChannelThrift, fooMethod, m)
+
+	var benchmarkOutput BenchmarkOutput
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &benchmarkOutput))
+	assert.Equal(t, "0s", benchmarkOutput.Parameters.Hedge)
+
+	// With no delay, every request is hedged.
+	hedgeSummary := benchmarkOutput.HedgeSummary
+	require.NotNil(t, hedgeSummary, "Missing hedge summary")
+	assert.Equal(t, 20, hedgeSummary.TotalHedges)
+	assert.Equal(t, float64(100), hedgeSummary.HedgeRate)
+	assert.Equal(t, 100*float64(hedgeSummary.TotalWins)/20, hedgeSummary.WinRate)
+	assert.Len(t, hedgeSummary.UnhedgedLatencies, len(_quantiles))
+
+	assert.EqualValues(t, 20, primaryCalls.Load(), "Unexpected number of requests")
+	assert.EqualValues(t, 20, hedgeCalls.Load(), "Each request should be hedged to the other peer")
+}
+
+func TestBenchmarkHedgeErrors(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	var fatalMessage string
+	out := &testOutput{
+		fatalf: func(msg string, args ...interface{}) {
+			fatalMessage = fmt.Sprintf(msg, args...)
+		},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m := benchmarkMethodForTest(t, fooMethod, transport.TChannel)
+		runBenchmark(out, _testLogger, Options{
+			BOpts: BenchmarkOptions{MaxRequests: 1, Hedge: "10ms", Format: "json"},
+			TOpts: s.transportOpts(),
+		}, _resolvedTChannelThrift, fooMethod, m)
+	}()
+	wg.Wait()
+	assert.Contains(t, fatalMessage, "Hedging requires at least 2 peers")
+}
+
+func TestBenchmarkArrival(t *testing.T) {
+	var requests atomic.Int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.errorIf(func() bool {
+		requests.Inc()
+		return false
+	}))
+	m := benchmarkMethodForTest(t, fooMethod, transport.TChannel)
+
+	tests := []struct {
+		msg         string
+		opts        BenchmarkOptions
+		wantParam   string
+		wantNoParam bool
+	}{
+		{
+			msg:         "uniform",
+			opts:        BenchmarkOptions{RPS: 1000, Arrival: "uniform"},
+			wantNoParam: true,
+		},
+		{
+			msg:       "poisson with seed",
+			opts:      BenchmarkOptions{RPS: 1000, Arrival: "poisson", ArrivalSeed: 5},
+			wantParam: "Arrival:         poisson (seed 5)",
+		},
+		{
+			msg:       "burst defaults to RPS",
+			opts:      BenchmarkOptions{RPS: 1000, Arrival: "burst"},
+			wantParam: "Arrival:         burst (burst 1000)",
+		},
+		{
+			msg:       "burst",
+			opts:      BenchmarkOptions{RPS: 1000, Arrival: "burst", Burst: 3},
+			wantParam: "Arrival:         burst (burst 3)",
+		},
+		{
+			msg:         "arrival ignored without RPS",
+			opts:        BenchmarkOptions{Arrival: "poisson"},
+			wantNoParam: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			requests.Store(0)
+			buf, _, out := getOutput(t)
+
+			opts := tt.opts
+			opts.MaxRequests = 20
+			opts.Connections = 2
+			opts.Concurrency = 1
+			runBenchmark(out, _testLogger, Options{
+				BOpts: opts,
+				TOpts: s.transportOpts(),
+			}, _resolvedTChannelThrift, fooMethod, m)
+
+			bufStr := buf.String()
+			if tt.wantNoParam {
+				assert.NotContains(t, bufStr, "Arrival:")
+			} else {
+				assert.Contains(t, bufStr, tt.wantParam)
+			}
+			assert.EqualValues(t, 20, requests.Load(), "Unexpected number of requests")
+		})
+	}
+}
@@ -21,28 +21,67 @@
 package main
 
 import (
+	"context"
+	"math/rand"
 	"time"
 
 	"github.com/yarpc/yab/encoding"
 	"github.com/yarpc/yab/transport"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/tchannel-go"
 )
 
 // benchmarkUnaryMethod benchmarks unary requests.
 type benchmarkUnaryMethod struct {
 	serializer encoding.Serializer
 	req        *transport.Request
+
+	// traceSampleRate is the fraction of calls that are sent with a
+	// sampling priority, so they're traced.
+	traceSampleRate float64
 }
 
 // Call dispatches unary request on the provided transport.
-func (m benchmarkUnaryMethod) Call(t transport.Transport) (benchmarkCallReporter, error) {
+func (m benchmarkUnaryMethod) Call(ctx context.Context, t transport.Transport) (benchmarkCallReporter, error) {
+	var trace uint16
+	if m.traceSampleRate > 0 && rand.Float64() < m.traceSampleRate {
+		trace = 1
+	}
+
+	ctx, cancel := tchannel.NewContextBuilder(m.req.Timeout).SetParentContext(ctx).Build()
+	defer cancel()
+	ctx = makeContextWithTrace(ctx, t, m.req, trace)
+
 	start := time.Now()
-	res, err := makeRequest(t, m.req)
+	res, err := transport.Call(ctx, t, m.req)
 	latency := time.Since(start)
 
 	if err == nil {
 		err = m.serializer.CheckSuccess(res)
 	}
-	return newBenchmarkCallLatencyReport(latency), err
+
+	report := newBenchmarkCallLatencyReport(latency)
+	if trace > 0 {
+		report.traceID = sampledTraceID(ctx)
+	}
+	return report, err
+}
+
+// sampledTraceID returns the trace ID of the Jaeger span in the context if
+// the span is sampled, and an empty string otherwise.
+func sampledTraceID(ctx context.Context) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+
+	spanCtx, ok := span.Context().(jaeger.SpanContext)
+	if !ok || !spanCtx.IsSampled() {
+		return ""
+	}
+	return spanCtx.TraceID().String()
 }
 
 func (m benchmarkUnaryMethod) CallMethodType() encoding.MethodType {
@@ -21,6 +21,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -55,7 +56,7 @@ func benchmarkMethodForROpts(t *testing.T, rOpts RequestOptions, p transport.Pro
 	require.NoError(t, err, "Failed to serialize Thrift body")
 
 	req.Timeout = time.Second
-	return benchmarkUnaryMethod{serializer, req}
+	return benchmarkUnaryMethod{serializer: serializer, req: req}
 }
 
 func TestBenchmarkMethodWarmTransport(t *testing.T) {
@@ -99,7 +100,7 @@ func TestBenchmarkMethodWarmTransport(t *testing.T) {
 		transport, err := warmTransport(m, tOpts, resolvedProtocolEncoding{
 			protocol: transport.TChannel,
 			enc:      encoding.JSON,
-		}, 1 /* warmupRequests */)
+		}, opentracing.NoopTracer{}, 1 /* warmupRequests */)
 		if tt.wantErr != "" {
 			if assert.Error(t, err, "WarmTransport should fail") {
 				assert.Contains(t, err.Error(), tt.wantErr, "Invalid error message")
@@ -159,7 +160,7 @@ func TestBenchmarkMethodCall(t *testing.T) {
 			m.req.Method = tt.reqMethod
 		}
 
-		res, err := m.Call(tp)
+		res, err := m.Call(context.Background(), tp)
 		if tt.wantErr != "" {
 			if assert.Error(t, err, "call should fail") {
 				assert.Contains(t, err.Error(), tt.wantErr, "call should return 0 duration")
@@ -172,42 +173,159 @@ func TestBenchmarkMethodCall(t *testing.T) {
 	}
 }
 
-func TestPeerBalancer(t *testing.T) {
+func TestBenchmarkMethodCallTraced(t *testing.T) {
+	tracer, closer := getTestTracer(t, "bar")
+	defer closer.Close()
+
+	s := newServer(t, withTracer(tracer))
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	tp, err := getTransport(s.transportOpts(), _resolvedTChannelThrift, tracer)
+	require.NoError(t, err, "Failed to get transport")
+
+	tests := []struct {
+		sampleRate float64
+		wantTraced bool
+	}{
+		{sampleRate: 0, wantTraced: false},
+		{sampleRate: 1, wantTraced: true},
+	}
+
+	for _, tt := range tests {
+		m := benchmarkMethodForTest(t, fooMethod, transport.TChannel)
+		m.traceSampleRate = tt.sampleRate
+
+		res, err := m.Call(context.Background(), tp)
+		require.NoError(t, err, "call should not fail")
+
+		traced, ok := res.(benchmarkTracedCallReporter)
+		require.True(t, ok, "unary call report should have trace IDs")
+		if tt.wantTraced {
+			assert.NotEmpty(t, traced.TraceID(), "sample rate %v should trace", tt.sampleRate)
+		} else {
+			assert.Empty(t, traced.TraceID(), "sample rate %v should not trace", tt.sampleRate)
+		}
+	}
+}
+
+func TestConnectionPeers(t *testing.T) {
 	tests := []struct {
-		seed  int64
-		peers []string
-		want  []string
+		seed    int64
+		tOpts   TransportOptions
+		want    []int
+		wantErr string
 	}{
 		{
 			seed:  1,
-			peers: []string{"1"},
-			want:  []string{"1", "1", "1"},
+			tOpts: TransportOptions{Peers: []string{"1"}},
+			want:  []int{0, 0, 0},
 		},
 		{
 			seed:  1,
-			peers: []string{"1", "2"},
-			want:  []string{"2", "1", "2"},
+			tOpts: TransportOptions{Peers: []string{"1", "2"}},
+			want:  []int{1, 0, 1},
 		},
 		{
 			seed:  2,
-			peers: []string{"1", "2"},
-			want:  []string{"1", "2", "1"},
+			tOpts: TransportOptions{Peers: []string{"1", "2"}},
+			want:  []int{0, 1, 0},
 		},
 		{
 			seed:  1,
-			peers: []string{"1", "2", "3", "4", "5"},
-			want:  []string{"2", "3", "4"},
+			tOpts: TransportOptions{Peers: []string{"1", "2", "3", "4", "5"}},
+			want:  []int{1, 2, 3},
+		},
+		{
+			seed: 1,
+			tOpts: TransportOptions{
+				Peers:        []string{"1", "2", "3"},
+				PeerStrategy: "least-pending",
+			},
+			want: []int{2, 0, 1, 2, 0, 1},
+		},
+		{
+			seed: 1,
+			tOpts: TransportOptions{
+				Peers:        []string{"1", "2", "3"},
+				PeerStrategy: "weighted",
+				PeerWeights:  []int{0, 0, 1},
+			},
+			want: []int{2, 2, 2},
+		},
+		{
+			seed: 1,
+			tOpts: TransportOptions{
+				Peers:        []string{"1", "2"},
+				PeerStrategy: "weighted",
+				PeerWeights:  []int{1, 3},
+			},
+			want: []int{1, 0, 1, 1, 1, 0, 1, 1},
+		},
+		{
+			// Peer lists with weights default to the weighted strategy.
+			seed: 1,
+			tOpts: TransportOptions{
+				Peers:       []string{"1", "2", "3"},
+				PeerWeights: []int{2, 0, 1},
+			},
+			want: []int{0, 2, 0, 0, 2, 0},
+		},
+		{
+			seed: 1,
+			tOpts: TransportOptions{
+				Peers:        []string{"1", "2", "3"},
+				PeerStrategy: "weighted",
+			},
+			want: []int{0, 1, 2, 0, 1, 2},
+		},
+		{
+			seed: 1,
+			tOpts: TransportOptions{
+				Peers:        []string{"1", "2", "3"},
+				PeerStrategy: "fastest",
+			},
+			wantErr: `unknown peer strategy "fastest"`,
 		},
 	}
 
 	for _, tt := range tests {
 		rand.Seed(tt.seed)
-		peerFor := peerBalancer(tt.peers)
-		for i, want := range tt.want {
-			got, index := peerFor(i)
-			assert.Equal(t, want, got, "peerBalancer(%v) seed %v i %v failed", tt.peers, tt.seed, i)
-			assert.Equal(t, want, tt.peers[index], "peerBalancer(%v) seed %v i %v unexpected index %v", tt.peers, tt.seed, i, index)
+		got, err := connectionPeers(len(tt.want), tt.tOpts)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "connectionPeers(%+v) should fail", tt.tOpts) {
+				assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error")
+			}
+			continue
 		}
+
+		require.NoError(t, err, "connectionPeers(%+v) failed", tt.tOpts)
+		assert.Equal(t, tt.want, got, "connectionPeers(%+v) seed %v failed", tt.tOpts, tt.seed)
+	}
+}
+
+func TestConnectionPeersMixedWeights(t *testing.T) {
+	// Peers without a weight in a list where other peers have weights
+	// should still get connections.
+	peers, weights, err := loadTransportPeers(TransportOptions{PeerList: "testdata/valid_metadata_peerlist.yaml"})
+	require.NoError(t, err, "loadTransportPeers failed")
+
+	got, err := connectionPeers(5, TransportOptions{Peers: peers, PeerWeights: weights})
+	require.NoError(t, err, "connectionPeers failed")
+	assert.Equal(t, []int{0, 1, 0, 2, 0}, got, "unexpected connection peers")
+}
+
+func TestConnectionPeersConsistentHash(t *testing.T) {
+	peers := []string{"1", "2", "3", "4", "5"}
+	first, err := connectionPeers(5, TransportOptions{
+		Peers:        peers,
+		PeerStrategy: "consistent-hash",
+		ShardKey:     "sk",
+	})
+	require.NoError(t, err, "connectionPeers failed")
+
+	for _, peer := range first {
+		assert.Equal(t, first[0], peer, "All connections should use the peer for the shard key")
 	}
 }
 
@@ -233,7 +351,7 @@ func TestBenchmarkMethodWarmTransportsSuccess(t *testing.T) {
 		ServiceName: "foo",
 		Peers:       serverHPs,
 	}
-	transports, err := warmTransports(m, numServers, tOpts, _resolvedTChannelThrift, 1 /* warmupRequests */)
+	transports, err := warmTransports(m, numServers, tOpts, _resolvedTChannelThrift, opentracing.NoopTracer{}, 1 /* warmupRequests */)
 	assert.NoError(t, err, "WarmTransports should not fail")
 	assert.Equal(t, numServers, len(transports), "Got unexpected number of transports")
 	for i, transport := range transports {
@@ -292,7 +410,7 @@ func TestBenchmarkMethodWarmTransportsError(t *testing.T) {
 			ServiceName: "foo",
 			Peers:       []string{s.hostPort()},
 		}
-		_, err := warmTransports(m, 10, tOpts, _resolvedTChannelThrift, tt.warmup)
+		_, err := warmTransports(m, 10, tOpts, _resolvedTChannelThrift, opentracing.NoopTracer{}, tt.warmup)
 		if tt.wantErr {
 			assert.Error(t, err, "%v: WarmTransports should fail", msg)
 		} else {
@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package credprovider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/yarpc/yab/internal/execurl"
+)
+
+// execCredentialProvider runs a command to get a token, such as
+// "exec:get-token --audience foo". The command can either print the full
+// header value, or a JSON OAuth2 token response, which may expire.
+// Arguments are split on whitespace, so arguments with spaces use arg query
+// parameters, as described by execurl.Args.
+type execCredentialProvider struct{}
+
+func (execCredentialProvider) Fetch(ctx context.Context, u *url.URL) (Token, error) {
+	args, err := execurl.Args(u)
+	if err != nil {
+		return Token{}, err
+	}
+
+	out, err := execurl.Run(ctx, "token", args)
+	if err != nil {
+		return Token{}, err
+	}
+
+	output := bytes.TrimSpace(out)
+	if len(output) == 0 {
+		return Token{}, fmt.Errorf("token command %q printed no token", args[0])
+	}
+	if output[0] == '{' {
+		token, err := parseTokenResponse(output, time.Now())
+		if err != nil {
+			return Token{}, fmt.Errorf("failed to parse token command output: %v", err)
+		}
+		return token, nil
+	}
+	return Token{Value: string(output)}, nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package credprovider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecToken(t *testing.T) {
+	token, err := Fetch(context.Background(), mustParseURL("exec:echo Bearer abc"))
+	require.NoError(t, err)
+	assert.Equal(t, Token{Value: "Bearer abc"}, token)
+}
+
+func TestExecTokenResponse(t *testing.T) {
+	before := time.Now()
+	token, err := Fetch(context.Background(), mustParseURL(`exec:echo {"access_token":"abc","token_type":"bearer","expires_in":60}`))
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer abc", token.Value)
+	assert.WithinDuration(t, before.Add(time.Minute), token.Expiry, time.Second)
+}
+
+func TestExecTokenErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		url     string
+		wantErr string
+	}{
+		{
+			msg:     "no command",
+			url:     "exec:",
+			wantErr: "no command specified",
+		},
+		{
+			msg:     "command not found",
+			url:     "exec:yab-missing-token-command",
+			wantErr: `failed to run token command "yab-missing-token-command"`,
+		},
+		{
+			msg:     "command fails",
+			url:     "exec:ls /yab-missing-dir",
+			wantErr: "yab-missing-dir",
+		},
+		{
+			msg:     "no output",
+			url:     "exec:true",
+			wantErr: "printed no token",
+		},
+		{
+			msg:     "invalid JSON",
+			url:     "exec:echo {",
+			wantErr: "failed to parse token command output",
+		},
+		{
+			msg:     "no access token",
+			url:     `exec:echo {"token_type":"Bearer"}`,
+			wantErr: "missing access_token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := Fetch(context.Background(), mustParseURL(tt.url))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
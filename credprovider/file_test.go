@@ -0,0 +1,67 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package credprovider
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileToken(t *testing.T) {
+	path := writeTokenFile(t, "Bearer abc\n")
+
+	for _, u := range []string{path, "file://" + path} {
+		token, err := Fetch(context.Background(), mustParseURL(u))
+		require.NoError(t, err, "failed to fetch %v", u)
+		assert.Equal(t, Token{Value: "Bearer abc"}, token, "unexpected token from %v", u)
+	}
+}
+
+func TestFileTokenErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		path    string
+		wantErr string
+	}{
+		{
+			msg:     "missing file",
+			path:    filepath.Join(t.TempDir(), "missing"),
+			wantErr: "failed to read token file",
+		},
+		{
+			msg:     "empty file",
+			path:    writeTokenFile(t, " \n"),
+			wantErr: "token file is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := Fetch(context.Background(), mustParseURL(tt.path))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
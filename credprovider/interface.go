@@ -0,0 +1,89 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package credprovider fetches auth tokens from credential providers, such
+// as a token file, a command or an OAuth2 token endpoint.
+package credprovider
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+var registry = make(map[string]CredentialProvider)
+
+func init() {
+	RegisterCredentialProvider("", fileCredentialProvider{})
+	RegisterCredentialProvider("file", fileCredentialProvider{})
+	RegisterCredentialProvider("exec", execCredentialProvider{})
+	RegisterCredentialProvider("oauth2+http", oauth2CredentialProvider{})
+	RegisterCredentialProvider("oauth2+https", oauth2CredentialProvider{})
+}
+
+// Token is a credential fetched from a credential provider.
+type Token struct {
+	// Value is the full header value, such as "Bearer abc".
+	Value string
+
+	// Expiry is when the token expires. A zero Expiry never expires.
+	Expiry time.Time
+}
+
+// Schemes returns supported credential provider protocol schemes.
+func Schemes() []string {
+	schemes := make([]string, 0, len(registry))
+	for scheme := range registry {
+		if scheme != "" {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+// Fetch fetches a token from a URL, using the registered credential
+// provider for that protocol scheme.
+func Fetch(ctx context.Context, u *url.URL) (Token, error) {
+	cp, err := lookup(u)
+	if err != nil {
+		return Token{}, err
+	}
+	return cp.Fetch(ctx, u)
+}
+
+func lookup(u *url.URL) (CredentialProvider, error) {
+	if cp, ok := registry[u.Scheme]; ok {
+		return cp, nil
+	}
+	return nil, fmt.Errorf("no credential provider available for scheme %q in URL %q", u.Scheme, u.String())
+}
+
+// CredentialProvider fetches a token for a given credential provider URL.
+// Implementations are expected to define the behavior for the URL name space.
+type CredentialProvider interface {
+	Fetch(context.Context, *url.URL) (Token, error)
+}
+
+// RegisterCredentialProvider registers a credential provider for a protocol
+// scheme.
+func RegisterCredentialProvider(scheme string, cp CredentialProvider) {
+	registry[scheme] = cp
+}
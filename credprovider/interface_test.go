@@ -0,0 +1,94 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package credprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yarpc/yab/internal/httpclient"
+)
+
+type fakeCredentialProvider struct {
+	tokens []Token
+	err    error
+	calls  int
+
+	// block, if set, blocks fetches until it's closed.
+	block chan struct{}
+
+	// client is the HTTP client in the context of the last fetch.
+	client *http.Client
+}
+
+func (f *fakeCredentialProvider) Fetch(ctx context.Context, u *url.URL) (Token, error) {
+	f.calls++
+	f.client = httpclient.FromContext(ctx)
+	if f.block != nil {
+		<-f.block
+	}
+	if f.err != nil {
+		return Token{}, f.err
+	}
+	token := f.tokens[0]
+	if len(f.tokens) > 1 {
+		f.tokens = f.tokens[1:]
+	}
+	return token, nil
+}
+
+func TestSchemes(t *testing.T) {
+	assert.ElementsMatch(t, []string{"file", "exec", "oauth2+http", "oauth2+https"}, Schemes())
+}
+
+func TestFetchRegistered(t *testing.T) {
+	defer stubRegistry()()
+
+	f := &fakeCredentialProvider{tokens: []Token{{Value: "Bearer abc", Expiry: time.Unix(1, 0)}}}
+	RegisterCredentialProvider("fake", f)
+
+	token, err := Fetch(context.Background(), mustParseURL("fake://token"))
+	assert.NoError(t, err, "should fetch without error")
+	assert.Equal(t, f.tokens[0], token, "should fetch fake:// token")
+}
+
+func TestFetchError(t *testing.T) {
+	defer stubRegistry()()
+
+	f := &fakeCredentialProvider{err: errors.New("noope")}
+	RegisterCredentialProvider("fake", f)
+
+	_, err := Fetch(context.Background(), mustParseURL("fake://token"))
+	assert.Equal(t, f.err, err, "should fetch with error")
+}
+
+func TestFetchUnknownScheme(t *testing.T) {
+	_, err := Fetch(context.Background(), mustParseURL("ldap://token"))
+	assert.EqualError(t, err, `no credential provider available for scheme "ldap" in URL "ldap://token"`)
+
+	_, err = NewSource(mustParseURL("ldap://token"), nil /* client */)
+	assert.Error(t, err, "should fail to create source for unknown scheme")
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package credprovider
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yarpc/yab/internal/httpclient"
+)
+
+const (
+	_oauth2SchemePrefix = "oauth2+"
+
+	// _clientSecretEnv is used as the client secret if the URL doesn't
+	// specify one, so it doesn't have to be passed on the command line.
+	_clientSecretEnv = "YAB_OAUTH2_CLIENT_SECRET"
+)
+
+// oauth2CredentialProvider fetches a token using the OAuth2 client
+// credentials flow. The URL is the token endpoint with an "oauth2+" scheme
+// prefix, and query parameters such as client_id, client_secret and scope
+// are sent as form parameters, e.g.,
+// oauth2+https://auth.example.com/token?client_id=yab&scope=read
+//
+// The token is requested using the HTTP client from the context, which uses
+// yab's TLS and proxy options.
+type oauth2CredentialProvider struct{}
+
+func (oauth2CredentialProvider) Fetch(ctx context.Context, u *url.URL) (Token, error) {
+	form := u.Query()
+	form.Set("grant_type", "client_credentials")
+	if form.Get("client_secret") == "" {
+		if secret := os.Getenv(_clientSecretEnv); secret != "" {
+			form.Set("client_secret", secret)
+		}
+	}
+
+	tokenURL := *u
+	tokenURL.Scheme = strings.TrimPrefix(u.Scheme, _oauth2SchemePrefix)
+	tokenURL.RawQuery = ""
+
+	req, err := http.NewRequest("POST", tokenURL.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	requested := time.Now()
+	resp, err := httpclient.FromContext(ctx).Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to fetch OAuth2 token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to read OAuth2 token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("failed to fetch OAuth2 token, status not OK: %v: %s", http.StatusText(resp.StatusCode), strings.TrimSpace(string(contents)))
+	}
+
+	// The token expiry is relative to when the token was requested, so the
+	// token is refreshed early rather than late.
+	token, err := parseTokenResponse(contents, requested)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to parse OAuth2 token response: %v", err)
+	}
+	return token, nil
+}
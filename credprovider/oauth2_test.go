@@ -0,0 +1,149 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package credprovider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yarpc/yab/internal/httpclient"
+)
+
+// newTokenServer returns a stub OAuth2 token endpoint that records the
+// form of the last request.
+func newTokenServer(t *testing.T, status int, response string) (*httptest.Server, *url.Values) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method, "unexpected method")
+		assert.Equal(t, "/token", r.URL.Path, "unexpected path")
+		assert.Empty(t, r.URL.RawQuery, "parameters should be sent in the body")
+		require.NoError(t, r.ParseForm(), "failed to parse form")
+		form = r.PostForm
+
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &form
+}
+
+func oauth2URL(server *httptest.Server, query string) *url.URL {
+	return mustParseURL("oauth2+" + server.URL + "/token?" + query)
+}
+
+func TestOAuth2Token(t *testing.T) {
+	server, form := newTokenServer(t, http.StatusOK, `{"access_token":"abc","token_type":"bearer","expires_in":3600}`)
+
+	before := time.Now()
+	token, err := Fetch(context.Background(), oauth2URL(server, "client_id=yab&client_secret=s3cret&scope=read+write"))
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer abc", token.Value)
+	assert.WithinDuration(t, before.Add(time.Hour), token.Expiry, time.Second)
+
+	assert.Equal(t, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"yab"},
+		"client_secret": {"s3cret"},
+		"scope":         {"read write"},
+	}, *form)
+}
+
+func TestOAuth2TokenHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"abc"}`))
+	}))
+	defer server.Close()
+
+	u := oauth2URL(server, "client_id=yab")
+	_, err := Fetch(context.Background(), u)
+	assert.Error(t, err, "default client should not trust the test server")
+
+	ctx := httpclient.WithClient(context.Background(), server.Client())
+	token, err := Fetch(ctx, u)
+	require.NoError(t, err, "client from the context should be used")
+	assert.Equal(t, "Bearer abc", token.Value)
+}
+
+func TestOAuth2TokenSecretFromEnv(t *testing.T) {
+	server, form := newTokenServer(t, http.StatusOK, `{"access_token":"abc"}`)
+
+	os.Setenv(_clientSecretEnv, "env-secret")
+	defer os.Unsetenv(_clientSecretEnv)
+
+	token, err := Fetch(context.Background(), oauth2URL(server, "client_id=yab"))
+	require.NoError(t, err)
+	assert.Equal(t, Token{Value: "Bearer abc"}, token, "token without expiry should not expire")
+	assert.Equal(t, "env-secret", form.Get("client_secret"))
+}
+
+func TestOAuth2TokenErrors(t *testing.T) {
+	tests := []struct {
+		msg      string
+		status   int
+		response string
+		wantErr  string
+	}{
+		{
+			msg:      "unauthorized",
+			status:   http.StatusUnauthorized,
+			response: `{"error":"invalid_client"}`,
+			wantErr:  `status not OK: Unauthorized: {"error":"invalid_client"}`,
+		},
+		{
+			msg:      "invalid JSON",
+			status:   http.StatusOK,
+			response: "{",
+			wantErr:  "failed to parse OAuth2 token response",
+		},
+		{
+			msg:      "no access token",
+			status:   http.StatusOK,
+			response: `{"token_type":"bearer"}`,
+			wantErr:  "missing access_token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			server, _ := newTokenServer(t, tt.status, tt.response)
+			_, err := Fetch(context.Background(), oauth2URL(server, "client_id=yab"))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestOAuth2TokenConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	_, err := Fetch(context.Background(), oauth2URL(server, ""))
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "failed to fetch OAuth2 token"), "unexpected error: %v", err)
+}
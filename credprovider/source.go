@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package credprovider
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/yarpc/yab/internal/httpclient"
+)
+
+// FetchTimeout limits how long fetching a token can take. Fetches are shared
+// by callers, so they're independent of the callers' contexts, but callers
+// can stop waiting for a fetch earlier.
+const FetchTimeout = 10 * time.Second
+
+// _refreshBefore is how long before a token expires that it's refreshed.
+const _refreshBefore = time.Minute
+
+// Source caches a token from a credential provider, and fetches a new token
+// in the background before the cached token expires. It's safe for
+// concurrent use.
+type Source struct {
+	u      *url.URL
+	cp     CredentialProvider
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	token     Token
+	fetched   bool
+	refreshAt time.Time
+	fetching  *fetch // the fetch in progress, if any
+}
+
+// fetch is a token fetch, which is shared by callers waiting for a token.
+type fetch struct {
+	done  chan struct{}
+	token Token
+	err   error
+}
+
+// NewSource returns a Source for tokens from the given URL. Providers that
+// make HTTP requests use client, or http.DefaultClient if it's nil.
+func NewSource(u *url.URL, client *http.Client) (*Source, error) {
+	cp, err := lookup(u)
+	if err != nil {
+		return nil, err
+	}
+	return &Source{u: u, cp: cp, client: client, now: time.Now}, nil
+}
+
+// Token returns the cached token, and starts fetching a new token in the
+// background if the cached token expires soon. If there's no cached token,
+// or it has expired, Token waits for a new token to be fetched, or for ctx
+// to be done.
+func (s *Source) Token(ctx context.Context) (Token, error) {
+	s.mu.Lock()
+	now := s.now()
+	if s.fetched && (s.token.Expiry.IsZero() || now.Before(s.refreshAt)) {
+		defer s.mu.Unlock()
+		return s.token, nil
+	}
+
+	f := s.startFetch(now)
+	if s.fetched && now.Before(s.token.Expiry) {
+		defer s.mu.Unlock()
+		return s.token, nil
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	}
+}
+
+// startFetch starts fetching a new token, unless a fetch is already in
+// progress, and returns the fetch. It must be called with mu held.
+func (s *Source) startFetch(now time.Time) *fetch {
+	if s.fetching != nil {
+		return s.fetching
+	}
+
+	f := &fetch{done: make(chan struct{})}
+	s.fetching = f
+	go func() {
+		defer close(f.done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), FetchTimeout)
+		defer cancel()
+		f.token, f.err = s.cp.Fetch(httpclient.WithClient(ctx, s.client), s.u)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.finishFetch(f, now)
+	}()
+	return f
+}
+
+// finishFetch caches the result of a fetch started at the given time. It
+// must be called with mu held.
+func (s *Source) finishFetch(f *fetch, now time.Time) {
+	s.fetching = nil
+	if f.err != nil {
+		if s.fetched && now.Before(s.token.Expiry) {
+			// Try again halfway through the remaining lifetime, rather
+			// than on every call.
+			s.refreshAt = now.Add(s.token.Expiry.Sub(now) / 2)
+		}
+		return
+	}
+
+	s.token = f.token
+	s.fetched = true
+	s.refreshAt = refreshTime(now, f.token.Expiry)
+}
+
+// refreshTime returns when a token fetched at the given time should be
+// refreshed. Tokens that live for less than two minutes are refreshed
+// halfway through their lifetime.
+func refreshTime(fetched, expiry time.Time) time.Time {
+	before := _refreshBefore
+	if lifetime := expiry.Sub(fetched); lifetime < 2*before {
+		before = lifetime / 2
+	}
+	return expiry.Add(-before)
+}
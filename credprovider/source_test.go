@@ -0,0 +1,199 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package credprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeSource(t *testing.T, f *fakeCredentialProvider) (*Source, *time.Time) {
+	defer stubRegistry()()
+	RegisterCredentialProvider("fake", f)
+
+	s, err := NewSource(mustParseURL("fake://token"), nil /* client */)
+	require.NoError(t, err, "failed to create source")
+
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+// waitForFetch waits for the fetch in progress, if any, to finish.
+func waitForFetch(s *Source) {
+	s.mu.Lock()
+	f := s.fetching
+	s.mu.Unlock()
+
+	if f != nil {
+		<-f.done
+	}
+}
+
+func TestSourceCachesToken(t *testing.T) {
+	f := &fakeCredentialProvider{tokens: []Token{{Value: "a"}, {Value: "b"}}}
+	s, _ := newFakeSource(t, f)
+
+	for i := 0; i < 3; i++ {
+		token, err := s.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "a", token.Value, "tokens without expiry should not be refreshed")
+	}
+	assert.Equal(t, 1, f.calls, "unexpected fetches")
+}
+
+func TestSourceHTTPClient(t *testing.T) {
+	defer stubRegistry()()
+	f := &fakeCredentialProvider{tokens: []Token{{Value: "a"}}}
+	RegisterCredentialProvider("fake", f)
+
+	client := &http.Client{}
+	s, err := NewSource(mustParseURL("fake://token"), client)
+	require.NoError(t, err, "failed to create source")
+
+	_, err = s.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, client, f.client, "provider should use the source's HTTP client")
+}
+
+func TestSourceRefreshesToken(t *testing.T) {
+	tests := []struct {
+		msg       string
+		lifetime  time.Duration
+		refreshAt time.Duration
+	}{
+		{msg: "long lived", lifetime: time.Hour, refreshAt: 59 * time.Minute},
+		{msg: "short lived", lifetime: 30 * time.Second, refreshAt: 15 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			start := time.Unix(1000, 0)
+			f := &fakeCredentialProvider{tokens: []Token{
+				{Value: "a", Expiry: start.Add(tt.lifetime)},
+				{Value: "b", Expiry: start.Add(2 * tt.lifetime)},
+			}}
+			s, now := newFakeSource(t, f)
+
+			token, err := s.Token(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "a", token.Value)
+
+			*now = start.Add(tt.refreshAt - time.Millisecond)
+			token, err = s.Token(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "a", token.Value, "token should be cached before refresh")
+
+			*now = start.Add(tt.refreshAt)
+			token, err = s.Token(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "a", token.Value, "cached token should be used while refreshing")
+
+			waitForFetch(s)
+			token, err = s.Token(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "b", token.Value, "token should be refreshed before expiry")
+			assert.Equal(t, 2, f.calls, "unexpected fetches")
+		})
+	}
+}
+
+func TestSourceRefreshErrors(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := &fakeCredentialProvider{tokens: []Token{{Value: "a", Expiry: start.Add(time.Hour)}}}
+	s, now := newFakeSource(t, f)
+
+	_, err := s.Token(context.Background())
+	require.NoError(t, err)
+
+	f.err = errors.New("token endpoint down")
+	*now = start.Add(59 * time.Minute)
+	token, err := s.Token(context.Background())
+	require.NoError(t, err, "cached token should be used until it expires")
+	assert.Equal(t, "a", token.Value)
+	waitForFetch(s)
+	assert.Equal(t, 2, f.calls, "unexpected fetches")
+
+	// The next refresh is halfway through the remaining lifetime.
+	*now = start.Add(59*time.Minute + 29*time.Second)
+	_, err = s.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, f.calls, "refresh should not be retried on every call")
+
+	*now = start.Add(time.Hour)
+	_, err = s.Token(context.Background())
+	assert.Equal(t, f.err, err, "expired token should not be used")
+	assert.Equal(t, 3, f.calls, "unexpected fetches")
+}
+
+func TestSourceFetchError(t *testing.T) {
+	f := &fakeCredentialProvider{err: errors.New("bad token")}
+	s, _ := newFakeSource(t, f)
+
+	_, err := s.Token(context.Background())
+	assert.Equal(t, f.err, err)
+}
+
+func TestSourceRefreshDoesNotBlock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := &fakeCredentialProvider{tokens: []Token{
+		{Value: "a", Expiry: start.Add(time.Hour)},
+		{Value: "b", Expiry: start.Add(2 * time.Hour)},
+	}}
+	s, now := newFakeSource(t, f)
+
+	_, err := s.Token(context.Background())
+	require.NoError(t, err)
+
+	f.block = make(chan struct{})
+	*now = start.Add(59 * time.Minute)
+	for i := 0; i < 3; i++ {
+		token, err := s.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "a", token.Value, "cached token should be returned while a refresh is blocked")
+	}
+
+	close(f.block)
+	waitForFetch(s)
+	assert.Equal(t, 2, f.calls, "concurrent refreshes should be shared")
+}
+
+func TestSourceWaitCancelled(t *testing.T) {
+	f := &fakeCredentialProvider{tokens: []Token{{Value: "a"}}, block: make(chan struct{})}
+	s, _ := newFakeSource(t, f)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.Token(ctx)
+	assert.Equal(t, context.Canceled, err, "waiting for a token should stop when the context is done")
+
+	close(f.block)
+	token, err := s.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "a", token.Value, "fetch should continue after a caller stops waiting")
+	assert.Equal(t, 1, f.calls, "unexpected fetches")
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package credprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const _defaultTokenType = "Bearer"
+
+var errNoAccessToken = errors.New("token response is missing access_token")
+
+// tokenResponse is the JSON response of an OAuth2 token endpoint, which is
+// also accepted from commands.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// parseTokenResponse parses an OAuth2 token response received at the given
+// time.
+func parseTokenResponse(contents []byte, now time.Time) (Token, error) {
+	var res tokenResponse
+	if err := json.Unmarshal(contents, &res); err != nil {
+		return Token{}, err
+	}
+	if res.AccessToken == "" {
+		return Token{}, errNoAccessToken
+	}
+
+	// Servers often return a lowercase "bearer", which some servers reject
+	// in the Authorization header.
+	tokenType := res.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, _defaultTokenType) {
+		tokenType = _defaultTokenType
+	}
+
+	token := Token{Value: tokenType + " " + res.AccessToken}
+	if res.ExpiresIn > 0 {
+		token.Expiry = now.Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
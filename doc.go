@@ -120,6 +120,62 @@ the command line:
 
 	$ ./set.yab -A key:hello -A value:world
 
+Benchmark options can be specified in a benchmark section of the template,
+using the same names as the flags:
+
+	benchmark:
+	  max-duration: 30s
+	  rps: 500
+	  connections: 4
+
+Benchmark flags specified on the command line override values in the template.
+
+Failed requests can be retried using --retries. By default, yab retries
+unavailable errors and timeouts, waiting 100ms before the first retry and
+doubling the wait up to 2s. Use --retry-on to list the errors to retry as
+YARPC error codes, TChannel error codes or HTTP status codes, and
+--retry-backoff to change the wait:
+
+	$ yab -p localhost:9787 kv --health --retries 5 \
+	    --retry-on unavailable,busy,503 --retry-backoff 500ms..5s
+
+Each attempt is logged, and the result of the last attempt is printed. Retries
+can also be specified in a retry section of the template:
+
+	retry:
+	  retries: 5
+	  backoff: 500ms..5s
+	  retry-on: [unavailable, busy, 503]
+
+Auth tokens can be fetched from a credential provider using --credentials,
+rather than passing them as a header. Tokens are sent in the Authorization
+header, or the header specified using --credentials-header, and are refreshed
+before they expire, including during benchmarks. The provider can be a file
+containing the header value, a command that prints the header value or an
+OAuth2 token response, or an OAuth2 token endpoint using the client
+credentials flow:
+
+	$ yab -p localhost:9787 kv --health --credentials ~/.kv-token
+	$ yab -p localhost:9787 kv --health --credentials 'exec:get-token kv'
+	$ yab -p localhost:9787 kv --health \
+	    --credentials 'oauth2+https://auth.example.com/token?client_id=yab&scope=kv'
+
+The OAuth2 client secret is read from $YAB_OAUTH2_CLIENT_SECRET if it's not in
+the URL. Use --credentials=? for supported protocols.
+
+The raw bytes sent and received by a request can be written to a directory
+using --dump-wire, which is useful for debugging encoding mismatches. Each
+attempt writes RUN-call-N.json, where RUN is the time yab started, with the
+headers, timing and peer of the request, and a file for each frame it lists:
+the TChannel arguments, the HTTP request and response, or the gRPC messages.
+HTTP messages are reconstructed in HTTP/1.1 format, with the protocol used on
+the wire recorded separately, and gRPC frames are reconstructed from the
+uncompressed messages. Reconstructed frames are marked in the metadata. With
+-v, --hexdump prints a hex dump of each frame. Benchmark and streaming
+requests are not dumped.
+
+	$ yab -p localhost:9787 kv --health --dump-wire /tmp/kv-health
+
 Binary data can be specified in one of many ways:
 	* As a string or an array of bytes: "data" or [100, 97, 116, 97]
 	* As base64: {"base64": "ZGF0YQ=="}
@@ -151,12 +207,131 @@ For HTTP endpoints, specify the URL as the peer,
 
 The Thrift-encoded body will be POSTed to the specified URL.
 
+HTTPS URLs are verified using the system's certificate authorities. A custom
+CA, a client certificate for mutual TLS, and the expected server name can be
+specified using the --tls-* options:
+
+	$ yab -p https://localhost:8443/thrift --tls-ca ca.pem \
+	    --tls-cert client.pem --tls-key client-key.pem [options]
+
+HTTP APIs that don't use YARPC can be called using --rest. The procedure is
+a path relative to the peer URL, and path parameters are filled in from the
+request. For methods without a body, such as GET, the remaining request fields
+are sent as query parameters:
+
+	$ yab -p http://localhost:8080 --rest --http-method GET \
+	    --procedure /users/{id} -r '{"id": "u1", "verbose": true}'
+
+HTTP/2 is negotiated using ALPN for https URLs, while http URLs are called
+using HTTP/1.1 by default. Use --http2 to call http URLs using HTTP/2 with prior
+knowledge (h2c). The protocol used is reported in the response's transport
+fields.
+
+HTTP responses with a non-2xx status code are displayed along with their
+headers before yab exits with an error. Use --http-success-codes to treat other
+status codes as successful, e.g. --http-success-codes 200-299,404.
+
+The response metadata and trailers of gRPC calls, including grpc-status and
+grpc-message, are displayed along with the response, and also when a call fails.
+Metadata that should be sent as-is, without the checks applied to headers,
+can be specified using -T:
+
+	$ yab -p grpc://localhost:5435 -T authorization:"Bearer token" [options]
+
+gRPC peers use TLS if --grpc-tls is specified, along with any --tls-* options,
+which are also used for https peers. The same TLS options are used when
+fetching descriptors using gRPC reflection.
+
+gRPC requests can be compressed using --grpc-compressor gzip, and the size of
+requests can be limited using --grpc-max-request-size. gRPC benchmarks report
+the bytes sent and received on the wire, which reflects any compression.
+
+Peers that listen on a unix domain socket are specified using unix://, or
+using http+unix://, grpc+unix:// or tchannel+unix:// to choose the protocol.
+For HTTP, the request path can follow the socket, separated by a colon:
+
+	$ yab -p http+unix:///var/run/svc.sock:/rpc [options]
+
+Peers can be called through an HTTP or SOCKS5 proxy using --proxy, which is
+used by all transports, including when fetching descriptors using gRPC
+reflection. HTTP proxies forward requests to http URLs, and other peers are
+reached using HTTP CONNECT. Without --proxy, HTTP peers use the proxy
+specified by HTTP_PROXY or HTTPS_PROXY unless the host is listed in NO_PROXY.
+
+	$ yab -p grpc://10.0.0.1:5435 --proxy socks5://localhost:1080 [options]
+
 Multiple peers can be specified using a peer list using -P or --peer-list.
 When making a single request, a single peer from this list is selected randomly.
 When benchmarking, connections will be established in a round-robin fashion,
 starting with a random peer.
 
 	$ yab --peer-list hosts.json [options]
+
+JSON and YAML peer lists can include metadata for each peer, such as its
+weight, zone and version, and any other tags. Peers can be filtered by their
+metadata using --peer-filter, which can be specified multiple times, and a
+random sample of the peers can be used with --peer-sample. Benchmark
+connections are assigned in proportion to peer weights, unless a different
+--peer-strategy is specified, and peers without a weight have a weight of 1.
+Plain lists of peers are still supported.
+
+	- peer: 10.0.0.1:8080
+	  weight: 3
+	  zone: us-east
+	  version: "1.2"
+	  tags: {pool: canary}
+	- 10.0.0.2:8080
+
+	$ yab -P hosts.yaml --peer-filter zone=us-east --peer-sample 5 [options]
+
+Peer lists can also be resolved using DNS. dns+srv:// uses the SRV records of a
+name, with peers weighted by their record weight, and only records with the
+lowest priority value are used. dns:// uses the addresses of a host, and the
+port must be specified. The DNS server can be set using the resolver query
+parameter.
+
+	$ yab -P dns+srv://_moe._tcp.example.com --peer-strategy weighted [options]
+	$ yab -P "dns://moe.example.com:8080?resolver=10.0.0.1" [options]
+
+Peer lists can also be printed by a command using exec:, which is killed if it
+does not finish before the --peer-list-timeout. The output can use any of the
+peer list file formats, and errors include the command's stderr. Arguments
+are split on whitespace without unquoting, so arguments with spaces are passed
+using arg query parameters after the command's path, each of which is a single
+argument.
+
+	$ yab -P "exec:discovery-cli lookup moe" [options]
+	$ yab -P "exec:///usr/bin/discovery-cli?arg=lookup&arg=moe%20prod" [options]
+
+Peer lists can also use the passing instances of a service registered with
+Consul, using the health API of an agent. Instances can be filtered using the
+tag and dc query parameters, and weighted using their passing weight. The ACL
+token is read from CONSUL_HTTP_TOKEN. Agents that serve the API over HTTPS use
+consul+https:.
+
+	$ yab -P "consul://localhost:8500/moe?tag=prod&dc=dc1" [options]
+
+Peer providers that make HTTP requests, such as http:, https: and consul:, use
+the --tls-* and --proxy options.
+
+Long benchmarks can resolve the peer list again using --peer-refresh. When
+peers are added or removed, connections are moved to the current peers using
+the peer strategy, and the previous connections are drained once their calls
+in flight complete. The report lists the changes to the peer list and the
+final number of connections to each peer.
+
+	$ yab -P dns+srv://_moe._tcp.example.com -d 4h --peer-refresh 30s [options]
+
+Peers in a list can use different protocols, such as tchannel:// and grpc://
+peers serving the same procedure using the same encoding. A single request is
+made to one of the peers using its protocol. Benchmark connections use the
+protocol of their peer, and the report includes latencies and errors for each
+protocol. Streaming methods require peers that all use the same protocol.
+
+The --peer-strategy option changes how peers are chosen for HTTP requests and
+benchmark connections. It can be round-robin, random, least-pending,
+consistent-hash, which chooses a peer using the shard key (--sk), or weighted,
+which uses weights from peer list metadata.
 `
 
 const _benchmarkOptsDesc = `Configures benchmarking, which is disabled by default.
@@ -176,10 +351,40 @@ An example benchmark command might be:
 This would make requests at 1000 RPS until either the maximum number of
 requests (100,000) or the maximum duration (10 seconds) is reached.
 
+By default, requests are spaced evenly. Use --arrival poisson to space requests
+with exponentially distributed intervals, or --arrival burst to allow up to
+--burst requests at once. Pass --arrival-seed to reproduce a Poisson run.
+
 By default, yab will create multiple connections (defaulting to the number of
 CPUs on the machine), but will only have one concurrent call per connection.
 The number of connections and concurrent calls per connection can be controlled
 using --connections and --concurrency.
+
+To measure the cost of connection setup, use --reconnect-every to replace the
+connection after a number of requests. Each concurrent caller then creates its
+own connections, and connection setup latency, including the TLS handshake
+for https peers, is reported separately from call latency. Failed connections
+are retried and reported separately from call errors, and a caller stops if it
+can't connect after 3 attempts:
+
+	$ yab -p localhost:9787 moe --health -d 10s --reconnect-every 1
+
+A fraction of unary benchmark requests can be traced using Jaeger by passing
+--trace-sample-rate. Traced requests are sent with a sampling priority, and the
+trace IDs of the slowest traced requests are listed in the report.
+
+To model hedged requests, pass --hedge with a delay. If a unary request hasn't
+completed after the delay, a duplicate is sent to the next peer in the list and
+the first successful response wins. The hedge is cancelled if the request sent
+first wins, while a request that loses to its hedge runs to completion in the
+background so its latency is known. The delay can be a duration, or a
+percentile of observed latencies such as p95, which is used once 100 requests
+have completed:
+
+	$ yab -P hosts.json moe --health -d 10s --hedge p95
+
+The report includes the hedge rate, how often the hedge won, and the latencies
+of the requests sent first, which are the latencies without hedging.
 `
 
 /* vim: set tabstop=8:softtabstop=8:shiftwidth=8:noexpandtab */
@@ -19,11 +19,11 @@ type grpcServer struct {
 	healthHandler *health.Server
 }
 
-func newGRPCServer(t *testing.T) *grpcServer {
+func newGRPCServer(t *testing.T, opts ...grpc.ServerOption) *grpcServer {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err, "Failed to create TCP listener")
 
-	server := grpc.NewServer()
+	server := grpc.NewServer(opts...)
 	healthHandler := health.NewServer()
 
 	grpc_health_v1.RegisterHealthServer(server, healthHandler)
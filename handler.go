@@ -28,15 +28,33 @@ type StreamIO interface {
 	HandleResponse(responseBody []byte) error
 }
 
-type requestHandler struct {
-	out        output
-	logger     *zap.Logger
-	opts       Options
-	transport  transport.Transport
+// protocolTarget is used to call the peers that use one protocol.
+type protocolTarget struct {
 	resolved   resolvedProtocolEncoding
 	serializer encoding.Serializer
-	body       io.Reader
-	headers    map[string]string
+	transport  transport.Transport
+}
+
+type requestHandler struct {
+	out    output
+	logger *zap.Logger
+	opts   Options
+
+	// targets has a target for each protocol used by peers. The first
+	// target is used for the initial request.
+	targets []protocolTarget
+
+	// resolved is used to create benchmark connections to peers.
+	resolved resolvedProtocolEncoding
+
+	// retry is used to retry the initial unary request.
+	retry retryPolicy
+
+	// wire dumps the raw bytes of the initial unary request, if enabled.
+	wire *wireDumper
+
+	body    io.Reader
+	headers map[string]string
 }
 
 func (r requestHandler) handle() {
@@ -55,32 +73,45 @@ func (r requestHandler) handleUnaryRequest() {
 		r.out.Fatalf("Failed while reading the input: %v\n", err)
 	}
 
-	req, err := r.serializer.Request(reqInput)
-	if err != nil {
-		r.out.Fatalf("Failed while serializing the input: %v\n", err)
-	}
+	callers := make(protocolCallers, len(r.targets))
+	var req *transport.Request
+	for i, target := range r.targets {
+		req, err = target.serializer.Request(reqInput)
+		if err != nil {
+			r.out.Fatalf("Failed while serializing the input: %v\n", err)
+		}
 
-	req, err = prepareRequest(req, r.headers, r.opts)
-	if err != nil {
-		r.out.Fatalf("Failed while preparing the request: %v\n", err)
-	}
+		req = prepareRequest(req, r.headers, r.opts)
 
-	// Decides if warm requests must be dispatched before benchmark.
-	if r.shouldMakeInitialRequest() {
-		makeInitialRequest(r.out, r.transport, r.serializer, req)
+		// Decides if warm requests must be dispatched before benchmark.
+		if i == 0 && r.shouldMakeInitialRequest() {
+			makeInitialRequest(r.out, r.logger, target.transport, target.serializer, req, r.retry, r.wire.recorder())
+		}
+
+		callers[target.resolved.protocol] = benchmarkUnaryMethod{
+			serializer:      target.serializer,
+			req:             req,
+			traceSampleRate: r.opts.BOpts.TraceSampleRate,
+		}
 	}
 
-	runBenchmark(r.out, r.logger, r.opts, r.resolved, req.Method, benchmarkUnaryMethod{
-		serializer: r.serializer,
-		req:        req,
-	})
+	var b benchmarkCaller = callers
+	if len(callers) == 1 {
+		b = callers[r.targets[0].resolved.protocol]
+	}
+	runBenchmark(r.out, r.logger, r.opts, r.resolved, req.Method, b)
 }
 
 // handleStreamRequest launches initial stream request and stream benchmark
 func (r requestHandler) handleStreamRequest() {
-	streamSerializer, ok := r.serializer.(encoding.StreamSerializer)
+	if len(r.targets) > 1 {
+		r.out.Fatalf("Streaming methods cannot be called using peers with mixed protocols\n")
+	}
+
+	target := r.targets[0]
+	streamSerializer, ok := target.serializer.(encoding.StreamSerializer)
 	if !ok {
-		r.out.Fatalf("Serializer does not support streaming: %v\n", r.serializer.Encoding())
+		r.out.Fatalf("Serializer does not support streaming: %v\n", target.serializer.Encoding())
 	}
 
 	streamReq, streamMsgReader, err := streamSerializer.StreamRequest(r.body)
@@ -88,15 +119,12 @@ func (r requestHandler) handleStreamRequest() {
 		r.out.Fatalf("Failed to create streaming request: %v\n", err)
 	}
 
-	streamReq.Request, err = prepareRequest(streamReq.Request, r.headers, r.opts)
-	if err != nil {
-		r.out.Fatalf("Failed while preparing the request: %v\n", err)
-	}
+	streamReq.Request = prepareRequest(streamReq.Request, r.headers, r.opts)
 
-	streamIO := newStreamIOInitializer(r.out, r.serializer, streamMsgReader)
+	streamIO := newStreamIOInitializer(r.out, target.serializer, streamMsgReader)
 
 	if r.shouldMakeInitialRequest() {
-		if err = makeStreamRequest(r.transport, streamReq, r.serializer, streamIO, r.opts.ROpts.StreamRequestOptions); err != nil {
+		if err = makeStreamRequest(context.Background(), target.transport, streamReq, target.serializer, streamIO, r.opts.ROpts.StreamRequestOptions); err != nil {
 			r.out.Fatalf("%v\n", err)
 		}
 	}
@@ -111,7 +139,7 @@ func (r requestHandler) handleStreamRequest() {
 	}
 
 	runBenchmark(r.out, r.logger, r.opts, r.resolved, streamReq.Request.Method, benchmarkStreamMethod{
-		serializer:            r.serializer,
+		serializer:            target.serializer,
 		streamRequest:         streamReq,
 		streamRequestMessages: streamRequests,
 		opts:                  r.opts.ROpts.StreamRequestOptions,
@@ -125,14 +153,14 @@ func (r requestHandler) shouldMakeInitialRequest() bool {
 
 // isStreamingMethod returns true if RPC is streaming type
 func (r requestHandler) isStreamingMethod() bool {
-	return r.serializer.MethodType() != encoding.Unary
+	return r.targets[0].serializer.MethodType() != encoding.Unary
 }
 
 // makeStreamRequest opens a stream rpc from the given transport and stream request
 // it then delegates to handler based on rpc type to handle request and response of the stream
 // nextBodyFn is called to get the next stream message body
 // responseHandlerFn is called with the response of the stream
-func makeStreamRequest(t transport.Transport, streamReq *transport.StreamRequest, serializer encoding.Serializer, streamIO StreamIO, opts StreamRequestOptions) error {
+func makeStreamRequest(ctx context.Context, t transport.Transport, streamReq *transport.StreamRequest, serializer encoding.Serializer, streamIO StreamIO, opts StreamRequestOptions) error {
 	streamTransport, ok := t.(transport.StreamTransport)
 	if !ok {
 		return fmt.Errorf("Transport does not support stream calls: %q", t.Protocol())
@@ -140,11 +168,23 @@ func makeStreamRequest(t transport.Transport, streamReq *transport.StreamRequest
 
 	// Uses tchannel context to remain compatible with tchannel transport
 	// although it does not support streaming, this needs to be removed later.
-	ctx, cancel := tchannel.NewContext(streamReq.Request.Timeout)
+	ctx, cancel := tchannel.NewContextBuilder(streamReq.Request.Timeout).SetParentContext(ctx).Build()
 	defer cancel()
 	ctx = makeContextWithTrace(ctx, t, streamReq.Request, 0)
 
-	stream, err := streamTransport.CallStream(ctx, streamReq)
+	streamReq, err := transport.InterceptStreamRequest(ctx, t, streamReq)
+	if err != nil {
+		return err
+	}
+
+	err = callStream(ctx, cancel, streamTransport, streamReq, serializer, streamIO, opts)
+	_, err = transport.ApplyResponseInterceptors(ctx, streamReq.Request, nil /* res */, err)
+	return err
+}
+
+// callStream opens the stream and handles it until the stream ends.
+func callStream(ctx context.Context, cancel context.CancelFunc, t transport.StreamTransport, streamReq *transport.StreamRequest, serializer encoding.Serializer, streamIO StreamIO, opts StreamRequestOptions) error {
+	stream, err := t.CallStream(ctx, streamReq)
 	if err != nil {
 		return fmt.Errorf("Failed while making stream call: %v", err)
 	}
@@ -23,21 +23,29 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/yarpc/yab/encoding"
 	"github.com/yarpc/yab/testdata/gen-go/integration"
 	testdataany "github.com/yarpc/yab/testdata/protobuf/any"
 	"github.com/yarpc/yab/testdata/protobuf/simple"
 	yintegration "github.com/yarpc/yab/testdata/yarpc/integration"
 	"github.com/yarpc/yab/testdata/yarpc/integration/fooserver"
+	"github.com/yarpc/yab/transport"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
@@ -56,6 +64,7 @@ import (
 	ytchan "go.uber.org/yarpc/transport/tchannel"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/status"
@@ -295,6 +304,78 @@ func TestIntegrationProtocols(t *testing.T) {
 	}
 }
 
+func TestIntegrationMixedProtocols(t *testing.T) {
+	tracer, closer := getTestTracerWithCredits(t, "foo", 5)
+	defer closer.Close()
+
+	ch := setupTChannelIntegrationServer(t, tracer)
+	defer ch.Close()
+
+	addr, dispatcher := setupYARPCHTTP(t, tracer, true /* enveloped */)
+	defer dispatcher.Stop()
+
+	opts := Options{
+		ROpts: RequestOptions{
+			ThriftFile:  "testdata/integration.thrift",
+			Procedure:   "Foo::bar",
+			Timeout:     timeMillisFlag(time.Second),
+			RequestJSON: `{"arg": 1}`,
+			Headers:     map[string]string{"headerkey": "headervalue"},
+			Baggage:     map[string]string{"baggagekey": "baggagevalue"},
+		},
+		TOpts: TransportOptions{
+			ServiceName: "foo",
+			Peers:       []string{"tchannel://" + ch.PeerInfo().HostPort, "http://" + addr.String()},
+			Jaeger:      true,
+		},
+	}
+
+	t.Run("request", func(t *testing.T) {
+		gotOut, gotErr := runTestWithOpts(opts)
+		assert.Empty(t, gotErr, "Unexpected error")
+		assert.Contains(t, gotOut, `"notFound": {}`, "Unexpected result")
+	})
+
+	t.Run("benchmark", func(t *testing.T) {
+		opts := opts
+		opts.BOpts = BenchmarkOptions{
+			MaxRequests: 20,
+			Connections: 2,
+			Concurrency: 1,
+			Format:      "json",
+		}
+
+		gotOut, gotErr := runTestWithOpts(opts)
+		require.Empty(t, gotErr, "Unexpected error")
+
+		var benchmarkOutput BenchmarkOutput
+		require.NoError(t, json.Unmarshal([]byte(gotOut[strings.Index(gotOut, "{\n  \"benchmarkParameters\""):]), &benchmarkOutput))
+		assert.Equal(t, []string{"tchannel", "http"}, benchmarkOutput.Parameters.Protocols, "Unexpected protocols")
+
+		// Benchmarks don't propagate baggage, so the servers fail every
+		// request with a protocol-specific error.
+		wantErrors := map[string]string{
+			"tchannel": "tchannel error",
+			"http":     "HTTP call got non-success response code",
+		}
+		var total int
+		for protocol, wantErr := range wantErrors {
+			summary := benchmarkOutput.Protocols[protocol]
+			require.NotNil(t, summary, "Missing results for %v", protocol)
+			// Requests are shared by connections, so the split between
+			// protocols depends on how fast each connection is.
+			assert.True(t, summary.TotalRequests > 0, "Connections should be split across %v peers", protocol)
+			require.NotNil(t, summary.ErrorSummary, "Missing errors for %v", protocol)
+			for msg := range summary.ErrorSummary.ErrorsCount {
+				assert.Contains(t, msg, wantErr, "Unexpected error for %v", protocol)
+			}
+			total += summary.TotalRequests
+		}
+		assert.Equal(t, 20, total, "Protocol results should add up to the max requests")
+		assert.Equal(t, benchmarkOutput.Summary.TotalRequests, total, "Protocol results should add up to the total")
+	})
+}
+
 // runTestWithOpts runs with the given options and returns the
 // output buffer, as well as the error buffer.
 func runTestWithOpts(opts Options) (string, string) {
@@ -330,6 +411,10 @@ func setupTChannelIntegrationServer(t *testing.T, tracer opentracing.Tracer) *tc
 }
 
 func setupHTTPIntegrationServer(t *testing.T, multiplexed bool) *httptest.Server {
+	return httptest.NewServer(httpIntegrationHandler(multiplexed))
+}
+
+func httpIntegrationHandler(multiplexed bool) http.Handler {
 	var processor athrift.TProcessor = integration.NewFooProcessor(httpHandler{})
 	protocolFactory := athrift.NewTBinaryProtocolFactoryDefault()
 
@@ -339,8 +424,377 @@ func setupHTTPIntegrationServer(t *testing.T, multiplexed bool) *httptest.Server
 		processor = multiProcessor
 	}
 
-	handler := athrift.NewThriftHandlerFunc(processor, protocolFactory, protocolFactory)
-	return httptest.NewServer(http.HandlerFunc(handler))
+	return http.HandlerFunc(athrift.NewThriftHandlerFunc(processor, protocolFactory, protocolFactory))
+}
+
+// setupHTTPSIntegrationServer starts a HTTPS server that requires clients
+// to present a certificate signed by the test CA.
+func setupHTTPSIntegrationServer(t *testing.T) *httptest.Server {
+	cert, err := tls.LoadX509KeyPair("testdata/tls/server.pem", "testdata/tls/server-key.pem")
+	require.NoError(t, err, "Failed to load server certificate")
+
+	caPEM, err := ioutil.ReadFile("testdata/tls/ca.pem")
+	require.NoError(t, err, "Failed to read CA")
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(caPEM), "Failed to parse CA")
+
+	server := httptest.NewUnstartedServer(httpIntegrationHandler(false /* multiplexed */))
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	return server
+}
+
+func TestIntegrationGRPCTLS(t *testing.T) {
+	cert, err := tls.LoadX509KeyPair("testdata/tls/server.pem", "testdata/tls/server-key.pem")
+	require.NoError(t, err, "Failed to load server certificate")
+
+	server := newGRPCServer(t, grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+	})))
+	defer server.Stop()
+
+	tests := []struct {
+		msg     string
+		tOpts   TransportOptions
+		bOpts   BenchmarkOptions
+		wantOut string
+		wantErr string
+	}{
+		{
+			msg:     "plaintext",
+			wantErr: "could not reach reflection server",
+		},
+		{
+			msg:     "TLS without CA",
+			tOpts:   TransportOptions{GRPCTLS: true},
+			wantErr: "could not reach reflection server",
+		},
+		{
+			msg:     "CA without gRPC TLS",
+			tOpts:   TransportOptions{TLS: TLSOptions{CAFile: "testdata/tls/ca.pem"}},
+			wantErr: "could not reach reflection server",
+		},
+		{
+			msg:     "TLS with CA",
+			tOpts:   TransportOptions{GRPCTLS: true, TLS: TLSOptions{CAFile: "testdata/tls/ca.pem"}},
+			wantOut: `"status": "SERVING"`,
+		},
+		{
+			msg:   "TLS with CA benchmark",
+			tOpts: TransportOptions{GRPCTLS: true, TLS: TLSOptions{CAFile: "testdata/tls/ca.pem"}},
+			bOpts: BenchmarkOptions{
+				MaxRequests: 10,
+				Connections: 2,
+				Concurrency: 1,
+			},
+			wantOut: "Total requests:                 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tOpts := tt.tOpts
+			tOpts.ServiceName = _grpcService
+			tOpts.Peers = []string{"grpc://" + server.HostPort()}
+
+			opts := Options{
+				ROpts: RequestOptions{
+					Procedure:   "grpc.health.v1.Health/Check",
+					Timeout:     timeMillisFlag(500 * time.Millisecond),
+					RequestJSON: `{"service": "` + _grpcService + `"}`,
+				},
+				TOpts: tOpts,
+				BOpts: tt.bOpts,
+			}
+
+			gotOut, gotErr := runTestWithOpts(opts)
+			assert.Contains(t, gotOut, tt.wantOut, "Unexpected output")
+			assert.Contains(t, gotErr, tt.wantErr, "Unexpected error")
+		})
+	}
+}
+
+func TestIntegrationHTTPREST(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Rpc-Service") != "" || r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"method": %q, "path": %q, "query": %q}`, r.Method, r.URL.Path, r.URL.RawQuery)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		msg     string
+		bOpts   BenchmarkOptions
+		wantOut string
+	}{
+		{
+			msg:     "one-off call",
+			wantOut: `"path": "/users/u1"`,
+		},
+		{
+			msg: "benchmark",
+			bOpts: BenchmarkOptions{
+				MaxRequests: 10,
+				Connections: 1,
+				Concurrency: 1,
+			},
+			wantOut: "Total requests:                 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			opts := Options{
+				ROpts: RequestOptions{
+					Procedure:   "/users/{id}",
+					Timeout:     timeMillisFlag(time.Second),
+					RequestJSON: `{"id": "u1", "verbose": true}`,
+					Headers:     map[string]string{"Authorization": "token"},
+				},
+				TOpts: TransportOptions{
+					Peers:      []string{server.URL},
+					HTTPMethod: "GET",
+					REST:       true,
+				},
+				BOpts: tt.bOpts,
+			}
+
+			gotOut, gotErr := runTestWithOpts(opts)
+			assert.Empty(t, gotErr, "Unexpected error")
+			assert.Contains(t, gotOut, tt.wantOut, "Unexpected output")
+			if tt.bOpts.MaxRequests == 0 {
+				assert.Contains(t, gotOut, `"query": "verbose=true"`, "Unexpected output")
+			}
+		})
+	}
+}
+
+func TestIntegrationCredentials(t *testing.T) {
+	var tokensIssued, unauthorized atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.FormValue("client_id") != "yab" || r.FormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			n := tokensIssued.Inc()
+			fmt.Fprintf(w, `{"access_token": "token-%v", "token_type": "bearer", "expires_in": 3600}`, n)
+			return
+		}
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-") {
+			unauthorized.Inc()
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"auth": %q}`, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		msg         string
+		credentials string
+		bOpts       BenchmarkOptions
+		wantOut     string
+		wantErr     string
+		wantTokens  int32
+	}{
+		{
+			msg:         "one-off call",
+			credentials: "oauth2+" + server.URL + "/token?client_id=yab",
+			wantOut:     `"auth": "Bearer token-1"`,
+			wantTokens:  1,
+		},
+		{
+			msg:         "benchmark",
+			credentials: "oauth2+" + server.URL + "/token?client_id=yab",
+			bOpts: BenchmarkOptions{
+				MaxRequests:    10,
+				WarmupRequests: 1,
+				Connections:    2,
+				Concurrency:    1,
+			},
+			wantOut:    "Total requests:                 10",
+			wantTokens: 1,
+		},
+		{
+			msg:         "token request fails",
+			credentials: "oauth2+" + server.URL + "/token?client_id=other",
+			wantErr:     "Failed while making call: failed while fetching credentials: failed to fetch OAuth2 token, status not OK: Unauthorized",
+		},
+		{
+			msg:         "unknown credential provider",
+			credentials: "ldap://token",
+			wantErr:     `Failed while parsing options: no credential provider available for scheme "ldap"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			tokensIssued.Store(0)
+			unauthorized.Store(0)
+
+			opts := Options{
+				ROpts: RequestOptions{
+					Procedure:   "/users/{id}",
+					Timeout:     timeMillisFlag(time.Second),
+					RequestJSON: `{"id": "u1"}`,
+					Credentials: tt.credentials,
+				},
+				TOpts: TransportOptions{
+					Peers:      []string{server.URL},
+					HTTPMethod: "GET",
+					REST:       true,
+				},
+				BOpts: tt.bOpts,
+			}
+
+			gotOut, gotErr := runTestWithOpts(opts)
+			assert.Contains(t, gotErr, tt.wantErr, "Unexpected error")
+			assert.Contains(t, gotOut, tt.wantOut, "Unexpected output")
+			assert.Equal(t, tt.wantTokens, tokensIssued.Load(), "tokens should be cached")
+			assert.Zero(t, unauthorized.Load(), "calls should not be made without a token")
+		})
+	}
+}
+
+func TestIntegrationHTTPErrorResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, `{"error": "overloaded"}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		msg          string
+		successCodes string
+		bOpts        BenchmarkOptions
+		wantOut      []string
+		wantErr      string
+	}{
+		{
+			msg: "error response is displayed",
+			wantOut: []string{
+				`"statusCode": 503`,
+				`"Retry-After": "10"`,
+				`"error": "overloaded"`,
+			},
+			wantErr: "non-success response code: 503",
+		},
+		{
+			msg:          "custom success codes",
+			successCodes: "200-299,503",
+			wantOut:      []string{`"statusCode": 503`},
+		},
+		{
+			msg: "benchmark counts errors by status code",
+			bOpts: BenchmarkOptions{
+				MaxRequests: 10,
+				Connections: 1,
+				Concurrency: 1,
+			},
+			wantOut: []string{"10: HTTP call got non-success response code: 503"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			opts := Options{
+				ROpts: RequestOptions{
+					Encoding:    encoding.JSON,
+					Procedure:   "method",
+					Timeout:     timeMillisFlag(time.Second),
+					RequestJSON: `{}`,
+				},
+				TOpts: TransportOptions{
+					ServiceName:      "foo",
+					Peers:            []string{server.URL},
+					HTTPSuccessCodes: tt.successCodes,
+				},
+				BOpts: tt.bOpts,
+			}
+
+			gotOut, gotErr := runTestWithOpts(opts)
+			for _, want := range tt.wantOut {
+				assert.Contains(t, gotOut, want, "Unexpected output")
+			}
+			if tt.wantErr == "" {
+				assert.Empty(t, gotErr, "Unexpected error")
+			} else {
+				assert.Contains(t, gotErr, tt.wantErr, "Unexpected error")
+			}
+		})
+	}
+}
+
+func TestIntegrationHTTPTLS(t *testing.T) {
+	server := setupHTTPSIntegrationServer(t)
+	defer server.Close()
+
+	clientTLS := TLSOptions{
+		CAFile:   "testdata/tls/ca.pem",
+		CertFile: "testdata/tls/client.pem",
+		KeyFile:  "testdata/tls/client-key.pem",
+	}
+
+	tests := []struct {
+		msg     string
+		tls     TLSOptions
+		bOpts   BenchmarkOptions
+		wantOut string
+		wantErr string
+	}{
+		{
+			msg:     "no TLS options",
+			wantErr: "certificate",
+		},
+		{
+			msg:     "mutual TLS",
+			tls:     clientTLS,
+			wantOut: `"result": 5`,
+		},
+		{
+			msg: "mutual TLS benchmark",
+			tls: clientTLS,
+			bOpts: BenchmarkOptions{
+				MaxRequests: 10,
+				Connections: 2,
+				Concurrency: 1,
+			},
+			wantOut: "Total requests:                 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			opts := Options{
+				ROpts: RequestOptions{
+					ThriftFile:  "testdata/integration.thrift",
+					Procedure:   "Foo::bar",
+					Timeout:     timeMillisFlag(time.Second),
+					RequestJSON: `{"arg": 5}`,
+				},
+				TOpts: TransportOptions{
+					ServiceName: "foo",
+					Peers:       []string{server.URL},
+					TLS:         tt.tls,
+				},
+				BOpts: tt.bOpts,
+			}
+
+			gotOut, gotErr := runTestWithOpts(opts)
+			assert.Contains(t, gotOut, tt.wantOut, "Unexpected output")
+			assert.Contains(t, gotErr, tt.wantErr, "Unexpected error")
+		})
+	}
 }
 
 func setupYARPCTChannel(t *testing.T, tracer opentracing.Tracer) (*tchannel.Channel, *yarpc.Dispatcher) {
@@ -504,6 +958,62 @@ func setupGRPCServer(t *testing.T, svc *simpleService) (net.Addr, *grpc.Server)
 	return ln.Addr(), s
 }
 
+func TestIntegrationGRPCCompression(t *testing.T) {
+	server := newGRPCServer(t)
+	defer server.Stop()
+
+	for _, compressor := range []string{"", "gzip"} {
+		t.Run("compressor "+compressor, func(t *testing.T) {
+			opts := Options{
+				ROpts: RequestOptions{
+					Procedure:   "grpc.health.v1.Health/Check",
+					Timeout:     timeMillisFlag(500 * time.Millisecond),
+					RequestJSON: `{"service": "` + _grpcService + `"}`,
+				},
+				TOpts: TransportOptions{
+					ServiceName:    _grpcService,
+					Peers:          []string{"grpc://" + server.HostPort()},
+					GRPCCompressor: compressor,
+				},
+				BOpts: BenchmarkOptions{
+					MaxRequests:    10,
+					Connections:    1,
+					Concurrency:    1,
+					WarmupRequests: 5,
+					Format:         "json",
+				},
+			}
+
+			gotOut, gotErr := runTestWithOpts(opts)
+			require.Empty(t, gotErr, "Unexpected error")
+
+			var benchmarkOutput BenchmarkOutput
+			require.NoError(t, json.Unmarshal([]byte(gotOut[strings.Index(gotOut, "{\n  \"benchmarkParameters\""):]), &benchmarkOutput))
+			assert.Equal(t, compressor, benchmarkOutput.Parameters.Compressor, "Unexpected compressor")
+
+			wire := benchmarkOutput.WireSummary
+			require.NotNil(t, wire, "gRPC benchmarks should report bytes on the wire")
+			assert.True(t, wire.BytesSentPerRequest > 0, "Expected bytes to be sent")
+			assert.True(t, wire.BytesReceivedPerRequest > 0, "Expected bytes to be received")
+			assert.Equal(t, 10*wire.BytesSentPerRequest, wire.TotalBytesSent, "Warmup requests should not be counted")
+		})
+	}
+
+	_, gotErr := runTestWithOpts(Options{
+		ROpts: RequestOptions{
+			Procedure:   "grpc.health.v1.Health/Check",
+			Timeout:     timeMillisFlag(500 * time.Millisecond),
+			RequestJSON: `{}`,
+		},
+		TOpts: TransportOptions{
+			ServiceName:    _grpcService,
+			Peers:          []string{"grpc://" + server.HostPort()},
+			GRPCCompressor: "zip",
+		},
+	})
+	assert.Contains(t, gotErr, `unknown gRPC compressor "zip"`)
+}
+
 func TestGRPCStreamBenchmark(t *testing.T) {
 	tests := []struct {
 		desc          string
@@ -1032,6 +1542,117 @@ test: 1
 	}
 }
 
+// countingInterceptor records the requests and results passed to it.
+type countingInterceptor struct {
+	requests  atomic.Int32
+	calls     atomic.Int32
+	responses atomic.Int32
+	errors    atomic.Int32
+}
+
+func (ri *countingInterceptor) Apply(_ context.Context, req *transport.Request) (*transport.Request, error) {
+	ri.requests.Inc()
+	return req, nil
+}
+
+func (ri *countingInterceptor) ApplyResponse(_ context.Context, _ *transport.Request, res *transport.Response, err error) (*transport.Response, error) {
+	ri.calls.Inc()
+	if res != nil {
+		ri.responses.Inc()
+	}
+	if err != nil {
+		ri.errors.Inc()
+	}
+	return res, err
+}
+
+func TestInterceptors(t *testing.T) {
+	thriftOpts := RequestOptions{
+		ThriftFile: validThrift,
+		Procedure:  fooMethod,
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		ri := &countingInterceptor{}
+		defer transport.RegisterInterceptor(ri)()
+
+		gotOut, gotErr := runTestWithOpts(Options{
+			ROpts: thriftOpts,
+			TOpts: TransportOptions{
+				ServiceName: "foo",
+				Peers:       []string{echoServer(t, fooMethod, nil)},
+			},
+		})
+		assert.Empty(t, gotErr)
+		assert.Contains(t, gotOut, "{}")
+		assert.EqualValues(t, 1, ri.requests.Load(), "unexpected intercepted requests")
+		assert.EqualValues(t, 1, ri.calls.Load(), "unexpected interceptor calls")
+		assert.EqualValues(t, 1, ri.responses.Load(), "unexpected responses")
+	})
+
+	t.Run("benchmark", func(t *testing.T) {
+		ri := &countingInterceptor{}
+		defer transport.RegisterInterceptor(ri)()
+
+		_, gotErr := runTestWithOpts(Options{
+			ROpts: thriftOpts,
+			TOpts: TransportOptions{
+				ServiceName: "foo",
+				Peers:       []string{echoServer(t, fooMethod, nil)},
+			},
+			BOpts: BenchmarkOptions{
+				MaxRequests:    10,
+				WarmupRequests: 2,
+				Connections:    1,
+				Concurrency:    1,
+			},
+		})
+		assert.Empty(t, gotErr)
+		// The initial request, warmup requests and benchmark requests are all intercepted.
+		assert.EqualValues(t, 13, ri.requests.Load(), "unexpected intercepted requests")
+		assert.EqualValues(t, 13, ri.calls.Load(), "unexpected interceptor calls")
+		assert.EqualValues(t, 13, ri.responses.Load(), "unexpected responses")
+	})
+
+	streamTests := []struct {
+		desc        string
+		returnError error
+		wantErrors  int32
+	}{
+		{desc: "stream"},
+		{desc: "stream error", returnError: errors.New("test error"), wantErrors: 1},
+	}
+	for _, tt := range streamTests {
+		t.Run(tt.desc, func(t *testing.T) {
+			ri := &countingInterceptor{}
+			defer transport.RegisterInterceptor(ri)()
+
+			addr, server := setupGRPCServer(t, &simpleService{
+				expectedInput: []simple.Foo{{}},
+				returnError:   tt.returnError,
+			})
+			defer server.Stop()
+
+			runTestWithOpts(Options{
+				ROpts: RequestOptions{
+					FileDescriptorSet: []string{"testdata/protobuf/simple/simple.proto.bin"},
+					Procedure:         "Bar/BidiStream",
+					Timeout:           timeMillisFlag(time.Second),
+					RequestJSON:       `{}`,
+				},
+				TOpts: TransportOptions{
+					ServiceName: "foo",
+					Peers:       []string{"grpc://" + addr.String()},
+				},
+			})
+			assert.EqualValues(t, 1, ri.requests.Load(), "stream request should be intercepted once")
+			assert.EqualValues(t, 1, ri.calls.Load(), "stream should be intercepted once")
+			assert.EqualValues(t, 0, ri.responses.Load(), "streams have no response")
+			assert.Equal(t, tt.wantErrors, ri.errors.Load(), "unexpected errors")
+		})
+	}
+}
+
 func TestGRPCStreamWithBoundedExecutionTime(t *testing.T) {
 	tests := []struct {
 		desc         string
@@ -1167,6 +1788,16 @@ func TestGRPCReflectionSource(t *testing.T) {
 			wantRes: `{
   "body": {
     "test": 1
+  },
+  "metadata": {
+    "content-type": [
+      "application/grpc"
+    ]
+  },
+  "trailers": {
+    "grpc-status": [
+      "0"
+    ]
   }
 }
 
@@ -1188,6 +1819,16 @@ func TestGRPCReflectionSource(t *testing.T) {
 			wantRes: `{
   "body": {
     "test": 1
+  },
+  "metadata": {
+    "content-type": [
+      "application/grpc"
+    ]
+  },
+  "trailers": {
+    "grpc-status": [
+      "0"
+    ]
   }
 }
 
@@ -1206,6 +1847,22 @@ func TestGRPCReflectionSource(t *testing.T) {
 					Peers:       []string{addr.String()},
 				},
 			},
+			wantRes: `{
+  "metadata": {},
+  "trailers": {
+    "content-type": [
+      "application/grpc"
+    ],
+    "grpc-message": [
+      "negative input"
+    ],
+    "grpc-status": [
+      "2"
+    ]
+  }
+}
+
+`,
 			wantErr: "Failed while making call: code:unknown message:negative input\n",
 		},
 		{
@@ -1221,6 +1878,22 @@ func TestGRPCReflectionSource(t *testing.T) {
 					Peers:       []string{addr.String()},
 				},
 			},
+			wantRes: `{
+  "metadata": {},
+  "trailers": {
+    "content-type": [
+      "application/grpc"
+    ],
+    "grpc-message": [
+      "invalid username"
+    ],
+    "grpc-status": [
+      "3"
+    ]
+  }
+}
+
+`,
 			wantErr: `Failed while making call: code:invalid-argument message:invalid username
 {
   "details": [
@@ -0,0 +1,90 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package execurl runs commands from exec URLs, such as
+// "exec:command args", which are used by the peer and credential providers.
+package execurl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// ErrNoCommand is returned for exec URLs without a command.
+var ErrNoCommand = errors.New("no command specified, expected exec:command [args...]")
+
+// Args returns the command and its arguments in an exec URL. The command
+// line is split on whitespace and isn't unquoted, so arguments that contain
+// whitespace or quotes are passed using repeated arg query parameters after
+// a host or path, e.g., exec:///path/to/command?arg=a%20b&arg=c. Each arg is
+// a single argument, added after any arguments in the command line.
+func Args(u *url.URL) ([]string, error) {
+	args := strings.Fields(command(u))
+	if len(args) == 0 {
+		return nil, ErrNoCommand
+	}
+
+	// The query of an opaque URL is part of the command line.
+	if u.Opaque == "" {
+		args = append(args, u.Query()["arg"]...)
+	}
+	return args, nil
+}
+
+// Run runs the command and returns its output. The description of the
+// command, such as "token", is used in errors, which include the command's
+// stderr output. If ctx is done before the command finishes, the command is
+// killed and the context error is returned.
+func Run(ctx context.Context, description string, args []string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("failed to run %v command %q: %v: %v", description, args[0], err, msg)
+		}
+		return nil, fmt.Errorf("failed to run %v command %q: %v", description, args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// command returns the command line in an exec URL. The command is usually
+// opaque (exec:command args), but may also be a host or path
+// (exec://command or exec:///path/to/command).
+func command(u *url.URL) string {
+	if u.Opaque == "" {
+		return u.Host + u.Path
+	}
+
+	// Anything after a "?" is parsed as the query.
+	if u.RawQuery != "" || u.ForceQuery {
+		return u.Opaque + "?" + u.RawQuery
+	}
+	return u.Opaque
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package execurl
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    []string
+		wantErr error
+	}{
+		{url: "exec:discovery-cli lookup svc", want: []string{"discovery-cli", "lookup", "svc"}},
+		{url: "exec:discovery-cli lookup svc?dc=1", want: []string{"discovery-cli", "lookup", "svc?dc=1"}},
+		{url: "exec:get-token --filter a?", want: []string{"get-token", "--filter", "a?"}},
+		{url: "exec://discovery-cli", want: []string{"discovery-cli"}},
+		{url: "exec:///usr/bin/discovery-cli", want: []string{"/usr/bin/discovery-cli"}},
+		{url: "exec:///usr/bin/discovery-cli?arg=lookup&arg=my%20svc&arg=%22q%22", want: []string{"/usr/bin/discovery-cli", "lookup", "my svc", `"q"`}},
+		{url: "exec://get-token?arg=a+b&other=ignored", want: []string{"get-token", "a b"}},
+		{url: "exec:get-token?arg=a", want: []string{"get-token?arg=a"}},
+		{url: "exec:", wantErr: ErrNoCommand},
+		{url: "exec:  ", wantErr: ErrNoCommand},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		require.NoError(t, err, "failed to parse %v", tt.url)
+
+		got, err := Args(u)
+		if tt.wantErr != nil {
+			assert.Equal(t, tt.wantErr, err, "unexpected error for %v", tt.url)
+			continue
+		}
+		if assert.NoError(t, err, "unexpected error for %v", tt.url) {
+			assert.Equal(t, tt.want, got, "unexpected args for %v", tt.url)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	out, err := Run(context.Background(), "test", []string{"echo", "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(out))
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		args    []string
+		timeout time.Duration
+		wantErr string
+	}{
+		{
+			msg:     "command not found",
+			args:    []string{"yab-missing-command"},
+			wantErr: `failed to run test command "yab-missing-command"`,
+		},
+		{
+			msg:     "command fails with stderr",
+			args:    []string{"ls", "/yab-missing-dir"},
+			wantErr: "yab-missing-dir",
+		},
+		{
+			msg:     "deadline exceeded",
+			args:    []string{"sleep", "5"},
+			timeout: 50 * time.Millisecond,
+			wantErr: `failed to run test command "sleep": context deadline exceeded`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			if tt.timeout == 0 {
+				tt.timeout = time.Second
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			_, err := Run(ctx, "test", tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -14,7 +14,8 @@
 //   {"userName": "John Doe"}
 //   {"user-name": "John Doe"}
 //
-// Note: It only adds aliases for top-level fields in the struct.
+// Note: It only adds aliases for top-level fields in the struct. Nested
+// structs can support aliases by calling Wrap from an UnmarshalYAML method.
 package yamlalias
 
 import (
@@ -37,6 +38,12 @@ func UnmarshalStrict(in []byte, out interface{}) error {
 	return yaml.UnmarshalStrict(in, addAliases(out))
 }
 
+// Wrap returns a value that can be passed to a YAML unmarshal function
+// which sets fields in dest, including any yaml-aliases.
+func Wrap(dest interface{}) interface{} {
+	return addAliases(dest)
+}
+
 // addAliases generates a new struct for unmarshalling that contains all exported
 // fields from the passed in struct, but also adds additional fields for any
 // aliases.
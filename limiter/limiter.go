@@ -24,7 +24,11 @@ func New(maxRequests, rps int, maxDuration time.Duration) *Run {
 	if rps > 0 {
 		limiter = ratelimit.New(rps)
 	}
+	return NewWithLimiter(maxRequests, limiter, maxDuration)
+}
 
+// NewWithLimiter returns a Run that uses the given rate limiter.
+func NewWithLimiter(maxRequests int, limiter ratelimit.Limiter, maxDuration time.Duration) *Run {
 	r := &Run{
 		unlimited:    *atomic.NewBool(maxRequests == 0),
 		requestsLeft: *atomic.NewInt64(int64(maxRequests)),
@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/yarpc/yab/ratelimit"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/uber/tchannel-go/testutils"
 )
@@ -33,6 +35,21 @@ func TestRateLimited(t *testing.T) {
 		"Second More elapsed is unexpected, expected 5ms < %v < 15ms", elapsed)
 }
 
+func TestNewWithLimiter(t *testing.T) {
+	run := NewWithLimiter(10 /* maxRequests */, ratelimit.NewTokenBucket(100 /* rps */, 5 /* burst */), time.Second)
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.True(t, run.More(), "Request %v should succeed", i)
+	}
+	assert.True(t, time.Since(started) < 5*time.Millisecond, "Burst should not be rate limited")
+
+	started = time.Now()
+	assert.True(t, run.More(), "Request after burst should succeed")
+	elapsed := time.Since(started)
+	assert.True(t, elapsed > 5*time.Millisecond && elapsed < 15*time.Millisecond,
+		"Request after burst elapsed is unexpected, expected 5ms < %v < 15ms", elapsed)
+}
+
 func TestParallel(t *testing.T) {
 	run := New(1000 /* maxRequests */, 100000 /* rps */, time.Second)
 
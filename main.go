@@ -30,10 +30,13 @@ import (
 	"log"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/yarpc/yab/credprovider"
 	"github.com/yarpc/yab/encoding"
 	"github.com/yarpc/yab/peerprovider"
+	"github.com/yarpc/yab/peerselect"
 	"github.com/yarpc/yab/plugin"
 	"github.com/yarpc/yab/transport"
 
@@ -288,6 +291,14 @@ func runWithOptions(opts Options, out output, logger *zap.Logger) {
 		}
 		return
 	}
+	if opts.ROpts.Credentials == "?" {
+		schemes := credprovider.Schemes()
+		sort.Strings(schemes)
+		for _, scheme := range schemes {
+			out.Printf("%s\n", scheme)
+		}
+		return
+	}
 
 	reqReader, err := getRequestInput(opts.ROpts.RequestJSON, opts.ROpts.RequestFile)
 	if err != nil {
@@ -315,22 +326,52 @@ func runWithOptions(opts Options, out output, logger *zap.Logger) {
 		opts.TOpts.CallerName = "yab-" + os.Getenv("USER")
 	}
 
-	protocolScheme, peers, err := loadTransportPeers(opts.TOpts)
+	peers, weights, err := loadTransportPeers(opts.TOpts)
 	if err != nil {
 		out.Fatalf("Failed to load peers: %v\n", err)
 	}
 
+	opts.TOpts.ResolvedPeerList = opts.TOpts.PeerList
 	opts.TOpts.PeerList = ""
 	opts.TOpts.Peers = peers
+	opts.TOpts.PeerWeights = weights
 
-	resolved := resolveProtocolEncoding(protocolScheme, opts.ROpts)
+	// REST procedures are paths, which should not be detected as Protobuf methods.
+	if opts.TOpts.REST && opts.ROpts.detectEncoding() == encoding.Protobuf && len(opts.ROpts.FileDescriptorSet) == 0 {
+		opts.ROpts.Encoding = encoding.JSON
+	}
 
-	serializer, err := NewSerializer(opts, resolved)
+	groups, err := groupPeersByProtocol(peers, opts.ROpts)
 	if err != nil {
-		out.Fatalf("Failed while parsing input: %v\n", err)
+		out.Fatalf("Failed to load peers: %v\n", err)
 	}
-	if serializerWithClose, ok := serializer.(io.Closer); ok {
-		defer serializerWithClose.Close()
+	if len(groups) > 1 {
+		groups, err = initialGroupFirst(groups, opts.TOpts)
+		if err != nil {
+			out.Fatalf("Failed while parsing options: %v\n", err)
+		}
+	}
+
+	// Serializers only depend on the protocol for Thrift envelopes, so
+	// protocols share a serializer unless they use different envelopes.
+	targets := make([]protocolTarget, len(groups))
+	serializers := make(map[bool]encoding.Serializer)
+	for i, g := range groups {
+		envelopes := g.resolved.enc == encoding.Thrift && thriftEnvelopes(opts.ROpts, g.resolved.protocol)
+		serializer, ok := serializers[envelopes]
+		if !ok {
+			groupOpts := opts
+			groupOpts.TOpts = g.transportOptions(opts.TOpts)
+			serializer, err = NewSerializer(groupOpts, g.resolved)
+			if err != nil {
+				out.Fatalf("Failed while parsing input: %v\n", err)
+			}
+			if serializerWithClose, ok := serializer.(io.Closer); ok {
+				defer serializerWithClose.Close()
+			}
+			serializers[envelopes] = serializer
+		}
+		targets[i] = protocolTarget{resolved: g.resolved, serializer: serializer}
 	}
 
 	tracer, closer := getTracer(opts, out)
@@ -339,24 +380,83 @@ func runWithOptions(opts Options, out output, logger *zap.Logger) {
 	}
 
 	// transport abstracts the underlying wire protocol used to make the call.
-	transport, err := getTransport(opts.TOpts, resolved, tracer)
+	for i, g := range groups {
+		targets[i].transport, err = getTransport(g.transportOptions(opts.TOpts), g.resolved, tracer)
+		if err != nil {
+			out.Fatalf("Failed while parsing options: %v\n", err)
+		}
+	}
+
+	// Benchmark connections to peers with a scheme use the protocol of the
+	// scheme, so they're created using the protocol of peers without one.
+	resolved := groups[0].resolved
+	if len(groups) > 1 {
+		resolved = resolveProtocolEncoding("", opts.ROpts)
+	}
+
+	retry, err := newRetryPolicy(opts.ROpts)
+	if err != nil {
+		out.Fatalf("Failed while parsing options: %v\n", err)
+	}
+
+	providerClient, err := opts.TOpts.providerClient()
+	if err != nil {
+		out.Fatalf("Failed while parsing options: %v\n", err)
+	}
+
+	auth, err := newAuthTokens(opts.ROpts, providerClient)
+	if err != nil {
+		out.Fatalf("Failed while parsing options: %v\n", err)
+	}
+	if auth != nil {
+		defer transport.RegisterInterceptor(auth)()
+	}
+
+	wire, err := newWireDumper(opts, out, logger)
 	if err != nil {
 		out.Fatalf("Failed while parsing options: %v\n", err)
 	}
 
 	handler := requestHandler{
-		out:        out,
-		logger:     logger,
-		opts:       opts,
-		transport:  transport,
-		resolved:   resolved,
-		serializer: serializer,
-		body:       reqReader,
-		headers:    headers,
+		out:      out,
+		logger:   logger,
+		opts:     opts,
+		targets:  targets,
+		resolved: resolved,
+		retry:    retry,
+		wire:     wire,
+		body:     reqReader,
+		headers:  headers,
 	}
 	handler.handle()
 }
 
+// initialGroupFirst moves the group of the peer chosen for the initial
+// request to the front, when peers use mixed protocols.
+func initialGroupFirst(groups []protocolGroup, opts TransportOptions) ([]protocolGroup, error) {
+	strategy := opts.PeerStrategy
+	if strategy == "" {
+		strategy = peerselect.Random
+	}
+	chooser, err := peerselect.New(strategy, opts.Peers, opts.PeerWeights)
+	if err != nil {
+		return nil, err
+	}
+
+	peer, done := chooser.Choose(opts.ShardKey)
+	done()
+
+	for i, g := range groups {
+		for _, p := range g.peers {
+			if p == peer {
+				groups[0], groups[i] = groups[i], groups[0]
+				return groups, nil
+			}
+		}
+	}
+	return groups, nil
+}
+
 func createJaegerTracer(opts Options, out output) (opentracing.Tracer, io.Closer) {
 	// yab must set the `SynchronousInitialization` flag to indicate that
 	// the Jaeger client must fetch debug credits synchronously. In a
@@ -409,20 +509,20 @@ type resolvedProtocolEncoding struct {
 func resolveProtocolEncoding(protocolScheme string, rOpts RequestOptions) resolvedProtocolEncoding {
 	enc := rOpts.detectEncoding()
 
-	switch protocolScheme {
-	case "tchannel":
+	switch schemeProtocol(protocolScheme) {
+	case transport.TChannel:
 		// TChannel is only really used with Thrift, so use that as the default.
 		if enc == encoding.UnspecifiedEncoding {
 			enc = encoding.Thrift
 		}
 		return resolvedProtocolEncoding{transport.TChannel, enc}
-	case "grpc":
+	case transport.GRPC:
 		// gRPC is expected to be used with protobuf, so use that as the default.
 		if enc == encoding.UnspecifiedEncoding {
 			enc = encoding.Protobuf
 		}
 		return resolvedProtocolEncoding{transport.GRPC, enc}
-	case "http", "https":
+	case transport.HTTP:
 		if enc == encoding.UnspecifiedEncoding {
 			enc = encoding.JSON
 		}
@@ -453,15 +553,20 @@ func resolveProtocolEncoding(protocolScheme string, rOpts RequestOptions) resolv
 
 // makeRequest makes a request using the given transport.
 func makeRequest(t transport.Transport, request *transport.Request) (*transport.Response, error) {
-	return makeRequestWithTracePriority(t, request, 0)
+	return makeRequestWithTracePriority(t, request, 0, nil /* record */)
 }
 
-func makeRequestWithTracePriority(t transport.Transport, request *transport.Request, trace uint16) (*transport.Response, error) {
+// makeRequestWithTracePriority makes a request using the given transport,
+// which is recorded on the wire if record is not nil.
+func makeRequestWithTracePriority(t transport.Transport, request *transport.Request, trace uint16, record transport.WireRecorder) (*transport.Response, error) {
 	ctx, cancel := tchannel.NewContext(request.Timeout)
 	defer cancel()
 
 	ctx = makeContextWithTrace(ctx, t, request, trace)
-	return t.Call(ctx, request)
+	if record != nil {
+		ctx = transport.WithWireRecorder(ctx, record)
+	}
+	return transport.Call(ctx, t, request)
 }
 
 func makeContextWithTrace(ctx context.Context, t transport.Transport, request *transport.Request, trace uint16) context.Context {
@@ -476,9 +581,23 @@ func makeContextWithTrace(ctx context.Context, t transport.Transport, request *t
 	return ctx
 }
 
-func makeInitialRequest(out output, transport transport.Transport, serializer encoding.Serializer, req *transport.Request) {
-	response, err := makeRequestWithTracePriority(transport, req, 1)
+func makeInitialRequest(out output, logger *zap.Logger, t transport.Transport, serializer encoding.Serializer, req *transport.Request, retry retryPolicy, record transport.WireRecorder) {
+	response, err := retry.call(logger, func() (*transport.Response, error) {
+		return makeRequestWithTracePriority(t, req, 1, record)
+	})
+	if statusErr, ok := asHTTPStatusError(err); ok {
+		// Error responses are displayed like any other response, but
+		// the call still fails.
+		printResponse(out, serializer, statusErr.Response, true /* lenient */)
+		out.Fatalf("Failed while making call: %v\n", statusErr)
+	}
 	if err != nil {
+		// Failed calls may still return transport fields, such as the
+		// trailers of a gRPC call, which help explain the failure.
+		if response != nil && len(response.TransportFields) > 0 {
+			printJSON(out, response.TransportFields)
+		}
+
 		buffer := bytes.NewBufferString(err.Error())
 
 		if errorSerializer, ok := serializer.(encoding.ProtoErrorDeserializer); ok {
@@ -501,10 +620,26 @@ func makeInitialRequest(out output, transport transport.Transport, serializer en
 		out.Fatalf("Failed while making call: %s\n", buffer.String())
 	}
 
+	printResponse(out, serializer, response, false /* lenient */)
+}
+
+func asHTTPStatusError(err error) (*transport.HTTPStatusError, bool) {
+	var statusErr *transport.HTTPStatusError
+	ok := errors.As(err, &statusErr)
+	return statusErr, ok
+}
+
+// printResponse prints the response body, headers and transport fields.
+// If lenient is set, bodies that cannot be deserialized are printed as
+// a string, since error responses often don't use the request encoding.
+func printResponse(out output, serializer encoding.Serializer, response *transport.Response, lenient bool) {
 	// responseMap converts the Thrift bytes response to a map.
 	responseMap, err := serializer.Response(response)
 	if err != nil {
-		out.Fatalf("Failed while parsing response: %v\n", err)
+		if !lenient {
+			out.Fatalf("Failed while parsing response: %v\n", err)
+		}
+		responseMap = string(response.Body)
 	}
 
 	// Print the initial output body.
@@ -517,9 +652,13 @@ func makeInitialRequest(out output, transport transport.Transport, serializer en
 	for k, v := range response.TransportFields {
 		outSerialized[k] = v
 	}
-	bs, err := json.MarshalIndent(outSerialized, "", "  ")
+	printJSON(out, outSerialized)
+}
+
+func printJSON(out output, m map[string]interface{}) {
+	bs, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
-		out.Fatalf("Failed to convert map to JSON: %v\nMap: %+v\n", err, responseMap)
+		out.Fatalf("Failed to convert map to JSON: %v\nMap: %+v\n", err, m)
 	}
 	out.Printf("%s\n\n", bs)
 }
@@ -22,6 +22,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -40,8 +41,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/uber/jaeger-client-go"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/raw"
 	"github.com/uber/tchannel-go/testutils"
 	"github.com/uber/tchannel-go/thrift"
+	"go.uber.org/atomic"
 	"go.uber.org/thriftrw/protocol"
 	"go.uber.org/thriftrw/wire"
 )
@@ -114,6 +118,21 @@ func TestRunWithOptions(t *testing.T) {
 			},
 			errMsg: "Failed while serializing the input: yaml: line 1: did not find expected ',' or '}'",
 		},
+		{
+			desc: "Invalid retry condition",
+			opts: Options{
+				ROpts: RequestOptions{
+					ThriftFile: validThrift,
+					Procedure:  fooMethod,
+					RetryOn:    "oops",
+				},
+				TOpts: TransportOptions{
+					ServiceName: "foo",
+					Peers:       []string{"1.1.1.1:1"},
+				},
+			},
+			errMsg: `Failed while parsing options: unknown retry condition "oops"`,
+		},
 		{
 			desc: "Invalid host:port, fail to make request",
 			opts: Options{
@@ -278,6 +297,61 @@ func TestRunWithOptions(t *testing.T) {
 	}
 }
 
+func TestListCredentialProviders(t *testing.T) {
+	gotOut, gotErr := runTestWithOpts(Options{
+		ROpts: RequestOptions{Credentials: "?"},
+	})
+	assert.Empty(t, gotErr)
+	assert.Equal(t, "exec\nfile\noauth2+http\noauth2+https\n", gotOut)
+}
+
+func TestRunWithOptionsRetries(t *testing.T) {
+	var calls atomic.Int32
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		if calls.Inc() <= 2 {
+			return nil, tchannel.NewSystemError(tchannel.ErrCodeBusy, "busy")
+		}
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	tests := []struct {
+		retries   int
+		wantCalls int32
+		wantErr   string
+	}{
+		{retries: 0, wantCalls: 1, wantErr: "busy"},
+		{retries: 1, wantCalls: 2, wantErr: "busy"},
+		{retries: 2, wantCalls: 3},
+		{retries: 5, wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.retries), func(t *testing.T) {
+			calls.Store(0)
+			gotOut, gotErr := runTestWithOpts(Options{
+				ROpts: RequestOptions{
+					ThriftFile:   validThrift,
+					Procedure:    fooMethod,
+					Retries:      tt.retries,
+					RetryBackoff: "1ms",
+					RetryOn:      "busy",
+				},
+				TOpts: s.transportOpts(),
+			})
+
+			assert.Equal(t, tt.wantCalls, calls.Load(), "Unexpected number of calls")
+			if tt.wantErr != "" {
+				assert.Contains(t, gotErr, tt.wantErr, "Expected final error")
+				return
+			}
+			assert.Empty(t, gotErr, "Unexpected error")
+			assert.Contains(t, gotOut, `"ok": true`, "Expected response")
+		})
+	}
+}
+
 func TestMainNoHeaders(t *testing.T) {
 	origArgs := os.Args
 	defer func() { os.Args = origArgs }()
@@ -1434,6 +1508,80 @@ func TestOptionsInheritance(t *testing.T) {
 	}
 }
 
+func TestBenchmarkOptionsInheritance(t *testing.T) {
+	originalConfigHome := os.Getenv(_configHomeEnv)
+	defer os.Setenv(_configHomeEnv, originalConfigHome)
+
+	xdgBase, err := ioutil.TempDir("", "options")
+	require.NoError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(xdgBase)
+	os.Setenv(_configHomeEnv, xdgBase)
+
+	tests := []struct {
+		msg  string
+		args []string
+		yaml string
+		want BenchmarkOptions
+	}{
+		{
+			msg: "flag defaults",
+			want: BenchmarkOptions{
+				WarmupRequests: 10,
+				Concurrency:    1,
+				Arrival:        "uniform",
+			},
+		},
+		{
+			msg: "template overrides flag defaults",
+			yaml: `
+benchmark:
+  max-duration: 5s
+  rps: 100
+  warmup: 0
+  concurrency: 4
+  arrival: poisson
+`,
+			want: BenchmarkOptions{
+				MaxDuration:    5 * time.Second,
+				RPS:            100,
+				WarmupRequests: 0,
+				Concurrency:    4,
+				Arrival:        "poisson",
+			},
+		},
+		{
+			msg: "flags override template",
+			yaml: `
+benchmark:
+  maxDuration: 5s
+  rps: 100
+  warmup: 0
+  format: json
+`,
+			args: []string{"-d", "1s", "--warmup", "5", "--concurrency", "2"},
+			want: BenchmarkOptions{
+				MaxDuration:    time.Second,
+				RPS:            100,
+				WarmupRequests: 5,
+				Concurrency:    2,
+				Arrival:        "uniform",
+				Format:         "json",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, _, out := getOutput(t)
+
+			args := append(tt.args, "-y", writeFile(t, "yaml", tt.yaml))
+			opts, err := getOptions(args, out)
+			require.NoError(t, err, "getOptions failed")
+			assert.Equal(t, tt.want, opts.BOpts)
+		})
+	}
+}
+
 func TestIsYabTemplate(t *testing.T) {
 	tests := []struct {
 		msg  string
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/ratelimit"
 )
 
 // Options are parsed from flags using go-flags.
@@ -34,6 +35,8 @@ type Options struct {
 	TOpts          TransportOptions `group:"transport"`
 	BOpts          BenchmarkOptions `group:"benchmark"`
 	Verbosity      []bool           `short:"v" description:"Enable more detailed logging. Repeats increase the verbosity, ie. -vvv"`
+	DumpWire       string           `long:"dump-wire" description:"Directory to write the raw bytes sent and received by each request to, along with its headers, timing and peer. Benchmark and streaming requests are not written."`
+	Hexdump        bool             `long:"hexdump" description:"Print a hex dump of the raw bytes sent and received by each request. Requires -v."`
 	DisplayVersion bool             `long:"version" description:"Displays the application version"`
 	ManPage        bool             `long:"man-page" hidden:"yes" description:"Print yab's man page to stdout"`
 }
@@ -56,6 +59,15 @@ type RequestOptions struct {
 	YamlTemplate      string            `short:"y" long:"yaml-template" description:"Send a tchannel request specified by a YAML template"`
 	TemplateArgs      map[string]string `short:"A" long:"arg" description:"A list of key-value template arguments, specified as -A foo:bar -A user:me"`
 
+	// Retry options
+	Retries      int    `long:"retries" description:"The number of times to retry a failed request. Retries are only made for single requests, not benchmarks."`
+	RetryBackoff string `long:"retry-backoff" description:"How long to wait between retries, either a duration or a range such as 100ms..2s, which doubles after each retry. Defaults to 100ms..2s."`
+	RetryOn      string `long:"retry-on" description:"Comma-separated errors to retry: YARPC error codes (e.g. unavailable), TChannel error codes (e.g. busy), HTTP status codes and ranges (e.g. 503, 500-599), or timeout. Defaults to unavailable,timeout."`
+
+	// Credential options
+	Credentials       string `long:"credentials" description:"Path or URL of a credential provider for an auth token, which is refreshed before it expires. E.g., a token file, exec:get-token, or an OAuth2 client credentials token URL such as oauth2+https://host/token?client_id=yab. --credentials=? for supported protocols."`
+	CredentialsHeader string `long:"credentials-header" description:"The header the auth token is sent in. Defaults to Authorization."`
+
 	// Thrift options
 	ThriftDisableEnvelopes bool `long:"disable-thrift-envelope" description:"Disables Thrift envelopes (disabled by default for TChannel and gRPC)"`
 	ThriftMultiplexed      bool `long:"multiplexed-thrift" description:"Enables the Thrift TMultiplexedProtocol used by services that host multiple Thrift services on a single endpoint."`
@@ -85,15 +97,37 @@ type TransportOptions struct {
 	ServiceName         string            `short:"s" long:"service" description:"The TChannel/Hyperbahn service name"`
 	Peers               []string          `short:"p" long:"peer" description:"The host:port of the service to call"`
 	PeerList            string            `short:"P" long:"peer-list" description:"Path or URL of a JSON, YAML, or flat file containing a list of host:ports. -P? for supported protocols."`
+	PeerListTimeout     timeMillisFlag    `long:"peer-list-timeout" default-mask:"1s" description:"The timeout for resolving the peer list (-P), including each --peer-refresh. E.g., 500ms, 5s. If no unit is specified, milliseconds are assumed."`
 	CallerName          string            `long:"caller" description:"Caller will override the default caller name (which is yab-$USER)."`
 	RoutingKey          string            `long:"rk" description:"The routing key overrides the service name traffic group for proxies."`
 	RoutingDelegate     string            `long:"rd" description:"The routing delegate overrides the routing key traffic group for proxies."`
 	ShardKey            string            `long:"sk" description:"The shard key is a transport header that clues where to send a request within a clustered traffic group."`
 	Jaeger              bool              `long:"jaeger" description:"Use the Jaeger tracing client to send Uber style traces and baggage headers"`
-	TransportHeaders    map[string]string `short:"T" long:"topt" description:"Transport options for TChannel, protocol headers for HTTP"`
+	TransportHeaders    map[string]string `short:"T" long:"topt" description:"Transport options for TChannel, protocol headers for HTTP, and raw metadata for unary gRPC calls"`
 	HTTPMethod          string            `long:"http-method" description:"The HTTP method to use"`
+	HTTPSuccessCodes    string            `long:"http-success-codes" description:"Comma-separated HTTP status codes and ranges treated as a success, e.g. 200-299,404. Defaults to 200-299."`
+	HTTP2               bool              `long:"http2" description:"Use HTTP/2 with prior knowledge (h2c) for http URLs. HTTP/2 is always negotiated using ALPN for https URLs"`
+	REST                bool              `long:"rest" description:"Call HTTP peers as a REST API. The procedure is a path such as /users/{id}, filled in from request fields, with the remaining fields sent as query parameters for GET requests. YARPC headers are not sent, and headers are not prefixed."`
 	GRPCMaxResponseSize int               `long:"grpc-max-response-size" description:"Maximum response size for gRPC requests. Default value is 4MB"`
+	GRPCMaxRequestSize  int               `long:"grpc-max-request-size" description:"Maximum request size for gRPC requests. There is no limit by default"`
+	GRPCCompressor      string            `long:"grpc-compressor" description:"Compress gRPC requests using a registered compressor, such as gzip. Compressed responses are always accepted."`
 	ForceJaegerSample   bool              `long:"force-jaeger-sample" description:"Force all requests to be sampled for Jaeger tracing (use with --jaeger)"`
+	GRPCTLS             bool              `long:"grpc-tls" description:"Use TLS for gRPC peers, and when fetching descriptors using gRPC reflection. The --tls-* options also apply to gRPC peers."`
+	PeerStrategy        string            `long:"peer-strategy" description:"How peers are chosen for HTTP requests and benchmark connections: round-robin, random, least-pending, consistent-hash (on the shard key) or weighted (using peer list weights, such as SRV record weights). Defaults to random for HTTP requests, and round-robin for benchmark connections unless the peer list has weights."`
+	PeerFilter          []string          `long:"peer-filter" description:"Only use peers from the peer list with the given metadata, such as zone=us-east. Can be specified multiple times, and peers must match every filter."`
+	PeerSample          int               `long:"peer-sample" description:"Use N peers chosen at random from the peer list, after filtering. The default (0) uses every peer."`
+	Proxy               string            `long:"proxy" description:"URL of an HTTP (http://host:port) or SOCKS5 (socks5://host:port) proxy used to reach peers of all transports. HTTP peers use HTTP_PROXY, HTTPS_PROXY and NO_PROXY by default."`
+	TLS                 TLSOptions
+
+	// PeerWeights are the weights of Peers from peer list metadata, such as
+	// DNS SRV record weights, used by the weighted and consistent-hash
+	// strategies. It's not set by a flag.
+	PeerWeights []int
+
+	// ResolvedPeerList is the peer list that Peers were resolved from, which
+	// is resolved again by --peer-refresh. It's not set by a flag.
+	ResolvedPeerList string
+
 	// This is a hack to work around go-flags not allowing disabling flags:
 	// https://github.com/jessevdk/go-flags/issues/191
 	// Do not specify this value in a defaults.ini file as it is not possible
@@ -102,18 +136,36 @@ type TransportOptions struct {
 	NoJaeger bool `long:"no-jaeger" hidden:"true"`
 }
 
+// TLSOptions are TLS options for outbound connections.
+type TLSOptions struct {
+	CAFile             string `long:"tls-ca" description:"Path of a PEM file with the certificate authorities used to verify HTTPS and gRPC peers. Defaults to the system's certificate authorities."`
+	CertFile           string `long:"tls-cert" description:"Path of a PEM client certificate to present to HTTPS and gRPC peers for mutual TLS"`
+	KeyFile            string `long:"tls-key" description:"Path of the PEM private key for --tls-cert"`
+	ServerName         string `long:"tls-server-name" description:"The server name used to verify the peer's certificate and sent as SNI. Defaults to the peer's host."`
+	InsecureSkipVerify bool   `long:"tls-insecure-skip-verify" description:"Skip verification of the peer's certificate"`
+}
+
 // BenchmarkOptions are benchmark-specific options
 type BenchmarkOptions struct {
-	MaxRequests int           `short:"n" long:"max-requests" default:"0" description:"The maximum number of requests to make. 0 implies no limit."`
-	MaxDuration time.Duration `short:"d" long:"max-duration" default:"0s" description:"The maximum amount of time to run the benchmark for. 0 implies no duration limit."`
+	MaxRequests int           `short:"n" long:"max-requests" default-mask:"0" description:"The maximum number of requests to make. 0 implies no limit."`
+	MaxDuration time.Duration `short:"d" long:"max-duration" default-mask:"0s" description:"The maximum amount of time to run the benchmark for. 0 implies no duration limit."`
 
 	// NumCPUs is the value for GOMAXPROCS. The default value of 0 will not update GOMAXPROCS.
 	NumCPUs int `long:"cpus" description:"The number of OS threads"`
 
-	Connections    int `long:"connections" description:"The number of TCP connections to use"`
-	WarmupRequests int `long:"warmup" description:"The number of requests to make to warmup each connection" default:"10"`
-	Concurrency    int `long:"concurrency" default:"1" description:"The number of concurrent calls per connection"`
-	RPS            int `long:"rps" default:"0" description:"Limit on the number of requests per second. The default (0) is no limit."`
+	Connections    int    `long:"connections" description:"The number of TCP connections to use"`
+	WarmupRequests int    `long:"warmup" description:"The number of requests to make to warmup each connection" default-mask:"10"`
+	Concurrency    int    `long:"concurrency" default-mask:"1" description:"The number of concurrent calls per connection"`
+	RPS            int    `long:"rps" default-mask:"0" description:"Limit on the number of requests per second. The default (0) is no limit."`
+	Arrival        string `long:"arrival" default-mask:"uniform" description:"The distribution of request arrivals when --rps is set: uniform, poisson, or burst."`
+	Burst          int    `long:"burst" description:"The maximum number of requests sent at once with --arrival burst. Defaults to the RPS."`
+	ArrivalSeed    int64  `long:"arrival-seed" description:"The seed for --arrival poisson, so runs are reproducible. The default (0) uses a random seed, which is reported in the benchmark parameters."`
+	ReconnectEvery int    `long:"reconnect-every" description:"Create a new connection after every N requests on each concurrent caller, reporting connection setup latency separately. The default (0) reuses connections for the whole benchmark."`
+
+	PeerRefresh time.Duration `long:"peer-refresh" description:"How often to resolve the peer list (-P) again during the benchmark, e.g. 30s. Connections to removed peers are drained and moved to the current peers. The default (0) only resolves the peer list once."`
+
+	TraceSampleRate float64 `long:"trace-sample-rate" description:"The fraction of unary benchmark requests to trace using Jaeger, e.g. 0.001. Traced requests are sent with a sampling priority, and the slowest are listed in the report."`
+	Hedge           string  `long:"hedge" description:"Hedge unary benchmark requests by sending a duplicate to a different peer if a request hasn't completed after a delay, either a duration such as 20ms or a percentile of observed latencies such as p95. The first successful response wins."`
 
 	// Benchmark metrics can optionally be reported via statsd.
 	StatsdHostPort string `long:"statsd" description:"Optional host:port of a StatsD server to report metrics"`
@@ -126,8 +178,15 @@ func newOptions() *Options {
 
 	// Defaults
 	opts.ROpts.Timeout = timeMillisFlag(time.Second)
+	opts.TOpts.PeerListTimeout = timeMillisFlag(time.Second)
 	opts.TOpts.HTTPMethod = "POST"
 
+	// Benchmark defaults are set here rather than using default tags, since
+	// go-flags would reset values set by YAML templates to the tag defaults.
+	opts.BOpts.WarmupRequests = 10
+	opts.BOpts.Concurrency = 1
+	opts.BOpts.Arrival = ratelimit.Uniform
+
 	// Set flag aliases
 	opts.ROpts.MethodName.dest = &opts.ROpts.Procedure
 	aliases := &opts.ROpts.Aliases
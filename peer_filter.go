@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/yarpc/yab/peerprovider"
+)
+
+var errNegativePeerSample = errors.New("peer-sample cannot be negative")
+
+// selectPeers returns the peers that match the peer filter, sampled if a
+// peer sample size is set. Peers in prefer are sampled first, so a sample
+// of a refreshed peer list changes as little as possible.
+func selectPeers(peers []peerprovider.Peer, opts TransportOptions, prefer []string) ([]peerprovider.Peer, error) {
+	if opts.PeerSample < 0 {
+		return nil, errNegativePeerSample
+	}
+
+	filter, err := parsePeerFilter(opts.PeerFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(filter) > 0 {
+		peers = filterPeers(peers, filter)
+		if len(peers) == 0 {
+			return nil, fmt.Errorf("no peers match the peer filter: %v", strings.Join(opts.PeerFilter, ", "))
+		}
+	}
+
+	return samplePeers(peers, opts.PeerSample, prefer), nil
+}
+
+// parsePeerFilter parses filters such as zone=us-east into the tags that
+// peers must have.
+func parsePeerFilter(filters []string) (map[string]string, error) {
+	tags := make(map[string]string, len(filters))
+	for _, f := range filters {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid peer filter %q, expected key=value", f)
+		}
+		tags[parts[0]] = parts[1]
+	}
+	return tags, nil
+}
+
+// filterPeers returns the peers that have all of the tags.
+func filterPeers(peers []peerprovider.Peer, tags map[string]string) []peerprovider.Peer {
+	var filtered []peerprovider.Peer
+	for _, p := range peers {
+		if hasPeerTags(p, tags) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+func hasPeerTags(p peerprovider.Peer, tags map[string]string) bool {
+	for k, v := range tags {
+		if tag, ok := p.Tags[k]; !ok || tag != v {
+			return false
+		}
+	}
+	return true
+}
+
+// samplePeers returns n of the peers chosen at random, in the order of the
+// peer list, preferring peers in prefer. All peers are returned if n is 0.
+func samplePeers(peers []peerprovider.Peer, n int, prefer []string) []peerprovider.Peer {
+	if n <= 0 || n >= len(peers) {
+		return peers
+	}
+
+	preferred := make(map[string]bool, len(prefer))
+	for _, p := range prefer {
+		preferred[p] = true
+	}
+
+	order := rand.Perm(len(peers))
+	sort.SliceStable(order, func(i, j int) bool {
+		return preferred[peers[order[i]].HostPort] && !preferred[peers[order[j]].HostPort]
+	})
+
+	chosen := make([]bool, len(peers))
+	for _, i := range order[:n] {
+		chosen[i] = true
+	}
+
+	sampled := make([]peerprovider.Peer, 0, n)
+	for i, p := range peers {
+		if chosen[i] {
+			sampled = append(sampled, p)
+		}
+	}
+	return sampled
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/yarpc/yab/peerprovider"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _testTaggedPeers = []peerprovider.Peer{
+	{HostPort: "1.1.1.1:1", Weight: 3, Tags: map[string]string{"zone": "us-east", "version": "1.2"}},
+	{HostPort: "2.2.2.2:2", Weight: 1, Tags: map[string]string{"zone": "us-west", "version": "1.2"}},
+	{HostPort: "3.3.3.3:3", Weight: 1, Tags: map[string]string{"zone": "us-east", "version": "1.3"}},
+	{HostPort: "4.4.4.4:4"},
+}
+
+func TestSelectPeers(t *testing.T) {
+	tests := []struct {
+		msg     string
+		opts    TransportOptions
+		want    []string
+		wantErr string
+	}{
+		{
+			msg:  "no filter",
+			want: []string{"1.1.1.1:1", "2.2.2.2:2", "3.3.3.3:3", "4.4.4.4:4"},
+		},
+		{
+			msg:  "filter by zone",
+			opts: TransportOptions{PeerFilter: []string{"zone=us-east"}},
+			want: []string{"1.1.1.1:1", "3.3.3.3:3"},
+		},
+		{
+			msg:  "filter by zone and version",
+			opts: TransportOptions{PeerFilter: []string{"zone=us-east", "version=1.2"}},
+			want: []string{"1.1.1.1:1"},
+		},
+		{
+			msg:  "sample larger than peers",
+			opts: TransportOptions{PeerFilter: []string{"version=1.2"}, PeerSample: 5},
+			want: []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			msg:     "no matching peers",
+			opts:    TransportOptions{PeerFilter: []string{"zone=eu-west"}},
+			wantErr: "no peers match the peer filter: zone=eu-west",
+		},
+		{
+			msg:     "invalid filter",
+			opts:    TransportOptions{PeerFilter: []string{"zone"}},
+			wantErr: `invalid peer filter "zone", expected key=value`,
+		},
+		{
+			msg:     "filter without key",
+			opts:    TransportOptions{PeerFilter: []string{"=us-east"}},
+			wantErr: `invalid peer filter "=us-east", expected key=value`,
+		},
+		{
+			msg:     "negative sample",
+			opts:    TransportOptions{PeerSample: -1},
+			wantErr: errNegativePeerSample.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			got, err := selectPeers(_testTaggedPeers, tt.opts, nil /* prefer */)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			peers, _ := splitPeerWeights(got)
+			assert.Equal(t, tt.want, peers)
+		})
+	}
+}
+
+func TestSamplePeers(t *testing.T) {
+	rand.Seed(1)
+	for i := 0; i < 10; i++ {
+		sampled := samplePeers(_testTaggedPeers, 2, nil /* prefer */)
+		require.Len(t, sampled, 2)
+		assert.Subset(t, _testTaggedPeers, sampled, "Sampled peers should be from the peer list")
+
+		// Sampled peers are in the order of the peer list.
+		first, second := -1, -1
+		for j, p := range _testTaggedPeers {
+			if p.HostPort == sampled[0].HostPort {
+				first = j
+			}
+			if p.HostPort == sampled[1].HostPort {
+				second = j
+			}
+		}
+		assert.True(t, first < second, "Sampled peers should be in peer list order: %v", sampled)
+	}
+
+	sampled := samplePeers(_testTaggedPeers, 2, []string{"4.4.4.4:4", "2.2.2.2:2", "5.5.5.5:5"})
+	peers, _ := splitPeerWeights(sampled)
+	assert.Equal(t, []string{"2.2.2.2:2", "4.4.4.4:4"}, peers, "Preferred peers should be sampled first")
+
+	sampled = samplePeers(_testTaggedPeers, 2, []string{"3.3.3.3:3"})
+	peers, _ = splitPeerWeights(sampled)
+	assert.Contains(t, peers, "3.3.3.3:3", "Preferred peer should be sampled")
+
+	assert.Equal(t, _testTaggedPeers, samplePeers(_testTaggedPeers, 0, nil), "All peers should be used without a sample size")
+}
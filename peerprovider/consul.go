@@ -0,0 +1,161 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package peerprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yarpc/yab/internal/httpclient"
+)
+
+const (
+	_consulTokenEnv       = "CONSUL_HTTP_TOKEN"
+	_consulTokenHeader    = "X-Consul-Token"
+	_consulPassingStatus  = "passing"
+	_consulHealthEndpoint = "/v1/health/service/"
+	_consulHTTPSScheme    = "consul+https"
+)
+
+var errConsulServiceRequired = errors.New("consul peer provider URLs must specify a service, e.g., consul://agent:8500/service")
+
+// consulPeerProvider resolves the passing instances of a service using the
+// health API of a Consul agent, e.g., consul://agent:8500/service. Agents
+// that serve the API over HTTPS use consul+https://agent:8501/service.
+// Instances can be filtered using the tag and dc query parameters, and the
+// ACL token is read from CONSUL_HTTP_TOKEN.
+type consulPeerProvider struct{}
+
+// consulServiceEntry is an entry returned by the Consul health API.
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Weights struct {
+			Passing int
+		}
+	}
+	Checks []struct {
+		Status string
+	}
+}
+
+func (p consulPeerProvider) Resolve(ctx context.Context, u *url.URL) ([]string, error) {
+	return hostPorts(p.ResolvePeers(ctx, u))
+}
+
+func (consulPeerProvider) ResolvePeers(ctx context.Context, u *url.URL) ([]Peer, error) {
+	service := strings.Trim(u.Path, "/")
+	if service == "" {
+		return nil, errConsulServiceRequired
+	}
+
+	req, err := http.NewRequest("GET", consulHealthURL(u, service), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if token := os.Getenv(_consulTokenEnv); token != "" {
+		req.Header.Set(_consulTokenHeader, token)
+	}
+
+	resp, err := httpclient.FromContext(ctx).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Consul for service %q: %v", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query Consul for service %q, status not OK: %v", service, http.StatusText(resp.StatusCode))
+	}
+
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to parse Consul response for service %q: %v", service, err)
+	}
+
+	var peers []Peer
+	for _, e := range entries {
+		if !e.passing() {
+			continue
+		}
+
+		// The service address defaults to the address of its node.
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		peers = append(peers, Peer{
+			HostPort: net.JoinHostPort(host, strconv.Itoa(e.Service.Port)),
+			// Agents before Consul 1.2.3 don't return weights.
+			Weight:    e.Service.Weights.Passing,
+			HasWeight: e.Service.Weights.Passing > 0,
+		})
+	}
+	return peers, nil
+}
+
+// passing returns whether all of the instance's health checks are passing.
+// The agent only returns these instances, but we don't rely on it.
+func (e consulServiceEntry) passing() bool {
+	for _, c := range e.Checks {
+		if c.Status != _consulPassingStatus {
+			return false
+		}
+	}
+	return true
+}
+
+// consulHealthURL returns the URL of the health API for the service using
+// the tag and dc filters of the peer provider URL.
+func consulHealthURL(u *url.URL, service string) string {
+	params := u.Query()
+	query := url.Values{"passing": {"true"}}
+	if tags, ok := params["tag"]; ok {
+		query["tag"] = tags
+	}
+	if dc := params.Get("dc"); dc != "" {
+		query.Set("dc", dc)
+	}
+
+	scheme := "http"
+	if u.Scheme == _consulHTTPSScheme {
+		scheme = "https"
+	}
+
+	health := url.URL{
+		Scheme:   scheme,
+		Host:     u.Host,
+		Path:     _consulHealthEndpoint + service,
+		RawQuery: query.Encode(),
+	}
+	return health.String()
+}
@@ -0,0 +1,275 @@
+package peerprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/internal/httpclient"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConsulInstance is an instance of a service registered with
+// fakeConsulAgent.
+type fakeConsulInstance struct {
+	node    string
+	address string
+	port    int
+	weight  int
+	tags    []string
+	dc      string
+	status  string
+}
+
+// fakeConsulAgent imitates the health API of a Consul agent. It returns
+// instances that don't pass their checks unless ?passing is set.
+type fakeConsulAgent struct {
+	instances map[string][]fakeConsulInstance
+	requests  []*http.Request
+}
+
+func (a *fakeConsulAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.requests = append(a.requests, r)
+	if !strings.HasPrefix(r.URL.Path, "/v1/health/service/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	dc := query.Get("dc")
+	if dc == "" {
+		dc = "dc1"
+	}
+	service := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+
+	entries := []interface{}{}
+	for _, inst := range a.instances[service] {
+		if inst.dc != dc || !hasTags(inst.tags, query["tag"]) {
+			continue
+		}
+		if query.Get("passing") != "" && inst.status != "passing" {
+			continue
+		}
+
+		entries = append(entries, map[string]interface{}{
+			"Node": map[string]interface{}{"Node": inst.node, "Address": inst.node},
+			"Service": map[string]interface{}{
+				"Service": service,
+				"Address": inst.address,
+				"Port":    inst.port,
+				"Tags":    inst.tags,
+				"Weights": map[string]int{"Passing": inst.weight, "Warning": 1},
+			},
+			"Checks": []map[string]string{
+				{"CheckID": "serfHealth", "Status": "passing"},
+				{"CheckID": "service:" + service, "Status": inst.status},
+			},
+		})
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+func hasTags(tags, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, t := range tags {
+			found = found || t == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func newFakeConsulAgent(t *testing.T) (*fakeConsulAgent, string) {
+	agent := &fakeConsulAgent{
+		instances: map[string][]fakeConsulInstance{
+			"kv": {
+				{node: "10.0.0.1", address: "10.1.0.1", port: 8080, weight: 10, tags: []string{"prod"}, dc: "dc1", status: "passing"},
+				{node: "10.0.0.2", port: 8081, weight: 5, tags: []string{"prod"}, dc: "dc1", status: "passing"},
+				{node: "10.0.0.3", address: "10.1.0.3", port: 8082, weight: 1, tags: []string{"staging"}, dc: "dc1", status: "passing"},
+				{node: "10.0.0.4", address: "10.1.0.4", port: 8083, weight: 1, tags: []string{"prod"}, dc: "dc1", status: "critical"},
+				{node: "10.0.0.5", address: "10.1.0.5", port: 8084, weight: 1, tags: []string{"prod"}, dc: "dc2", status: "passing"},
+			},
+		},
+	}
+	svr := httptest.NewServer(agent)
+	t.Cleanup(svr.Close)
+
+	u, err := url.Parse(svr.URL)
+	require.NoError(t, err, "failed to parse server URL")
+	return agent, u.Host
+}
+
+func resolveConsulPeers(t *testing.T, rawURL string) ([]Peer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return consulPeerProvider{}.ResolvePeers(ctx, mustParseURL(rawURL))
+}
+
+func TestConsulResolve(t *testing.T) {
+	_, agent := newFakeConsulAgent(t)
+
+	tests := []struct {
+		msg  string
+		url  string
+		want []Peer
+	}{
+		{
+			msg: "all passing instances",
+			url: "consul://" + agent + "/kv",
+			want: []Peer{
+				{HostPort: "10.1.0.1:8080", Weight: 10, HasWeight: true},
+				{HostPort: "10.0.0.2:8081", Weight: 5, HasWeight: true},
+				{HostPort: "10.1.0.3:8082", Weight: 1, HasWeight: true},
+			},
+		},
+		{
+			msg: "filter by tag",
+			url: "consul://" + agent + "/kv?tag=prod",
+			want: []Peer{
+				{HostPort: "10.1.0.1:8080", Weight: 10, HasWeight: true},
+				{HostPort: "10.0.0.2:8081", Weight: 5, HasWeight: true},
+			},
+		},
+		{
+			msg: "filter by datacenter",
+			url: "consul://" + agent + "/kv?tag=prod&dc=dc2",
+			want: []Peer{
+				{HostPort: "10.1.0.5:8084", Weight: 1, HasWeight: true},
+			},
+		},
+		{
+			msg:  "unknown service",
+			url:  "consul://" + agent + "/unknown",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			peers, err := resolveConsulPeers(t, tt.url)
+			require.NoError(t, err, "failed to resolve peers")
+			assert.Equal(t, tt.want, peers, "unexpected peers")
+		})
+	}
+}
+
+func TestConsulResolveFiltersFailingChecks(t *testing.T) {
+	// Agents should only return passing instances, but we check the
+	// instances in case they don't.
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"Node": {"Address": "10.0.0.1"}, "Service": {"Port": 1}, "Checks": [{"Status": "passing"}]},
+			{"Node": {"Address": "10.0.0.2"}, "Service": {"Port": 2}, "Checks": [{"Status": "passing"}, {"Status": "warning"}]}
+		]`))
+	}))
+	defer svr.Close()
+
+	peers, err := resolveConsulPeers(t, strings.Replace(svr.URL, "http://", "consul://", 1)+"/kv")
+	require.NoError(t, err, "failed to resolve peers")
+	assert.Equal(t, []Peer{{HostPort: "10.0.0.1:1"}}, peers, "unexpected peers")
+}
+
+func TestConsulResolveToken(t *testing.T) {
+	fake, agent := newFakeConsulAgent(t)
+
+	_, err := resolveConsulPeers(t, "consul://"+agent+"/kv")
+	require.NoError(t, err, "failed to resolve peers")
+	assert.Empty(t, fake.requests[0].Header.Get("X-Consul-Token"), "token should not be set")
+
+	t.Setenv("CONSUL_HTTP_TOKEN", "acl-token")
+	_, err = resolveConsulPeers(t, "consul://"+agent+"/kv")
+	require.NoError(t, err, "failed to resolve peers")
+	assert.Equal(t, "acl-token", fake.requests[1].Header.Get("X-Consul-Token"), "unexpected token")
+}
+
+func TestConsulResolveRegistered(t *testing.T) {
+	_, agent := newFakeConsulAgent(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	hostPorts, err := Resolve(ctx, mustParseURL("consul://"+agent+"/kv?tag=prod"))
+	require.NoError(t, err, "failed to resolve peers")
+	assert.Equal(t, []string{"10.1.0.1:8080", "10.0.0.2:8081"}, hostPorts, "unexpected peers")
+}
+
+func TestConsulResolveErrors(t *testing.T) {
+	_, agent := newFakeConsulAgent(t)
+	invalidJSON := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{"))
+	}))
+	defer invalidJSON.Close()
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer forbidden.Close()
+
+	tests := []struct {
+		msg     string
+		url     string
+		wantErr string
+	}{
+		{
+			msg:     "no service",
+			url:     "consul://" + agent,
+			wantErr: errConsulServiceRequired.Error(),
+		},
+		{
+			msg:     "network error",
+			url:     "consul://127.0.0.1:1/kv",
+			wantErr: `failed to query Consul for service "kv"`,
+		},
+		{
+			msg:     "status not OK",
+			url:     strings.Replace(forbidden.URL, "http://", "consul://", 1) + "/kv",
+			wantErr: "status not OK: Forbidden",
+		},
+		{
+			msg:     "invalid response",
+			url:     strings.Replace(invalidJSON.URL, "http://", "consul://", 1) + "/kv",
+			wantErr: `failed to parse Consul response for service "kv"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := resolveConsulPeers(t, tt.url)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConsulResolveHTTPS(t *testing.T) {
+	fake, _ := newFakeConsulAgent(t)
+	svr := httptest.NewTLSServer(fake)
+	defer svr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	u := mustParseURL(strings.Replace(svr.URL, "https://", "consul+https://", 1) + "/kv?tag=prod")
+
+	_, err := Resolve(ctx, u)
+	require.Error(t, err, "agent certificate should not be trusted by the default client")
+
+	hostPorts, err := Resolve(httpclient.WithClient(ctx, svr.Client()), u)
+	require.NoError(t, err, "failed to resolve peers")
+	assert.Equal(t, []string{"10.1.0.1:8080", "10.0.0.2:8081"}, hostPorts, "unexpected peers")
+}
+
+func TestConsulHealthURL(t *testing.T) {
+	u := mustParseURL("consul://agent:8500/kv?tag=prod&tag=us-east&dc=dc1&other=ignored")
+	assert.Equal(t, "http://agent:8500/v1/health/service/kv?dc=dc1&passing=true&tag=prod&tag=us-east", consulHealthURL(u, "kv"))
+
+	u = mustParseURL("consul+https://agent:8501/kv")
+	assert.Equal(t, "https://agent:8501/v1/health/service/kv?passing=true", consulHealthURL(u, "kv"))
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package peerprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	_srvScheme      = "dns+srv"
+	_defaultDNSPort = "53"
+
+	// _minSRVWeight is used for SRV records with a weight of 0 in a set with
+	// other non-zero weights.
+	_minSRVWeight = 1
+)
+
+var errDNSPortRequired = errors.New("DNS peer provider URLs must specify a port, e.g., dns://host:port")
+
+// dnsPeerProvider resolves peers using DNS. dns+srv://_service._proto.name
+// uses the SRV records of the name, and dns://host:port uses the A and AAAA
+// records of the host with the given port.
+//
+// The DNS server can be set using the resolver query parameter, e.g.,
+// dns://host:port?resolver=10.0.0.1:53. Otherwise, the system's DNS
+// configuration is used.
+type dnsPeerProvider struct{}
+
+func (p dnsPeerProvider) Resolve(ctx context.Context, u *url.URL) ([]string, error) {
+	return hostPorts(p.ResolvePeers(ctx, u))
+}
+
+func (dnsPeerProvider) ResolvePeers(ctx context.Context, u *url.URL) ([]Peer, error) {
+	resolver := dnsResolver(u.Query().Get("resolver"))
+	if u.Scheme == _srvScheme {
+		return resolveSRV(ctx, resolver, u.Hostname())
+	}
+	return resolveHost(ctx, resolver, u.Host)
+}
+
+// dnsResolver returns a resolver that uses the given DNS server, or the
+// default resolver if no server is specified.
+func dnsResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, _defaultDNSPort)
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// resolveSRV returns the targets of the SRV records with the lowest priority
+// value, weighted by the weight of their records. Targets with a higher
+// priority value should only be used if these are unreachable, so they're
+// not returned.
+func resolveSRV(ctx context.Context, resolver *net.Resolver, name string) ([]Peer, error) {
+	_, records, err := resolver.LookupSRV(ctx, "" /* service */, "" /* proto */, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up SRV records: %v", err)
+	}
+
+	// Records are sorted by priority, and then randomized by weight.
+	var (
+		peers    []Peer
+		weighted bool
+	)
+	for _, r := range records {
+		if r.Priority != records[0].Priority {
+			break
+		}
+
+		target := strings.TrimSuffix(r.Target, ".")
+		peers = append(peers, Peer{
+			HostPort: net.JoinHostPort(target, strconv.Itoa(int(r.Port))),
+			Weight:   int(r.Weight),
+		})
+		weighted = weighted || r.Weight > 0
+	}
+
+	// Records that all have a weight of 0 are used equally. In a weighted set,
+	// RFC 2782 gives weight 0 records a very small chance of being selected,
+	// so they get the smallest non-zero weight rather than never being used.
+	if weighted {
+		for i := range peers {
+			peers[i].HasWeight = true
+			if peers[i].Weight == 0 {
+				peers[i].Weight = _minSRVWeight
+			}
+		}
+	}
+	return peers, nil
+}
+
+// resolveHost returns the addresses of the host with the given port.
+func resolveHost(ctx context.Context, resolver *net.Resolver, hostPort string) ([]Peer, error) {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil || port == "" {
+		return nil, errDNSPortRequired
+	}
+
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up host: %v", err)
+	}
+
+	peers := make([]Peer, len(addrs))
+	for i, addr := range addrs {
+		peers[i] = Peer{HostPort: net.JoinHostPort(addr, port)}
+	}
+	return peers, nil
+}
@@ -0,0 +1,212 @@
+package peerprovider
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNSServer answers DNS queries over UDP using static records. Names
+// without records get an NXDOMAIN response.
+type fakeDNSServer struct {
+	conn net.PacketConn
+	srv  map[string][]dnsmessage.SRVResource
+	a    map[string][]dnsmessage.AResource
+}
+
+func newFakeDNSServer(t *testing.T) *fakeDNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err, "failed to listen")
+
+	s := &fakeDNSServer{
+		conn: conn,
+		srv: map[string][]dnsmessage.SRVResource{
+			"_kv._tcp.example.test.": {
+				{Priority: 10, Weight: 60, Port: 8080, Target: mustName("kv1.example.test.")},
+				{Priority: 10, Weight: 40, Port: 8081, Target: mustName("kv2.example.test.")},
+				{Priority: 20, Weight: 100, Port: 8082, Target: mustName("backup.example.test.")},
+			},
+			"_mixed._tcp.example.test.": {
+				{Priority: 10, Weight: 0, Port: 8080, Target: mustName("kv1.example.test.")},
+				{Priority: 10, Weight: 50, Port: 8081, Target: mustName("kv2.example.test.")},
+			},
+			"_unweighted._tcp.example.test.": {
+				{Priority: 10, Weight: 0, Port: 8080, Target: mustName("kv1.example.test.")},
+				{Priority: 10, Weight: 0, Port: 8081, Target: mustName("kv2.example.test.")},
+			},
+		},
+		a: map[string][]dnsmessage.AResource{
+			"kv.example.test.": {
+				{A: [4]byte{10, 0, 0, 1}},
+				{A: [4]byte{10, 0, 0, 2}},
+			},
+		},
+	}
+	go s.serve()
+	t.Cleanup(func() { conn.Close() })
+	return s
+}
+
+func (s *fakeDNSServer) resolverURL(rawURL string) string {
+	return rawURL + "?resolver=" + s.conn.LocalAddr().String()
+}
+
+func (s *fakeDNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		if res, err := s.respond(buf[:n]); err == nil {
+			s.conn.WriteTo(res, addr)
+		}
+	}
+}
+
+func (s *fakeDNSServer) respond(req []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(req)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	name := q.Name.String()
+	_, hasSRV := s.srv[name]
+	_, hasA := s.a[name]
+
+	header.Response = true
+	header.Authoritative = true
+	if !hasSRV && !hasA {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, header)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	switch q.Type {
+	case dnsmessage.TypeSRV:
+		for _, r := range s.srv[name] {
+			if err := b.SRVResource(rh, r); err != nil {
+				return nil, err
+			}
+		}
+	case dnsmessage.TypeA:
+		for _, r := range s.a[name] {
+			if err := b.AResource(rh, r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+func mustName(s string) dnsmessage.Name {
+	return dnsmessage.MustNewName(s)
+}
+
+func resolveDNSPeers(t *testing.T, rawURL string) ([]Peer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return dnsPeerProvider{}.ResolvePeers(ctx, mustParseURL(rawURL))
+}
+
+func TestDNSResolveSRV(t *testing.T) {
+	s := newFakeDNSServer(t)
+
+	peers, err := resolveDNSPeers(t, s.resolverURL("dns+srv://_kv._tcp.example.test"))
+	require.NoError(t, err, "failed to resolve SRV records")
+	assert.ElementsMatch(t, []Peer{
+		{HostPort: "kv1.example.test:8080", Weight: 60, HasWeight: true},
+		{HostPort: "kv2.example.test:8081", Weight: 40, HasWeight: true},
+	}, peers, "only peers with the lowest priority value should be returned")
+}
+
+func TestDNSResolveSRVZeroWeights(t *testing.T) {
+	s := newFakeDNSServer(t)
+
+	peers, err := resolveDNSPeers(t, s.resolverURL("dns+srv://_mixed._tcp.example.test"))
+	require.NoError(t, err, "failed to resolve SRV records")
+	assert.ElementsMatch(t, []Peer{
+		{HostPort: "kv1.example.test:8080", Weight: _minSRVWeight, HasWeight: true},
+		{HostPort: "kv2.example.test:8081", Weight: 50, HasWeight: true},
+	}, peers, "weight 0 records should get a minimal weight in a weighted set")
+
+	peers, err = resolveDNSPeers(t, s.resolverURL("dns+srv://_unweighted._tcp.example.test"))
+	require.NoError(t, err, "failed to resolve SRV records")
+	assert.ElementsMatch(t, []Peer{
+		{HostPort: "kv1.example.test:8080"},
+		{HostPort: "kv2.example.test:8081"},
+	}, peers, "records that all have weight 0 should be unweighted")
+}
+
+func TestDNSResolveHost(t *testing.T) {
+	s := newFakeDNSServer(t)
+
+	peers, err := resolveDNSPeers(t, s.resolverURL("dns://kv.example.test:9000"))
+	require.NoError(t, err, "failed to resolve host")
+	assert.ElementsMatch(t, []Peer{
+		{HostPort: "10.0.0.1:9000"},
+		{HostPort: "10.0.0.2:9000"},
+	}, peers, "unexpected peers")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	hostPorts, err := Resolve(ctx, mustParseURL(s.resolverURL("dns://kv.example.test:9000")))
+	require.NoError(t, err, "failed to resolve host using the registry")
+	assert.ElementsMatch(t, []string{"10.0.0.1:9000", "10.0.0.2:9000"}, hostPorts, "unexpected peers")
+}
+
+func TestDNSResolveErrors(t *testing.T) {
+	s := newFakeDNSServer(t)
+
+	tests := []struct {
+		msg    string
+		url    string
+		errMsg string
+	}{
+		{
+			msg:    "host without port",
+			url:    s.resolverURL("dns://kv.example.test"),
+			errMsg: errDNSPortRequired.Error(),
+		},
+		{
+			msg:    "unknown host",
+			url:    s.resolverURL("dns://unknown.example.test:9000"),
+			errMsg: "failed to look up host",
+		},
+		{
+			msg:    "unknown SRV name",
+			url:    s.resolverURL("dns+srv://_unknown._tcp.example.test"),
+			errMsg: "failed to look up SRV records",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := resolveDNSPeers(t, tt.url)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg, "unexpected error")
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package peerprovider
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/yarpc/yab/internal/execurl"
+)
+
+// execPeerProvider runs a command to get peers, such as
+// "exec:discovery-cli lookup svc". The command's output is parsed the same
+// way as a peer list file. The command is killed if it doesn't finish
+// before the resolve deadline. Arguments are split on whitespace, so
+// arguments with spaces use arg query parameters, as described by
+// execurl.Args.
+type execPeerProvider struct{}
+
+func (p execPeerProvider) Resolve(ctx context.Context, u *url.URL) ([]string, error) {
+	return hostPorts(p.ResolvePeers(ctx, u))
+}
+
+func (execPeerProvider) ResolvePeers(ctx context.Context, u *url.URL) ([]Peer, error) {
+	args, err := execurl.Args(u)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := execurl.Run(ctx, "peer list", args)
+	if err != nil {
+		return nil, err
+	}
+	return parsePeers(out)
+}
@@ -0,0 +1,95 @@
+package peerprovider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecResolve(t *testing.T) {
+	tests := []struct {
+		msg  string
+		url  string
+		want []string
+	}{
+		{
+			msg:  "newline delimited",
+			url:  "exec:echo 1.1.1.1:1",
+			want: []string{"1.1.1.1:1"},
+		},
+		{
+			msg:  "YAML",
+			url:  "exec:cat ../testdata/valid_peerlist.yaml",
+			want: []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			msg:  "JSON",
+			url:  "exec:cat ../testdata/valid_peerlist.json",
+			want: []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			peers, err := Resolve(ctx, mustParseURL(tt.url))
+			require.NoError(t, err, "failed to resolve peers")
+			assert.Equal(t, tt.want, peers, "unexpected peers")
+		})
+	}
+}
+
+func TestExecResolveErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		url     string
+		timeout time.Duration
+		wantErr string
+	}{
+		{
+			msg:     "no command",
+			url:     "exec:",
+			wantErr: "no command specified",
+		},
+		{
+			msg:     "command not found",
+			url:     "exec:yab-missing-peers-command",
+			wantErr: `failed to run peer list command "yab-missing-peers-command"`,
+		},
+		{
+			msg:     "command fails with stderr",
+			url:     "exec:ls /yab-missing-dir",
+			wantErr: "yab-missing-dir",
+		},
+		{
+			msg:     "invalid output",
+			url:     "exec:cat ../testdata/invalid_peerlist.json",
+			wantErr: errPeerListFile.Error(),
+		},
+		{
+			msg:     "deadline exceeded",
+			url:     "exec:sleep 5",
+			timeout: 50 * time.Millisecond,
+			wantErr: "context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			if tt.timeout == 0 {
+				tt.timeout = time.Second
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			_, err := Resolve(ctx, mustParseURL(tt.url))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -10,10 +10,14 @@ import (
 type filePeerProvider struct{}
 
 func (filePeerProvider) Resolve(ctx context.Context, url *url.URL) ([]string, error) {
+	return hostPorts(parsePeerList(url.Path))
+}
+
+func (filePeerProvider) ResolvePeers(ctx context.Context, url *url.URL) ([]Peer, error) {
 	return parsePeerList(url.Path)
 }
 
-func parsePeerList(filename string) ([]string, error) {
+func parsePeerList(filename string) ([]Peer, error) {
 	contents, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open peer list: %v", err)
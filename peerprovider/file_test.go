@@ -36,6 +36,14 @@ func TestParseHostFile(t *testing.T) {
 			filename: "valid_peerlist.txt",
 			want:     []string{"1.1.1.1:1", "2.2.2.2:2"},
 		},
+		{
+			filename: "valid_metadata_peerlist.yaml",
+			want:     []string{"1.1.1.1:1", "2.2.2.2:2", "3.3.3.3:3"},
+		},
+		{
+			filename: "invalid_metadata_peerlist.yaml",
+			errMsg:   "peer list entry 1 is missing a peer",
+		},
 		{
 			filename: "invalid_peerlist.json",
 			errMsg:   errPeerListFile.Error(),
@@ -51,7 +59,7 @@ func TestParseHostFile(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got, err := parsePeerList("../testdata/" + tt.filename)
+		got, err := hostPorts(parsePeerList("../testdata/" + tt.filename))
 		if tt.errMsg != "" {
 			if assert.Error(t, err, "parsePeerList(%v) should fail", tt.filename) {
 				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error for parsePeerList(%v)", tt.filename)
@@ -64,3 +72,39 @@ func TestParseHostFile(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePeerListMetadata(t *testing.T) {
+	want := []Peer{
+		{HostPort: "1.1.1.1:1", Weight: 3, HasWeight: true, Tags: map[string]string{"zone": "us-east", "version": "1.2"}},
+		{HostPort: "2.2.2.2:2", Weight: 1, HasWeight: true, Tags: map[string]string{"zone": "us-west", "version": "1.3", "pool": "canary"}},
+		{HostPort: "3.3.3.3:3"},
+	}
+
+	for _, filename := range []string{"valid_metadata_peerlist.yaml", "valid_metadata_peerlist.json"} {
+		got, err := parsePeerList("../testdata/" + filename)
+		if assert.NoError(t, err, "parsePeerList(%v) should not fail", filename) {
+			assert.Equal(t, want, got, "parsePeerList(%v) mismatch", filename)
+		}
+	}
+
+	got, err := parsePeerList("../testdata/valid_peerlist.yaml")
+	if assert.NoError(t, err, "parsePeerList should not fail for plain lists") {
+		assert.Equal(t, []Peer{{HostPort: "1.1.1.1:1"}, {HostPort: "2.2.2.2:2"}}, got, "plain lists should have no metadata")
+	}
+}
+
+func TestParsePeersMissingWeight(t *testing.T) {
+	got, err := parsePeers([]byte(`[{"peer": "1.1.1.1:1", "weight": 0}, {"peer": "2.2.2.2:2"}, "3.3.3.3:3"]`))
+	if assert.NoError(t, err, "parsePeers failed") {
+		assert.Equal(t, []Peer{
+			{HostPort: "1.1.1.1:1", Weight: 0, HasWeight: true, Tags: map[string]string{}},
+			{HostPort: "2.2.2.2:2", Tags: map[string]string{}},
+			{HostPort: "3.3.3.3:3"},
+		}, got, "an explicit weight of 0 should be kept separate from a missing weight")
+	}
+}
+
+func TestParsePeersNegativeWeight(t *testing.T) {
+	_, err := parsePeers([]byte(`[{"peer": "1.1.1.1:1", "weight": -1}]`))
+	assert.EqualError(t, err, "peer list entry 0 has a negative weight: -1")
+}
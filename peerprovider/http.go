@@ -6,18 +6,24 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+
+	"github.com/yarpc/yab/internal/httpclient"
 )
 
 type httpPeerProvider struct{}
 
-func (httpPeerProvider) Resolve(ctx context.Context, url *url.URL) ([]string, error) {
+func (p httpPeerProvider) Resolve(ctx context.Context, url *url.URL) ([]string, error) {
+	return hostPorts(p.ResolvePeers(ctx, url))
+}
+
+func (httpPeerProvider) ResolvePeers(ctx context.Context, url *url.URL) ([]Peer, error) {
 	req, err := http.NewRequest("GET", url.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 	req = req.WithContext(ctx)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpclient.FromContext(ctx).Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read peer list over HTTP: %v", err)
 	}
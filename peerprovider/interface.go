@@ -13,6 +13,11 @@ func init() {
 	RegisterPeerProvider("file", filePeerProvider{})
 	RegisterPeerProvider("http", httpPeerProvider{})
 	RegisterPeerProvider("https", httpPeerProvider{})
+	RegisterPeerProvider("dns", dnsPeerProvider{})
+	RegisterPeerProvider("dns+srv", dnsPeerProvider{})
+	RegisterPeerProvider("exec", execPeerProvider{})
+	RegisterPeerProvider("consul", consulPeerProvider{})
+	RegisterPeerProvider(_consulHTTPSScheme, consulPeerProvider{})
 }
 
 // Schemes returns supported peer provider protocol schemes.
@@ -36,6 +41,61 @@ func Resolve(ctx context.Context, u *url.URL) ([]string, error) {
 	return nil, fmt.Errorf("no peer provider available for scheme %q in URL %q", u.Scheme, u.String())
 }
 
+// ResolvePeers resolves peers and their metadata from a URL. Peers from
+// providers that don't implement PeerMetadataProvider have no metadata.
+func ResolvePeers(ctx context.Context, u *url.URL) ([]Peer, error) {
+	pp, ok := registry[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("no peer provider available for scheme %q in URL %q", u.Scheme, u.String())
+	}
+
+	if mp, ok := pp.(PeerMetadataProvider); ok {
+		return mp.ResolvePeers(ctx, u)
+	}
+
+	hostPorts, err := pp.Resolve(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]Peer, len(hostPorts))
+	for i, hp := range hostPorts {
+		peers[i] = Peer{HostPort: hp}
+	}
+	return peers, nil
+}
+
+// Peer is a peer resolved by a peer provider, along with its metadata.
+type Peer struct {
+	// HostPort is the peer, in a format suitable for passing to `--peer`.
+	HostPort string
+
+	// Weight is the relative weight of the peer, if HasWeight is set. Peers
+	// are weighted equally if none of them have a weight, and otherwise,
+	// peers without a weight have a weight of 1.
+	Weight int
+
+	// HasWeight is set if the peer has a weight, which may be 0.
+	HasWeight bool
+
+	// Tags are metadata about the peer, such as its zone and version, which
+	// can be used to filter peers.
+	Tags map[string]string
+}
+
+// hostPorts returns the host:port of each peer, or the error resolving them.
+func hostPorts(peers []Peer, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	hps := make([]string, len(peers))
+	for i, p := range peers {
+		hps[i] = p.HostPort
+	}
+	return hps, nil
+}
+
 // PeerProvider provides a list of peers for a given peer provider URL.
 // Implementations are expected to define the behavior for the URL name space
 // and return strings suitable for passing to `--peer` for whatever protocol
@@ -44,6 +104,14 @@ type PeerProvider interface {
 	Resolve(context.Context, *url.URL) ([]string, error)
 }
 
+// PeerMetadataProvider is a PeerProvider that also provides metadata about
+// the peers, such as their weight.
+type PeerMetadataProvider interface {
+	PeerProvider
+
+	ResolvePeers(context.Context, *url.URL) ([]Peer, error)
+}
+
 // RegisterPeerProvider registers a peer provider for a resolver protocol
 func RegisterPeerProvider(scheme string, pp PeerProvider) {
 	registry[scheme] = pp
@@ -45,6 +45,23 @@ func TestResolveError(t *testing.T) {
 	assert.Equal(t, res, []string(nil), "should not resolve")
 }
 
+func TestResolvePeers(t *testing.T) {
+	defer stubRegistry()()
+
+	RegisterPeerProvider("fake", &fakePeerProvider{res: []string{"1.1.1.1:1", "2.2.2.2:2"}})
+	RegisterPeerProvider("broken", &fakePeerProvider{err: fmt.Errorf("noope")})
+
+	peers, err := ResolvePeers(context.Background(), mustParseURL("fake://dekaf"))
+	assert.NoError(t, err, "should resolve without error")
+	assert.Equal(t, []Peer{{HostPort: "1.1.1.1:1"}, {HostPort: "2.2.2.2:2"}}, peers, "peers should have no metadata")
+
+	_, err = ResolvePeers(context.Background(), mustParseURL("broken://dekaf"))
+	assert.EqualError(t, err, "noope", "should return provider error")
+
+	_, err = ResolvePeers(context.Background(), mustParseURL("unknown://dekaf"))
+	assert.Error(t, err, "should fail for unknown scheme")
+}
+
 func TestEmptyScheme(t *testing.T) {
 	peers, err := Resolve(context.Background(), mustParseURL("../testdata/valid_peerlist.txt"))
 	assert.NoError(t, err, "error attempting to resolve peer list file")
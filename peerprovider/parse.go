@@ -16,23 +16,96 @@ import (
 var errPeerListFile = errors.New("peer list should be YAML, JSON, or newline delimited strings")
 
 // parsePeers accepts a file in YAML, JSON, or newline-delimited format,
-// containing host:port peer addresses.
-func parsePeers(contents []byte) ([]string, error) {
+// containing host:port peer addresses. YAML and JSON entries can also be
+// maps with the peer and its metadata:
+//
+//   - peer: 1.1.1.1:1
+//     weight: 3
+//     zone: us-east
+//     version: v2
+//     tags: {pool: canary}
+func parsePeers(contents []byte) ([]Peer, error) {
 	// Try as JSON.
-	hosts, err := parseYAMLPeers(contents)
-	if err != nil {
-		hosts, err = parseNewlineDelimitedPeers(bytes.NewReader(contents))
+	peers, err := parseYAMLPeers(contents)
+	if err == nil {
+		return peers, validatePeers(peers)
 	}
+
+	hosts, err := parseNewlineDelimitedPeers(bytes.NewReader(contents))
 	if err != nil {
 		return nil, errPeerListFile
 	}
 
-	return hosts, nil
+	peers = make([]Peer, len(hosts))
+	for i, host := range hosts {
+		peers[i] = Peer{HostPort: host}
+	}
+	return peers, nil
 }
 
-func parseYAMLPeers(contents []byte) ([]string, error) {
-	var hosts []string
-	return hosts, yaml.Unmarshal(contents, &hosts)
+func parseYAMLPeers(contents []byte) ([]Peer, error) {
+	var entries []peerEntry
+	if err := yaml.Unmarshal(contents, &entries); err != nil {
+		return nil, err
+	}
+
+	var peers []Peer
+	for _, e := range entries {
+		peers = append(peers, Peer(e))
+	}
+	return peers, nil
+}
+
+// peerEntry is an entry in a YAML or JSON peer list, which is either a peer,
+// or a map with the peer and its metadata.
+type peerEntry Peer
+
+func (e *peerEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&e.HostPort); err == nil {
+		return nil
+	}
+
+	var entry struct {
+		Peer    string            `yaml:"peer"`
+		Weight  *int              `yaml:"weight"`
+		Zone    string            `yaml:"zone"`
+		Version string            `yaml:"version"`
+		Tags    map[string]string `yaml:"tags"`
+	}
+	if err := unmarshal(&entry); err != nil {
+		return err
+	}
+
+	// The zone and version are tags, so they can be used to filter peers.
+	tags := make(map[string]string, len(entry.Tags)+2)
+	for k, v := range entry.Tags {
+		tags[k] = v
+	}
+	if entry.Zone != "" {
+		tags["zone"] = entry.Zone
+	}
+	if entry.Version != "" {
+		tags["version"] = entry.Version
+	}
+
+	*e = peerEntry{HostPort: entry.Peer, Tags: tags}
+	if entry.Weight != nil {
+		e.Weight = *entry.Weight
+		e.HasWeight = true
+	}
+	return nil
+}
+
+func validatePeers(peers []Peer) error {
+	for i, p := range peers {
+		if p.HostPort == "" {
+			return fmt.Errorf("peer list entry %v is missing a peer", i)
+		}
+		if p.Weight < 0 {
+			return fmt.Errorf("peer list entry %v has a negative weight: %v", i, p.Weight)
+		}
+	}
+	return nil
 }
 
 func parseNewlineDelimitedPeers(r io.Reader) ([]string, error) {
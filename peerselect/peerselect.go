@@ -0,0 +1,350 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package peerselect implements strategies for choosing a peer from a list.
+package peerselect
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+// Supported peer selection strategies.
+const (
+	RoundRobin     = "round-robin"
+	Random         = "random"
+	LeastPending   = "least-pending"
+	ConsistentHash = "consistent-hash"
+	Weighted       = "weighted"
+)
+
+const (
+	// hashReplicas is the number of points each unit of weight has on the
+	// consistent hash ring.
+	hashReplicas = 100
+
+	// maxRingPoints caps the size of the consistent hash ring, since weights
+	// from peer lists such as SRV records can be large.
+	maxRingPoints = 100000
+)
+
+var (
+	_strategies = []string{RoundRobin, Random, LeastPending, ConsistentHash, Weighted}
+
+	errNoPeers     = errors.New("specify at least one peer")
+	errZeroWeights = errors.New("at least one peer must have a positive weight")
+)
+
+// Chooser chooses peers from a fixed list.
+type Chooser interface {
+	// Choose returns the index of the peer to use. The key is only used by
+	// the consistent-hash strategy. done must be called once the peer is
+	// no longer in use.
+	Choose(key string) (index int, done func())
+}
+
+// Strategies returns the names of the supported strategies.
+func Strategies() []string {
+	return append([]string(nil), _strategies...)
+}
+
+// Validate returns an error if strategy is not a supported strategy.
+func Validate(strategy string) error {
+	for _, s := range _strategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown peer strategy %q, expected one of: %v", strategy, strings.Join(_strategies, ", "))
+}
+
+// New returns a Chooser that uses the given strategy to choose between peers.
+// Weights are optional, but if specified, there must be one for each peer.
+// Peers without a weight are treated as having a weight of 1.
+func New(strategy string, peers []string, weights []int) (Chooser, error) {
+	if err := Validate(strategy); err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return nil, errNoPeers
+	}
+
+	weights, err := normalizeWeights(len(peers), weights)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strategy {
+	case Random:
+		return random(len(peers)), nil
+	case LeastPending:
+		return newLeastPending(len(peers)), nil
+	case ConsistentHash:
+		return newConsistentHash(peers, weights), nil
+	case Weighted:
+		return newWeighted(weights), nil
+	default:
+		return newRoundRobin(len(peers)), nil
+	}
+}
+
+// Spread returns the index of the peer used for each of n long-lived uses of
+// peers, such as connections, in proportion to the peer weights. Uses of each
+// peer are spread out using smooth weighted round-robin rather than chosen at
+// random. Weights are optional, as with New.
+func Spread(n, numPeers int, weights []int) ([]int, error) {
+	if numPeers == 0 {
+		return nil, errNoPeers
+	}
+
+	weights, err := normalizeWeights(numPeers, weights)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+
+	current := make([]int, numPeers)
+	peers := make([]int, n)
+	for i := range peers {
+		best := -1
+		for j, w := range weights {
+			if w == 0 {
+				continue
+			}
+			current[j] += w
+			if best < 0 || current[j] > current[best] {
+				best = j
+			}
+		}
+		current[best] -= total
+		peers[i] = best
+	}
+	return peers, nil
+}
+
+func normalizeWeights(numPeers int, weights []int) ([]int, error) {
+	if weights == nil {
+		weights = make([]int, numPeers)
+		for i := range weights {
+			weights[i] = 1
+		}
+		return weights, nil
+	}
+
+	if len(weights) != numPeers {
+		return nil, fmt.Errorf("got %v peer weights for %v peers", len(weights), numPeers)
+	}
+
+	var total int
+	for i, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("peer weight cannot be negative, got %v for peer %v", w, i)
+		}
+		total += w
+	}
+	if total == 0 {
+		return nil, errZeroWeights
+	}
+	return weights, nil
+}
+
+func noop() {}
+
+// roundRobin cycles through peers, starting from a random peer.
+type roundRobin struct {
+	numPeers int
+	next     atomic.Int64
+}
+
+func newRoundRobin(numPeers int) *roundRobin {
+	r := &roundRobin{numPeers: numPeers}
+	r.next.Store(int64(rand.Intn(numPeers)))
+	return r
+}
+
+func (r *roundRobin) Choose(string) (int, func()) {
+	next := r.next.Inc() - 1
+	return int(next % int64(r.numPeers)), noop
+}
+
+// random chooses a peer uniformly at random.
+type random int
+
+func (r random) Choose(string) (int, func()) {
+	return rand.Intn(int(r)), noop
+}
+
+// leastPending chooses the peer with the fewest requests that are not done.
+// Ties are broken by cycling through peers.
+type leastPending struct {
+	mu      sync.Mutex
+	pending []int
+	next    int
+}
+
+func newLeastPending(numPeers int) *leastPending {
+	return &leastPending{
+		pending: make([]int, numPeers),
+		next:    rand.Intn(numPeers),
+	}
+}
+
+func (l *leastPending) Choose(string) (int, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	numPeers := len(l.pending)
+	best := l.next
+	for i := 1; i < numPeers; i++ {
+		candidate := (l.next + i) % numPeers
+		if l.pending[candidate] < l.pending[best] {
+			best = candidate
+		}
+	}
+
+	l.pending[best]++
+	l.next = (best + 1) % numPeers
+
+	var once sync.Once
+	return best, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.pending[best]--
+			l.mu.Unlock()
+		})
+	}
+}
+
+// consistentHash maps keys to peers using a hash ring, so the same key
+// is always sent to the same peer.
+type consistentHash struct {
+	ring []ringPoint
+}
+
+type ringPoint struct {
+	hash  uint32
+	index int
+}
+
+func newConsistentHash(peers []string, weights []int) *consistentHash {
+	points := ringPoints(weights)
+
+	var ring []ringPoint
+	for i, peer := range peers {
+		for r := 0; r < points[i]; r++ {
+			ring = append(ring, ringPoint{
+				hash:  hashKey(peer + "#" + strconv.Itoa(r)),
+				index: i,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	return &consistentHash{ring: ring}
+}
+
+// ringPoints returns the number of points each peer has on the hash ring.
+// Weights are reduced by their greatest common divisor, and if the ring
+// would still have more than maxRingPoints, they're scaled down to fit
+// while every peer with a positive weight keeps at least one point.
+func ringPoints(weights []int) []int {
+	divisor := 0
+	for _, w := range weights {
+		divisor = gcd(divisor, w)
+	}
+
+	total := 0
+	for _, w := range weights {
+		total += w / divisor
+	}
+
+	points := make([]int, len(weights))
+	for i, w := range weights {
+		w /= divisor
+		if total*hashReplicas <= maxRingPoints {
+			points[i] = w * hashReplicas
+			continue
+		}
+
+		points[i] = int(int64(w) * maxRingPoints / int64(total))
+		if points[i] == 0 && w > 0 {
+			points[i] = 1
+		}
+	}
+	return points
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func (c *consistentHash) Choose(key string) (int, func()) {
+	h := hashKey(key)
+	i := sort.Search(len(c.ring), func(i int) bool {
+		return c.ring[i].hash >= h
+	})
+	if i == len(c.ring) {
+		i = 0
+	}
+	return c.ring[i].index, noop
+}
+
+func hashKey(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
+
+// weighted chooses a peer at random, in proportion to its weight.
+type weighted struct {
+	// cumulative[i] is the sum of the weights of peers 0 to i.
+	cumulative []int
+}
+
+func newWeighted(weights []int) *weighted {
+	cumulative := make([]int, len(weights))
+	var total int
+	for i, w := range weights {
+		total += w
+		cumulative[i] = total
+	}
+	return &weighted{cumulative: cumulative}
+}
+
+func (w *weighted) Choose(string) (int, func()) {
+	n := rand.Intn(w.cumulative[len(w.cumulative)-1])
+	return sort.Search(len(w.cumulative), func(i int) bool {
+		return w.cumulative[i] > n
+	}), noop
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package peerselect
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func choose(t *testing.T, c Chooser, key string, n int) []int {
+	got := make([]int, n)
+	for i := range got {
+		index, done := c.Choose(key)
+		done()
+		got[i] = index
+	}
+	return got
+}
+
+func TestValidate(t *testing.T) {
+	for _, s := range Strategies() {
+		assert.NoError(t, Validate(s), "Validate(%q)", s)
+	}
+
+	err := Validate("fastest")
+	require.Error(t, err, "Validate should fail for unknown strategies")
+	assert.Contains(t, err.Error(), `unknown peer strategy "fastest"`)
+	assert.Contains(t, err.Error(), "round-robin, random, least-pending, consistent-hash, weighted")
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		msg      string
+		strategy string
+		peers    []string
+		weights  []int
+		wantErr  string
+	}{
+		{
+			msg:      "unknown strategy",
+			strategy: "fastest",
+			peers:    []string{"1"},
+			wantErr:  "unknown peer strategy",
+		},
+		{
+			msg:      "no peers",
+			strategy: Random,
+			wantErr:  errNoPeers.Error(),
+		},
+		{
+			msg:      "mismatched weights",
+			strategy: Weighted,
+			peers:    []string{"1", "2"},
+			weights:  []int{1},
+			wantErr:  "got 1 peer weights for 2 peers",
+		},
+		{
+			msg:      "negative weight",
+			strategy: Weighted,
+			peers:    []string{"1", "2"},
+			weights:  []int{1, -1},
+			wantErr:  "peer weight cannot be negative, got -1 for peer 1",
+		},
+		{
+			msg:      "zero weights",
+			strategy: Weighted,
+			peers:    []string{"1", "2"},
+			weights:  []int{0, 0},
+			wantErr:  errZeroWeights.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := New(tt.strategy, tt.peers, tt.weights)
+			require.Error(t, err, "New should fail")
+			assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error")
+		})
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	tests := []struct {
+		seed  int64
+		peers []string
+		want  []int
+	}{
+		{
+			seed:  1,
+			peers: []string{"1"},
+			want:  []int{0, 0, 0},
+		},
+		{
+			seed:  1,
+			peers: []string{"1", "2"},
+			want:  []int{1, 0, 1},
+		},
+		{
+			seed:  2,
+			peers: []string{"1", "2"},
+			want:  []int{0, 1, 0},
+		},
+		{
+			seed:  1,
+			peers: []string{"1", "2", "3", "4", "5"},
+			want:  []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		rand.Seed(tt.seed)
+		c, err := New(RoundRobin, tt.peers, nil)
+		require.NoError(t, err, "Failed to create chooser")
+		assert.Equal(t, tt.want, choose(t, c, "", len(tt.want)), "round-robin(%v) seed %v", tt.peers, tt.seed)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	c, err := New(Random, []string{"1", "2", "3"}, nil)
+	require.NoError(t, err, "Failed to create chooser")
+
+	counts := make([]int, 3)
+	for _, index := range choose(t, c, "", 3000) {
+		counts[index]++
+	}
+	for i, count := range counts {
+		assert.InDelta(t, 1000, count, 200, "Peer %v was chosen an unexpected number of times", i)
+	}
+}
+
+func TestLeastPending(t *testing.T) {
+	c, err := New(LeastPending, []string{"1", "2", "3"}, nil)
+	require.NoError(t, err, "Failed to create chooser")
+
+	// Without any requests completing, requests are spread evenly.
+	counts := make([]int, 3)
+	dones := make([]func(), 3)
+	for i := 0; i < 6; i++ {
+		index, done := c.Choose("")
+		counts[index]++
+		dones[index] = done
+	}
+	assert.Equal(t, []int{2, 2, 2}, counts, "Pending requests should be balanced")
+
+	// Once a request completes, its peer has the fewest pending requests.
+	dones[1]()
+	dones[1]() // done is idempotent.
+	index, _ := c.Choose("")
+	assert.Equal(t, 1, index, "Expected peer with fewest pending requests")
+}
+
+func TestConsistentHash(t *testing.T) {
+	peers := []string{"1.1.1.1:1", "1.1.1.2:1", "1.1.1.3:1", "1.1.1.4:1"}
+	c, err := New(ConsistentHash, peers, nil)
+	require.NoError(t, err, "Failed to create chooser")
+
+	chosen := make(map[int]struct{})
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint("key-", i)
+		want, _ := c.Choose(key)
+		assert.Equal(t, []int{want, want, want}, choose(t, c, key, 3), "Key %q should always choose the same peer", key)
+		chosen[want] = struct{}{}
+	}
+	assert.Len(t, chosen, len(peers), "Keys should be spread across all peers")
+
+	// Adding a peer should only move keys to the new peer.
+	more, err := New(ConsistentHash, append(peers, "1.1.1.5:1"), nil)
+	require.NoError(t, err, "Failed to create chooser")
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint("key-", i)
+		before, _ := c.Choose(key)
+		after, _ := more.Choose(key)
+		if after != len(peers) {
+			assert.Equal(t, before, after, "Key %q moved between existing peers", key)
+		}
+	}
+}
+
+func TestConsistentHashLargeWeights(t *testing.T) {
+	tests := []struct {
+		msg       string
+		weights   []int
+		wantTotal int
+	}{
+		{
+			msg:       "weights with a common divisor",
+			weights:   []int{65530, 65530, 131060},
+			wantTotal: 4 * hashReplicas,
+		},
+		{
+			msg:       "weights capped to the ring size",
+			weights:   []int{65535, 65534, 1, 1 << 30},
+			wantTotal: maxRingPoints,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			peers := make([]string, len(tt.weights))
+			for i := range peers {
+				peers[i] = fmt.Sprint("1.1.1.", i, ":1")
+			}
+			c, err := New(ConsistentHash, peers, tt.weights)
+			require.NoError(t, err, "Failed to create chooser")
+
+			ring := c.(*consistentHash).ring
+			assert.InDelta(t, tt.wantTotal, len(ring), float64(len(tt.weights)), "Unexpected ring size")
+
+			points := make([]int, len(peers))
+			for _, p := range ring {
+				points[p.index]++
+			}
+			for i, w := range tt.weights {
+				assert.NotZero(t, points[i], "Peer with weight %v should be on the ring", w)
+			}
+		})
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	c, err := New(Weighted, []string{"1", "2", "3"}, []int{1, 0, 3})
+	require.NoError(t, err, "Failed to create chooser")
+
+	counts := make([]int, 3)
+	for _, index := range choose(t, c, "", 4000) {
+		counts[index]++
+	}
+	assert.InDelta(t, 1000, counts[0], 200, "Unexpected count for peer with weight 1")
+	assert.Equal(t, 0, counts[1], "Peer with weight 0 should not be chosen")
+	assert.InDelta(t, 3000, counts[2], 200, "Unexpected count for peer with weight 3")
+}
+
+func TestSpread(t *testing.T) {
+	tests := []struct {
+		msg      string
+		n        int
+		numPeers int
+		weights  []int
+		want     []int
+		wantErr  string
+	}{
+		{
+			msg:      "no weights",
+			n:        5,
+			numPeers: 3,
+			want:     []int{0, 1, 2, 0, 1},
+		},
+		{
+			msg:      "weights are spread out",
+			n:        5,
+			numPeers: 3,
+			weights:  []int{3, 1, 1},
+			want:     []int{0, 1, 0, 2, 0},
+		},
+		{
+			msg:      "peer with weight 0",
+			n:        4,
+			numPeers: 3,
+			weights:  []int{1, 0, 3},
+			want:     []int{2, 0, 2, 2},
+		},
+		{
+			msg:      "no peers",
+			n:        1,
+			numPeers: 0,
+			wantErr:  errNoPeers.Error(),
+		},
+		{
+			msg:      "all weights 0",
+			n:        1,
+			numPeers: 2,
+			weights:  []int{0, 0},
+			wantErr:  errZeroWeights.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			got, err := Spread(tt.n, tt.numPeers, tt.weights)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err, "Spread failed")
+			assert.Equal(t, tt.want, got, "Unexpected peers")
+		})
+	}
+}
@@ -2,7 +2,9 @@ package protobuf
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +15,7 @@ import (
 	yproto "go.uber.org/yarpc/encoding/protobuf"
 	ygrpc "go.uber.org/yarpc/transport/grpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/resolver"
@@ -27,6 +30,13 @@ type ReflectionArgs struct {
 	RoutingKey      string
 	Peers           []string
 	Timeout         time.Duration
+
+	// TLSConfig enables TLS for the connection to the reflection server if set.
+	TLSConfig *tls.Config
+
+	// Dialer is used to connect to peers if set, such as to connect through
+	// a proxy, or to unix:// peers.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
 }
 
 // NewDescriptorProviderReflection returns a DescriptorProvider that reaches
@@ -36,20 +46,39 @@ func NewDescriptorProviderReflection(args ReflectionArgs) (DescriptorProvider, e
 	defer deregisterScheme()
 	peers := make([]resolver.Address, len(args.Peers))
 	for i, p := range args.Peers {
-		if strings.Contains(p, "://") {
+		if strings.Contains(p, "://") && !strings.HasPrefix(p, "unix://") {
 			return nil, fmt.Errorf("peer contains scheme %q", p)
 		}
 		peers[i] = resolver.Address{Addr: p, Type: resolver.Backend}
+		if args.TLSConfig != nil && !strings.HasPrefix(p, "unix://") {
+			// The authority is set to the service name for routing, so
+			// the server certificate is verified against the host of
+			// the peer being dialed, unless the TLS config sets a
+			// server name.
+			peers[i].ServerName = p
+		}
 	}
 	r.InitialState(resolver.State{Addresses: peers})
 
+	creds := grpc.WithInsecure()
+	if args.TLSConfig != nil {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(args.TLSConfig))
+	}
+
+	dialOptions := []grpc.DialOption{
+		grpc.WithAuthority(args.Service),
+		grpc.WithBlock(),
+		creds,
+	}
+	if args.Dialer != nil {
+		dialOptions = append(dialOptions, grpc.WithContextDialer(args.Dialer))
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), args.Timeout)
 	conn, err := grpc.DialContext(
 		ctx,
 		r.Scheme()+":///", // minimal target to dial registered host:port pairs
-		grpc.WithAuthority(args.Service),
-		grpc.WithBlock(),
-		grpc.WithInsecure())
+		dialOptions...)
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("could not reach reflection server: %s", err)
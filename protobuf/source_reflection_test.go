@@ -1,8 +1,13 @@
 package protobuf
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io/ioutil"
 	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -11,6 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 	ygrpc "go.uber.org/yarpc/transport/grpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
@@ -82,6 +88,35 @@ func TestReflectionWithProtocolInPeer(t *testing.T) {
 	assert.Contains(t, err.Error(), "peer contains scheme")
 }
 
+func TestReflectionDialer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "reflection.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	s := grpc.NewServer()
+	reflection.Register(s)
+	go s.Serve(ln)
+	defer s.GracefulStop()
+
+	var dialed []string
+	source, err := NewDescriptorProviderReflection(ReflectionArgs{
+		Timeout: time.Second,
+		Peers:   []string{"unix://" + socket},
+		Dialer: func(ctx context.Context, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	})
+	require.NoError(t, err)
+	defer source.Close()
+
+	result, err := source.FindService("grpc.reflection.v1alpha.ServerReflection")
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, []string{"unix://" + socket}, dialed, "peers should be dialed using the dialer")
+}
+
 func TestReflectionClosedPort(t *testing.T) {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err, "failed to listen on a port")
@@ -96,6 +131,94 @@ func TestReflectionClosedPort(t *testing.T) {
 	assert.Nil(t, got)
 }
 
+func TestReflectionTLS(t *testing.T) {
+	cert, err := tls.LoadX509KeyPair("../testdata/tls/server.pem", "../testdata/tls/server-key.pem")
+	require.NoError(t, err, "failed to load server certificate")
+
+	caPEM, err := ioutil.ReadFile("../testdata/tls/ca.pem")
+	require.NoError(t, err, "failed to read CA")
+	rootCAs := x509.NewCertPool()
+	require.True(t, rootCAs.AppendCertsFromPEM(caPEM), "failed to parse CA")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+	})))
+	reflection.Register(s)
+	go s.Serve(ln)
+
+	// Ensure that all streams are closed by the end of the test.
+	defer s.GracefulStop()
+
+	tests := []struct {
+		msg       string
+		tlsConfig *tls.Config
+		peers     []string
+		wantErr   string
+	}{
+		{
+			msg:     "plaintext",
+			wantErr: "could not reach reflection server",
+		},
+		{
+			msg:       "unknown authority",
+			tlsConfig: &tls.Config{},
+			wantErr:   "could not reach reflection server",
+		},
+		{
+			msg:       "verified using peer host",
+			tlsConfig: &tls.Config{RootCAs: rootCAs},
+		},
+		{
+			msg:       "verified using the host of each peer",
+			tlsConfig: &tls.Config{RootCAs: rootCAs},
+			peers:     []string{closedPort(t, "127.0.0.2"), ln.Addr().String()},
+		},
+		{
+			msg:       "server name override",
+			tlsConfig: &tls.Config{RootCAs: rootCAs, ServerName: "yab.test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			peers := tt.peers
+			if peers == nil {
+				peers = []string{ln.Addr().String()}
+			}
+			source, err := NewDescriptorProviderReflection(ReflectionArgs{
+				Service:   "test-service",
+				Timeout:   200 * time.Millisecond,
+				Peers:     peers,
+				TLSConfig: tt.tlsConfig,
+			})
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			defer source.Close()
+
+			result, err := source.FindService("grpc.reflection.v1alpha.ServerReflection")
+			assert.NoError(t, err)
+			assert.NotNil(t, result)
+		})
+	}
+}
+
+// closedPort returns a host:port on the given IP that isn't listening.
+func closedPort(t *testing.T, ip string) string {
+	ln, err := net.Listen("tcp", ip+":0")
+	require.NoError(t, err, "failed to listen on a port")
+	ln.Close()
+	return ln.Addr().String()
+}
+
 func TestReflectionNotRegistered(t *testing.T) {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
@@ -0,0 +1,227 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ratelimit
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Arrival processes that can be used with NewArrival.
+const (
+	// Uniform spaces requests evenly.
+	Uniform = "uniform"
+
+	// Poisson spaces requests using exponentially distributed intervals.
+	Poisson = "poisson"
+
+	// Burst allows requests to be sent in bursts using a token bucket.
+	Burst = "burst"
+)
+
+// Arrivals is the list of supported arrival processes.
+var Arrivals = []string{Uniform, Poisson, Burst}
+
+// ArrivalOptions configures the arrival process of a Limiter.
+type ArrivalOptions struct {
+	// Arrival is one of Uniform, Poisson or Burst. Defaults to Uniform.
+	Arrival string
+
+	// Burst is the maximum number of requests in a burst for the Burst
+	// arrival. Defaults to the RPS.
+	Burst int
+
+	// Seed is used to seed the random source for the Poisson arrival, so that
+	// runs are reproducible. If 0, a random seed is used.
+	Seed int64
+}
+
+// ValidateArrival returns an error if the arrival process is not supported.
+func ValidateArrival(arrival string) error {
+	switch arrival {
+	case "", Uniform, Poisson, Burst:
+		return nil
+	}
+	return fmt.Errorf("unknown arrival %q, expected one of: %v", arrival, Arrivals)
+}
+
+// WithDefaults returns the options with defaults filled in for the arrival
+// process: a random seed for Poisson, and a burst of rps for Burst.
+func (o ArrivalOptions) WithDefaults(rps int) ArrivalOptions {
+	switch o.Arrival {
+	case Poisson:
+		if o.Seed == 0 {
+			o.Seed = time.Now().UnixNano()
+		}
+	case Burst:
+		if o.Burst <= 0 {
+			o.Burst = rps
+		}
+	}
+	return o
+}
+
+// NewArrival returns a Limiter that limits to the given RPS, with requests
+// arriving using the specified arrival process.
+func NewArrival(rps int, opts ArrivalOptions) (Limiter, error) {
+	opts = opts.WithDefaults(rps)
+	switch opts.Arrival {
+	case "", Uniform:
+		return New(rps), nil
+	case Poisson:
+		return NewPoisson(rps, opts.Seed), nil
+	case Burst:
+		return NewTokenBucket(rps, opts.Burst), nil
+	}
+	return nil, ValidateArrival(opts.Arrival)
+}
+
+type poisson struct {
+	sync.Mutex
+	timer    *time.Timer
+	rand     *rand.Rand
+	next     time.Time
+	mean     time.Duration
+	maxSlack time.Duration
+}
+
+// NewPoisson returns a Limiter where the time between requests is
+// exponentially distributed, averaging to the given RPS. The random source is
+// seeded using seed.
+func NewPoisson(rps int, seed int64) Limiter {
+	return &poisson{
+		timer:    newStoppedTimer(),
+		rand:     rand.New(rand.NewSource(seed)),
+		mean:     time.Second / time.Duration(rps),
+		maxSlack: -10 * time.Second / time.Duration(rps),
+	}
+}
+
+// nextInterval returns the time until the next request.
+func (p *poisson) nextInterval() time.Duration {
+	return time.Duration(p.rand.ExpFloat64() * float64(p.mean))
+}
+
+// Take blocks until the next arrival of the Poisson process.
+func (p *poisson) Take(cancel <-chan struct{}) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	// If this is our first request, then we allow it.
+	cur := time.Now()
+	if p.next.IsZero() {
+		p.next = cur.Add(p.nextInterval())
+		return true
+	}
+
+	// Similar to timePeriod, we don't let the schedule fall too far behind,
+	// since it would allow a large burst of requests after a slow down.
+	if minNext := cur.Add(p.maxSlack); p.next.Before(minNext) {
+		p.next = minNext
+	}
+
+	if !sleep(p.timer, p.next.Sub(cur), cancel) {
+		return false
+	}
+
+	p.next = p.next.Add(p.nextInterval())
+	return true
+}
+
+type tokenBucket struct {
+	sync.Mutex
+	timer    *time.Timer
+	last     time.Time
+	tokens   float64
+	burst    float64
+	perToken time.Duration
+}
+
+// NewTokenBucket returns a Limiter that limits to the given RPS on average,
+// but allows up to burst requests at once after a period of inactivity.
+func NewTokenBucket(rps, burst int) Limiter {
+	return &tokenBucket{
+		timer:    newStoppedTimer(),
+		tokens:   float64(burst),
+		burst:    float64(burst),
+		perToken: time.Second / time.Duration(rps),
+	}
+}
+
+// Take blocks until a token is available.
+func (t *tokenBucket) Take(cancel <-chan struct{}) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	cur := time.Now()
+	if !t.last.IsZero() {
+		t.tokens += float64(cur.Sub(t.last)) / float64(t.perToken)
+		if t.tokens > t.burst {
+			t.tokens = t.burst
+		}
+	}
+	t.last = cur
+
+	if t.tokens >= 1 {
+		t.tokens--
+		return true
+	}
+
+	// Wait for the next token to be available, and use it straight away.
+	wait := time.Duration((1 - t.tokens) * float64(t.perToken))
+	if !sleep(t.timer, wait, cancel) {
+		return false
+	}
+
+	t.tokens = 0
+	t.last = cur.Add(wait)
+	return true
+}
+
+func newStoppedTimer() *time.Timer {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return timer
+}
+
+// sleep blocks for d using the given stopped timer. It returns false if
+// cancel is closed before d elapses.
+func sleep(timer *time.Timer, d time.Duration, cancel <-chan struct{}) bool {
+	if d <= 0 {
+		return true
+	}
+
+	timer.Reset(d)
+	select {
+	case <-timer.C:
+		return true
+	case <-cancel:
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		return false
+	}
+}
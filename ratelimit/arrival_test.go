@@ -0,0 +1,139 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewArrival(t *testing.T) {
+	tests := []struct {
+		opts    ArrivalOptions
+		want    Limiter
+		wantErr string
+	}{
+		{opts: ArrivalOptions{}, want: &timePeriod{}},
+		{opts: ArrivalOptions{Arrival: Uniform}, want: &timePeriod{}},
+		{opts: ArrivalOptions{Arrival: Poisson}, want: &poisson{}},
+		{opts: ArrivalOptions{Arrival: Burst}, want: &tokenBucket{}},
+		{opts: ArrivalOptions{Arrival: "gaussian"}, wantErr: `unknown arrival "gaussian"`},
+	}
+
+	for _, tt := range tests {
+		got, err := NewArrival(100, tt.opts)
+		if tt.wantErr != "" {
+			if assert.Error(t, err, "NewArrival(%+v) should fail", tt.opts) {
+				assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error for %+v", tt.opts)
+			}
+			continue
+		}
+
+		require.NoError(t, err, "NewArrival(%+v) should not fail", tt.opts)
+		assert.IsType(t, tt.want, got, "Unexpected limiter for %+v", tt.opts)
+	}
+}
+
+func TestArrivalOptionsWithDefaults(t *testing.T) {
+	assert.Equal(t, ArrivalOptions{}, ArrivalOptions{}.WithDefaults(100))
+	assert.Equal(t, ArrivalOptions{Arrival: Burst, Burst: 100}, ArrivalOptions{Arrival: Burst}.WithDefaults(100))
+	assert.Equal(t, ArrivalOptions{Arrival: Burst, Burst: 5}, ArrivalOptions{Arrival: Burst, Burst: 5}.WithDefaults(100))
+	assert.Equal(t, ArrivalOptions{Arrival: Poisson, Seed: 5}, ArrivalOptions{Arrival: Poisson, Seed: 5}.WithDefaults(100))
+	assert.NotZero(t, ArrivalOptions{Arrival: Poisson}.WithDefaults(100).Seed, "Poisson should get a random seed")
+}
+
+func TestPoissonSeed(t *testing.T) {
+	intervals := func(seed int64) []time.Duration {
+		p := NewPoisson(1000, seed).(*poisson)
+		got := make([]time.Duration, 10)
+		for i := range got {
+			got[i] = p.nextInterval()
+		}
+		return got
+	}
+
+	assert.Equal(t, intervals(1), intervals(1), "Same seed should give the same intervals")
+	assert.NotEqual(t, intervals(1), intervals(2), "Different seeds should give different intervals")
+}
+
+func TestPoissonMean(t *testing.T) {
+	const samples = 100000
+	p := NewPoisson(100, 1).(*poisson)
+
+	var total time.Duration
+	for i := 0; i < samples; i++ {
+		total += p.nextInterval()
+	}
+
+	mean := total / samples
+	assert.InDelta(t, float64(10*time.Millisecond), float64(mean), float64(200*time.Microsecond),
+		"Mean interval should match the RPS, got %v", mean)
+}
+
+func TestPoissonRate(t *testing.T) {
+	p := NewPoisson(1000, 1)
+	cancel := make(chan struct{})
+
+	started := time.Now()
+	for i := 0; i < 100; i++ {
+		assert.True(t, p.Take(cancel), "Take should succeed")
+	}
+	elapsed := time.Since(started)
+
+	// 100 requests at 1000 RPS should take ~100ms on average.
+	assert.True(t, elapsed > 30*time.Millisecond && elapsed < 300*time.Millisecond,
+		"Unexpected elapsed time %v", elapsed)
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	tb := NewTokenBucket(100 /* rps */, 5 /* burst */)
+	cancel := make(chan struct{})
+
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.True(t, tb.Take(cancel), "Take should succeed")
+	}
+	assert.True(t, time.Since(started) < 5*time.Millisecond, "Burst should not be limited")
+
+	started = time.Now()
+	assert.True(t, tb.Take(cancel), "Take should succeed")
+	elapsed := time.Since(started)
+	assert.True(t, elapsed > 5*time.Millisecond && elapsed < 15*time.Millisecond,
+		"Request after the burst should wait for a token, expected 5ms < %v < 15ms", elapsed)
+}
+
+func TestTakeCancelled(t *testing.T) {
+	limiters := map[string]Limiter{
+		Poisson: NewPoisson(1, 1),
+		Burst:   NewTokenBucket(1, 1),
+	}
+
+	for name, l := range limiters {
+		cancel := make(chan struct{})
+		assert.True(t, l.Take(cancel), "%v: first Take should succeed", name)
+
+		close(cancel)
+		assert.False(t, l.Take(cancel), "%v: Take after cancel should fail", name)
+	}
+}
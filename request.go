@@ -22,7 +22,7 @@ package main
 
 import (
 	"bytes"
-	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -103,17 +103,10 @@ func NewSerializer(opts Options, resolved resolvedProtocolEncoding) (encoding.Se
 	// procedure check for non-Thrift encodings.
 	switch resolved.enc {
 	case encoding.Thrift:
-		envelope := !opts.ROpts.ThriftDisableEnvelopes
-
-		// TChannel and gRPC never use envelopes.
-		if resolved.protocol == transport.TChannel || resolved.protocol == transport.GRPC {
-			envelope = false
-		}
-
 		return encoding.NewThrift(encoding.ThriftParams{
 			File:        opts.ROpts.ThriftFile,
 			Method:      opts.ROpts.Procedure,
-			Envelope:    envelope,
+			Envelope:    thriftEnvelopes(opts.ROpts, resolved.protocol),
 			Multiplexed: opts.ROpts.ThriftMultiplexed,
 		})
 	case encoding.Protobuf:
@@ -139,11 +132,33 @@ func NewSerializer(opts Options, resolved resolvedProtocolEncoding) (encoding.Se
 	return nil, errUnrecognizedEncoding
 }
 
+// thriftEnvelopes returns whether Thrift requests are enveloped for the protocol.
+func thriftEnvelopes(rOpts RequestOptions, protocol transport.Protocol) bool {
+	// TChannel and gRPC never use envelopes.
+	if protocol == transport.TChannel || protocol == transport.GRPC {
+		return false
+	}
+	return !rOpts.ThriftDisableEnvelopes
+}
+
 func newProtoDescriptorProvider(ropts RequestOptions, topts TransportOptions, resolved resolvedProtocolEncoding) (protobuf.DescriptorProvider, error) {
 	if len(ropts.FileDescriptorSet) > 0 {
 		return protobuf.NewDescriptorProviderFileDescriptorSetBins(ropts.FileDescriptorSet...)
 	}
 
+	var tlsConfig *tls.Config
+	if tlsOpts := grpcTLSOptions(topts); tlsOpts != nil {
+		var err error
+		if tlsConfig, err = tlsOpts.Config(); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer, err := transport.NewGRPCDialer(topts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
 	return protobuf.NewDescriptorProviderReflection(protobuf.ReflectionArgs{
 		Caller:          topts.CallerName,
 		Service:         topts.ServiceName,
@@ -151,6 +166,8 @@ func newProtoDescriptorProvider(ropts RequestOptions, topts TransportOptions, re
 		RoutingKey:      topts.RoutingKey,
 		Peers:           getHosts(topts.Peers),
 		Timeout:         ropts.Timeout.Duration(),
+		TLSConfig:       tlsConfig,
+		Dialer:          dialer,
 	})
 }
 
@@ -170,9 +187,9 @@ func (opts RequestOptions) detectEncoding() encoding.Encoding {
 	return encoding.UnspecifiedEncoding
 }
 
-// prepares the request by injecting metadata, applying plugin-based transport middleware,
-// before finally adding any user-provided override values
-func prepareRequest(req *transport.Request, headers map[string]string, opts Options) (*transport.Request, error) {
+// prepares the request by injecting metadata, before finally adding any
+// user-provided override values. Transport middleware is applied to each call.
+func prepareRequest(req *transport.Request, headers map[string]string, opts Options) *transport.Request {
 	// Apply command line arguments
 	timeout := opts.ROpts.Timeout.Duration()
 	if timeout == 0 {
@@ -186,9 +203,5 @@ func prepareRequest(req *transport.Request, headers map[string]string, opts Opti
 	// Add request metadata
 	req.TargetService = opts.TOpts.ServiceName
 	req.ShardKey = opts.TOpts.ShardKey
-
-	// Apply middleware
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-	return transport.ApplyInterceptor(ctx, req)
+	return req
 }
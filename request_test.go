@@ -34,6 +34,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -461,8 +462,7 @@ func TestDetectEncoding(t *testing.T) {
 func TestNewRequestWithMetadata(t *testing.T) {
 	req := &transport.Request{Method: "foo"}
 	topts := TransportOptions{ServiceName: "bar", ShardKey: "baz"}
-	req, err := prepareRequest(req, nil /* headers */, Options{TOpts: topts})
-	assert.NoError(t, err)
+	req = prepareRequest(req, nil /* headers */, Options{TOpts: topts})
 	assert.Equal(t, "foo", req.Method)
 	assert.Equal(t, "bar", req.TargetService)
 	assert.Equal(t, "baz", req.ShardKey)
@@ -473,10 +473,35 @@ func TestNewRequestWithTransportMiddleware(t *testing.T) {
 	topts := TransportOptions{ServiceName: "bar"}
 	restore := transport.RegisterInterceptor(mockRequestInterceptor{method: "baz"})
 	defer restore()
-	req, err := prepareRequest(req, nil /* headers */, Options{TOpts: topts})
-	assert.NoError(t, err)
-	assert.Equal(t, "baz", req.Method)
-	assert.Equal(t, "bar", req.TargetService)
+	req = prepareRequest(req, nil /* headers */, Options{TOpts: topts})
+	assert.Equal(t, "foo", req.Method, "middleware should be applied to each call, not the prepared request")
+
+	ct := &captureTransport{}
+	_, err := makeRequest(ct, req)
+	require.NoError(t, err)
+	require.Len(t, ct.requests, 1)
+	assert.Equal(t, "baz", ct.requests[0].Method)
+	assert.Equal(t, "bar", ct.requests[0].TargetService)
+	assert.Equal(t, "foo", req.Method, "middleware should not modify the shared request")
+}
+
+// captureTransport records requests and returns empty responses.
+type captureTransport struct {
+	protocol transport.Protocol
+	requests []*transport.Request
+}
+
+func (t *captureTransport) Call(_ context.Context, r *transport.Request) (*transport.Response, error) {
+	t.requests = append(t.requests, r)
+	return &transport.Response{}, nil
+}
+
+func (t *captureTransport) Protocol() transport.Protocol {
+	return t.protocol
+}
+
+func (t *captureTransport) Tracer() opentracing.Tracer {
+	return nil
 }
 
 type mockRequestInterceptor struct {
@@ -516,8 +541,7 @@ func TestNewRequestWithCLIOverrides(t *testing.T) {
 		},
 	}
 	headers := map[string]string{"bing": "bong"}
-	finalReq, err := prepareRequest(req, headers, opts)
-	assert.NoError(t, err)
+	finalReq := prepareRequest(req, headers, opts)
 	assert.Equal(t, "foo", finalReq.Method)
 	assert.Equal(t, 10*time.Second, finalReq.Timeout)
 	assert.Equal(t, "large", finalReq.Baggage["size"])
@@ -533,11 +557,17 @@ func TestPrepareRequest(t *testing.T) {
 		TOpts: TransportOptions{ServiceName: "baz"},
 		ROpts: RequestOptions{Baggage: map[string]string{"size": "large"}},
 	}
-	req, err := prepareRequest(rawReq, nil /* headers */, opts)
-	assert.NoError(t, err)
+	req := prepareRequest(rawReq, nil /* headers */, opts)
 	assert.Equal(t, "foo", req.Method)
 	assert.Equal(t, "baz", req.TargetService)
-	assert.Equal(t, "medium", req.Baggage["size"])
+	assert.Equal(t, "large", req.Baggage["size"])
+
+	ct := &captureTransport{}
+	_, err := makeRequest(ct, req)
+	require.NoError(t, err)
+	require.Len(t, ct.requests, 1)
+	assert.Equal(t, "medium", ct.requests[0].Baggage["size"], "middleware should override CLI baggage")
+	assert.Equal(t, "large", req.Baggage["size"], "middleware should not modify the shared baggage")
 }
 
 func TestPrepareRequestErr(t *testing.T) {
@@ -545,17 +575,23 @@ func TestPrepareRequestErr(t *testing.T) {
 	ri := mockRequestInterceptor{shouldErr: true}
 	restore := transport.RegisterInterceptor(ri)
 	defer restore()
-	req, err := prepareRequest(req, nil /* headers */, Options{})
-	assert.Error(t, err)
-	assert.Nil(t, req)
+	req = prepareRequest(req, nil /* headers */, Options{})
+
+	ct := &captureTransport{}
+	_, err := makeRequest(ct, req)
+	assert.EqualError(t, err, "bad apply")
+	assert.Empty(t, ct.requests, "request should not be made if middleware fails")
 }
 
 func resolveOpts(t *testing.T, opts Options) (Options, resolvedProtocolEncoding) {
-	scheme, peers, err := loadTransportPeers(opts.TOpts)
+	peers, weights, err := loadTransportPeers(opts.TOpts)
 	require.NoError(t, err, "failed to load peers")
 
 	opts.TOpts.Peers = peers
+	opts.TOpts.PeerWeights = weights
 
-	resolved := resolveProtocolEncoding(scheme, opts.ROpts)
-	return opts, resolved
+	groups, err := groupPeersByProtocol(peers, opts.ROpts)
+	require.NoError(t, err, "failed to group peers")
+	require.Len(t, groups, 1, "peers should use a single protocol")
+	return opts, groups[0].resolved
 }
@@ -0,0 +1,234 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+
+	"github.com/uber/tchannel-go"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+const (
+	_defaultRetryOn      = "unavailable,timeout"
+	_defaultRetryBackoff = "100ms..2s"
+
+	_rpcErrorCodeHeader = "Rpc-Error-Code"
+)
+
+var _tchannelErrCodes = map[string]tchannel.SystemErrCode{
+	"timeout":     tchannel.ErrCodeTimeout,
+	"cancelled":   tchannel.ErrCodeCancelled,
+	"busy":        tchannel.ErrCodeBusy,
+	"declined":    tchannel.ErrCodeDeclined,
+	"unexpected":  tchannel.ErrCodeUnexpected,
+	"bad-request": tchannel.ErrCodeBadRequest,
+	"network":     tchannel.ErrCodeNetwork,
+	"protocol":    tchannel.ErrCodeProtocol,
+}
+
+// retryPolicy decides whether failed one-off requests are retried, and how
+// long to wait between attempts.
+type retryPolicy struct {
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	codes         map[yarpcerrors.Code]bool
+	tchannelCodes map[tchannel.SystemErrCode]bool
+	httpCodes     transport.StatusCodes
+
+	// sleep waits between attempts, and is replaced in tests.
+	sleep func(time.Duration)
+}
+
+func newRetryPolicy(opts RequestOptions) (retryPolicy, error) {
+	policy := retryPolicy{
+		retries:       opts.Retries,
+		codes:         make(map[yarpcerrors.Code]bool),
+		tchannelCodes: make(map[tchannel.SystemErrCode]bool),
+		sleep:         time.Sleep,
+	}
+	if opts.Retries < 0 {
+		return policy, fmt.Errorf("retries must not be negative, got %v", opts.Retries)
+	}
+
+	backoff := opts.RetryBackoff
+	if backoff == "" {
+		backoff = _defaultRetryBackoff
+	}
+	var err error
+	if policy.minBackoff, policy.maxBackoff, err = parseRetryBackoff(backoff); err != nil {
+		return policy, err
+	}
+
+	retryOn := opts.RetryOn
+	if retryOn == "" {
+		retryOn = _defaultRetryOn
+	}
+	for _, cond := range strings.Split(retryOn, ",") {
+		if err := policy.addCondition(strings.TrimSpace(cond)); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+// parseRetryBackoff parses either a fixed backoff, such as "1s", or a range
+// such as "100ms..2s", where the backoff doubles after each retry.
+func parseRetryBackoff(s string) (min, max time.Duration, err error) {
+	minStr, maxStr := s, s
+	if i := strings.Index(s, ".."); i >= 0 {
+		minStr, maxStr = s[:i], s[i+2:]
+	}
+
+	if min, err = time.ParseDuration(minStr); err != nil {
+		return 0, 0, fmt.Errorf("invalid retry backoff %q: %v", s, err)
+	}
+	if max, err = time.ParseDuration(maxStr); err != nil {
+		return 0, 0, fmt.Errorf("invalid retry backoff %q: %v", s, err)
+	}
+	if min < 0 || min > max {
+		return 0, 0, fmt.Errorf("invalid retry backoff %q: must be a non-negative range", s)
+	}
+	return min, max, nil
+}
+
+// addCondition adds an error to retry, which may be a yarpcerrors code, a
+// TChannel error code, or HTTP status codes. Names used by both YARPC and
+// TChannel, such as cancelled, match either.
+func (p *retryPolicy) addCondition(cond string) error {
+	if cond == "" {
+		return nil
+	}
+
+	if cond[0] >= '0' && cond[0] <= '9' {
+		codes, err := transport.ParseStatusCodes(cond)
+		if err != nil {
+			return fmt.Errorf("invalid retry condition: %v", err)
+		}
+		p.httpCodes = append(p.httpCodes, codes...)
+		return nil
+	}
+
+	var matched bool
+	var code yarpcerrors.Code
+	if err := code.UnmarshalText([]byte(cond)); err == nil {
+		p.codes[code] = true
+		matched = true
+	}
+	if code, ok := _tchannelErrCodes[cond]; ok {
+		p.tchannelCodes[code] = true
+		matched = true
+	}
+	if cond == "timeout" {
+		p.codes[yarpcerrors.CodeDeadlineExceeded] = true
+	}
+
+	if !matched {
+		return fmt.Errorf("unknown retry condition %q, must be a YARPC error code, TChannel error code or HTTP status code", cond)
+	}
+	return nil
+}
+
+// shouldRetry returns whether a request that failed with err can be retried.
+func (p retryPolicy) shouldRetry(err error) bool {
+	if statusErr, ok := asHTTPStatusError(err); ok {
+		if p.httpCodes.Contains(statusErr.StatusCode) {
+			return true
+		}
+
+		// YARPC HTTP servers also return the YARPC error code in a header.
+		var code yarpcerrors.Code
+		if err := code.UnmarshalText([]byte(statusErr.Response.Headers[_rpcErrorCodeHeader])); err == nil {
+			return p.codes[code]
+		}
+		return false
+	}
+	if yarpcerrors.IsStatus(err) {
+		return p.codes[yarpcerrors.FromError(err).Code()]
+	}
+
+	var systemErr tchannel.SystemError
+	if errors.As(err, &systemErr) {
+		return p.tchannelCodes[systemErr.Code()]
+	}
+
+	// Errors that don't come from the peer are matched using the closest
+	// YARPC error code.
+	if errors.Is(err, context.DeadlineExceeded) {
+		return p.codes[yarpcerrors.CodeDeadlineExceeded]
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return p.codes[yarpcerrors.CodeDeadlineExceeded]
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return p.codes[yarpcerrors.CodeUnavailable]
+	}
+	return false
+}
+
+// backoff returns how long to wait before the given retry, starting from 1.
+func (p retryPolicy) backoff(retry int) time.Duration {
+	d := p.minBackoff
+	for i := 1; i < retry && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	return d
+}
+
+// call makes a request using makeRequest, retrying failures allowed by the
+// policy. It returns the result of the last attempt.
+func (p retryPolicy) call(logger *zap.Logger, makeRequest func() (*transport.Response, error)) (*transport.Response, error) {
+	for attempt := 1; ; attempt++ {
+		// Retries are logged as warnings so they're shown by default.
+		log := logger.Info
+		if attempt > 1 {
+			log = logger.Warn
+		}
+		log("Making request.", zap.Int("attempt", attempt), zap.Int("maxAttempts", p.retries+1))
+		response, err := makeRequest()
+		if err == nil || attempt > p.retries || !p.shouldRetry(err) {
+			return response, err
+		}
+
+		backoff := p.backoff(attempt)
+		logger.Warn("Request failed, retrying.",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		p.sleep(backoff)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNewRetryPolicyErrors(t *testing.T) {
+	tests := []struct {
+		opts    RequestOptions
+		wantErr string
+	}{
+		{
+			opts:    RequestOptions{Retries: -1},
+			wantErr: "retries must not be negative",
+		},
+		{
+			opts:    RequestOptions{RetryBackoff: "fast"},
+			wantErr: `invalid retry backoff "fast"`,
+		},
+		{
+			opts:    RequestOptions{RetryBackoff: "1s..100ms"},
+			wantErr: "must be a non-negative range",
+		},
+		{
+			opts:    RequestOptions{RetryBackoff: "100ms..soon"},
+			wantErr: `invalid retry backoff "100ms..soon"`,
+		},
+		{
+			opts:    RequestOptions{RetryOn: "unavailable,oops"},
+			wantErr: `unknown retry condition "oops"`,
+		},
+		{
+			opts:    RequestOptions{RetryOn: "500-400"},
+			wantErr: "invalid retry condition",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := newRetryPolicy(tt.opts)
+		require.Error(t, err, "Expected error for %+v", tt.opts)
+		assert.Contains(t, err.Error(), tt.wantErr, "Unexpected error for %+v", tt.opts)
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	httpErr := func(code int, headers map[string]string) error {
+		return &transport.HTTPStatusError{
+			StatusCode: code,
+			Response:   &transport.Response{Headers: headers},
+		}
+	}
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		retryOn string
+		err     error
+		want    bool
+	}{
+		{retryOn: "", err: yarpcerrors.UnavailableErrorf("down"), want: true},
+		{retryOn: "", err: yarpcerrors.DeadlineExceededErrorf("slow"), want: true},
+		{retryOn: "", err: yarpcerrors.InternalErrorf("bug"), want: false},
+		{retryOn: "", err: tchannel.ErrTimeout, want: true},
+		{retryOn: "", err: fmt.Errorf("begin call failed: %w", tchannel.ErrTimeout), want: true},
+		{retryOn: "", err: tchannel.NewSystemError(tchannel.ErrCodeBusy, "busy"), want: false},
+		{retryOn: "", err: context.DeadlineExceeded, want: true},
+		{retryOn: "", err: dialErr, want: true},
+		{retryOn: "", err: errors.New("unknown"), want: false},
+		{retryOn: "", err: httpErr(503, nil), want: false},
+		{retryOn: "", err: httpErr(503, map[string]string{"Rpc-Error-Code": "unavailable"}), want: true},
+		{retryOn: "internal", err: yarpcerrors.InternalErrorf("bug"), want: true},
+		{retryOn: "internal", err: yarpcerrors.UnavailableErrorf("down"), want: false},
+		{retryOn: "internal", err: dialErr, want: false},
+		{retryOn: "busy, declined", err: tchannel.NewSystemError(tchannel.ErrCodeBusy, "busy"), want: true},
+		{retryOn: "busy, declined", err: tchannel.NewSystemError(tchannel.ErrCodeDeclined, "declined"), want: true},
+		{retryOn: "busy, declined", err: tchannel.ErrTimeout, want: false},
+		{retryOn: "cancelled", err: tchannel.NewSystemError(tchannel.ErrCodeCancelled, "cancelled"), want: true},
+		{retryOn: "cancelled", err: yarpcerrors.CancelledErrorf("cancelled"), want: true},
+		{retryOn: "503", err: httpErr(503, nil), want: true},
+		{retryOn: "503", err: httpErr(502, nil), want: false},
+		{retryOn: "503", err: fmt.Errorf("call failed: %w", httpErr(503, nil)), want: true},
+		{retryOn: "500-599", err: httpErr(502, nil), want: true},
+		{retryOn: "500-599", err: httpErr(404, nil), want: false},
+	}
+
+	for _, tt := range tests {
+		policy, err := newRetryPolicy(RequestOptions{RetryOn: tt.retryOn})
+		require.NoError(t, err, "Failed to create policy for %q", tt.retryOn)
+		assert.Equal(t, tt.want, policy.shouldRetry(tt.err), "Unexpected retry for %q with error %v", tt.retryOn, tt.err)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		backoff string
+		want    []time.Duration
+	}{
+		{
+			backoff: "",
+			want:    []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, 1600 * time.Millisecond, 2 * time.Second, 2 * time.Second},
+		},
+		{
+			backoff: "1s",
+			want:    []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			backoff: "0s..1s",
+			want:    []time.Duration{0, 0},
+		},
+		{
+			backoff: "300ms..1s",
+			want:    []time.Duration{300 * time.Millisecond, 600 * time.Millisecond, time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		policy, err := newRetryPolicy(RequestOptions{RetryBackoff: tt.backoff})
+		require.NoError(t, err, "Failed to create policy for %q", tt.backoff)
+
+		for i, want := range tt.want {
+			assert.Equal(t, want, policy.backoff(i+1), "Unexpected backoff for %q retry %v", tt.backoff, i+1)
+		}
+	}
+}
+
+func TestRetryPolicyCall(t *testing.T) {
+	unavailable := yarpcerrors.UnavailableErrorf("down")
+	tests := []struct {
+		msg          string
+		retries      int
+		errs         []error
+		wantAttempts int
+		wantErr      error
+		wantSleeps   []time.Duration
+	}{
+		{
+			msg:          "success",
+			retries:      3,
+			errs:         []error{nil},
+			wantAttempts: 1,
+		},
+		{
+			msg:          "no retries",
+			retries:      0,
+			errs:         []error{unavailable},
+			wantAttempts: 1,
+			wantErr:      unavailable,
+		},
+		{
+			msg:          "success after retries",
+			retries:      3,
+			errs:         []error{unavailable, unavailable, nil},
+			wantAttempts: 3,
+			wantSleeps:   []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+		},
+		{
+			msg:          "retries exhausted",
+			retries:      2,
+			errs:         []error{unavailable, unavailable, unavailable, nil},
+			wantAttempts: 3,
+			wantErr:      unavailable,
+			wantSleeps:   []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+		},
+		{
+			msg:          "error not retried",
+			retries:      3,
+			errs:         []error{unavailable, yarpcerrors.InternalErrorf("bug")},
+			wantAttempts: 2,
+			wantErr:      yarpcerrors.InternalErrorf("bug"),
+			wantSleeps:   []time.Duration{10 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			policy, err := newRetryPolicy(RequestOptions{Retries: tt.retries, RetryBackoff: "10ms..1s"})
+			require.NoError(t, err, "Failed to create policy")
+
+			var sleeps []time.Duration
+			policy.sleep = func(d time.Duration) {
+				sleeps = append(sleeps, d)
+			}
+
+			core, logs := observer.New(zap.InfoLevel)
+			var attempts int
+			_, err = policy.call(zap.New(core), func() (*transport.Response, error) {
+				attempts++
+				return &transport.Response{}, tt.errs[attempts-1]
+			})
+
+			assert.Equal(t, tt.wantErr, err, "Unexpected error")
+			assert.Equal(t, tt.wantAttempts, attempts, "Unexpected number of attempts")
+			assert.Equal(t, tt.wantSleeps, sleeps, "Unexpected backoffs")
+			assert.Equal(t, tt.wantAttempts, logs.FilterMessage("Making request.").Len(), "Each attempt should be logged")
+			retried := logs.FilterMessage("Making request.").Filter(func(e observer.LoggedEntry) bool {
+				return e.Level == zap.WarnLevel
+			})
+			assert.Equal(t, tt.wantAttempts-1, retried.Len(), "Retried attempts should be logged as warnings")
+			assert.Equal(t, len(tt.wantSleeps), logs.FilterMessage("Request failed, retrying.").Len(), "Each retry should be logged")
+		})
+	}
+}
@@ -57,6 +57,68 @@ type template struct {
 	Request           map[interface{}]interface{}   `yaml:"request"`
 	Requests          []map[interface{}]interface{} `yaml:"requests"`
 	Timeout           time.Duration                 `yaml:"timeout"`
+
+	TLS       tlsTemplate       `yaml:"tls"`
+	Retry     retryTemplate     `yaml:"retry"`
+	Benchmark benchmarkTemplate `yaml:"benchmark"`
+}
+
+// tlsTemplate contains the TLS options that can be specified in a template.
+// File paths are relative to the template.
+type tlsTemplate struct {
+	CA                 string `yaml:"ca"`
+	Cert               string `yaml:"cert"`
+	Key                string `yaml:"key"`
+	ServerName         string `yaml:"serverName" yaml-aliases:"servername,server-name"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify" yaml-aliases:"insecureskipverify,insecure-skip-verify"`
+}
+
+func (t *tlsTemplate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Use a type without the UnmarshalYAML method to avoid recursing.
+	type plain tlsTemplate
+	return unmarshal(yamlalias.Wrap((*plain)(t)))
+}
+
+// retryTemplate contains the retry options that can be specified in a
+// template. The errors to retry can be listed instead of comma-separated.
+type retryTemplate struct {
+	Retries int      `yaml:"retries"`
+	Backoff string   `yaml:"backoff"`
+	RetryOn []string `yaml:"retryOn" yaml-aliases:"retryon,retry-on"`
+}
+
+func (r *retryTemplate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Use a type without the UnmarshalYAML method to avoid recursing.
+	type plain retryTemplate
+	return unmarshal(yamlalias.Wrap((*plain)(r)))
+}
+
+// benchmarkTemplate contains the benchmark options that can be specified
+// in a template. Values left unset do not change the benchmark options.
+type benchmarkTemplate struct {
+	MaxRequests     int           `yaml:"maxRequests" yaml-aliases:"maxrequests,max-requests"`
+	MaxDuration     time.Duration `yaml:"maxDuration" yaml-aliases:"maxduration,max-duration"`
+	CPUs            int           `yaml:"cpus"`
+	Connections     int           `yaml:"connections"`
+	Warmup          *int          `yaml:"warmup"`
+	Concurrency     int           `yaml:"concurrency"`
+	RPS             int           `yaml:"rps"`
+	Arrival         string        `yaml:"arrival"`
+	Burst           int           `yaml:"burst"`
+	ArrivalSeed     int64         `yaml:"arrivalSeed" yaml-aliases:"arrivalseed,arrival-seed"`
+	ReconnectEvery  int           `yaml:"reconnectEvery" yaml-aliases:"reconnectevery,reconnect-every"`
+	PeerRefresh     time.Duration `yaml:"peerRefresh" yaml-aliases:"peerrefresh,peer-refresh"`
+	TraceSampleRate float64       `yaml:"traceSampleRate" yaml-aliases:"tracesamplerate,trace-sample-rate"`
+	Hedge           string        `yaml:"hedge"`
+	Statsd          string        `yaml:"statsd"`
+	PerPeerStats    bool          `yaml:"perPeerStats" yaml-aliases:"perpeerstats,per-peer-stats"`
+	Format          string        `yaml:"format"`
+}
+
+func (b *benchmarkTemplate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Use a type without the UnmarshalYAML method to avoid recursing.
+	type plain benchmarkTemplate
+	return unmarshal(yamlalias.Wrap((*plain)(b)))
 }
 
 func readYAMLFile(yamlTemplate string, templateArgs map[string]string, opts *Options) error {
@@ -179,15 +241,100 @@ func readYAMLRequest(base string, contents []byte, templateArgs map[string]strin
 	if t.Timeout != 0 {
 		opts.ROpts.Timeout = timeMillisFlag(t.Timeout)
 	}
+
+	if err := overrideTLSOptions(base, &opts.TOpts.TLS, t.TLS); err != nil {
+		return err
+	}
+
+	overrideRetryOptions(&opts.ROpts, t.Retry)
+	overrideBenchmarkOptions(&opts.BOpts, t.Benchmark)
+	return nil
+}
+
+// overrideRetryOptions applies retry options from a template.
+func overrideRetryOptions(opts *RequestOptions, t retryTemplate) {
+	overrideInt(&opts.Retries, t.Retries)
+	overrideParam(&opts.RetryBackoff, t.Backoff)
+	overrideParam(&opts.RetryOn, strings.Join(t.RetryOn, ","))
+}
+
+// overrideTLSOptions applies TLS options from a template, resolving any
+// file paths relative to the template's base directory.
+func overrideTLSOptions(base string, opts *TLSOptions, t tlsTemplate) error {
+	files := []struct {
+		dest *string
+		path string
+	}{
+		{&opts.CAFile, t.CA},
+		{&opts.CertFile, t.Cert},
+		{&opts.KeyFile, t.Key},
+	}
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+
+		fileURL, err := resolve(base, f.path)
+		if err != nil {
+			return err
+		}
+		*f.dest = fileURL.Path
+	}
+
+	overrideParam(&opts.ServerName, t.ServerName)
+	if t.InsecureSkipVerify {
+		opts.InsecureSkipVerify = true
+	}
 	return nil
 }
 
+// overrideBenchmarkOptions applies benchmark options from a template.
+// Since templates are read before flags are parsed, any benchmark flags
+// specified on the command line override these values.
+func overrideBenchmarkOptions(opts *BenchmarkOptions, t benchmarkTemplate) {
+	overrideInt(&opts.MaxRequests, t.MaxRequests)
+	if t.MaxDuration != 0 {
+		opts.MaxDuration = t.MaxDuration
+	}
+	overrideInt(&opts.NumCPUs, t.CPUs)
+	overrideInt(&opts.Connections, t.Connections)
+	if t.Warmup != nil {
+		opts.WarmupRequests = *t.Warmup
+	}
+	overrideInt(&opts.Concurrency, t.Concurrency)
+	overrideInt(&opts.RPS, t.RPS)
+	overrideParam(&opts.Arrival, t.Arrival)
+	overrideInt(&opts.Burst, t.Burst)
+	if t.ArrivalSeed != 0 {
+		opts.ArrivalSeed = t.ArrivalSeed
+	}
+	overrideInt(&opts.ReconnectEvery, t.ReconnectEvery)
+	if t.PeerRefresh != 0 {
+		opts.PeerRefresh = t.PeerRefresh
+	}
+	if t.TraceSampleRate != 0 {
+		opts.TraceSampleRate = t.TraceSampleRate
+	}
+	overrideParam(&opts.Hedge, t.Hedge)
+	overrideParam(&opts.StatsdHostPort, t.Statsd)
+	if t.PerPeerStats {
+		opts.PerPeerStats = true
+	}
+	overrideParam(&opts.Format, t.Format)
+}
+
 func overrideParam(s *string, newS string) {
 	if newS != "" {
 		*s = newS
 	}
 }
 
+func overrideInt(i *int, newI int) {
+	if newI != 0 {
+		*i = newI
+	}
+}
+
 type headers map[string]string
 
 // In these cases, the existing item (target, from flags) overrides the source
@@ -82,6 +82,69 @@ func TestTemplate(t *testing.T) {
 	assert.True(t, opts.ROpts.ThriftDisableEnvelopes)
 }
 
+func TestTLSTemplate(t *testing.T) {
+	opts := newOptions()
+	mustReadYAMLFile(t, "testdata/templates/tls.yab", opts)
+
+	assert.Equal(t, TLSOptions{
+		CAFile:             toAbsPath(t, "testdata/tls/ca.pem"),
+		CertFile:           toAbsPath(t, "testdata/tls/client.pem"),
+		KeyFile:            "/etc/yab/client-key.pem",
+		ServerName:         "yab.test",
+		InsecureSkipVerify: true,
+	}, opts.TOpts.TLS)
+}
+
+func TestRetryTemplate(t *testing.T) {
+	opts := newOptions()
+	mustReadYAMLFile(t, "testdata/templates/retry.yab", opts)
+
+	assert.Equal(t, 3, opts.ROpts.Retries)
+	assert.Equal(t, "50ms..1s", opts.ROpts.RetryBackoff)
+	assert.Equal(t, "unavailable,busy,503", opts.ROpts.RetryOn)
+
+	opts = newOptions()
+	opts.ROpts.RetryOn = "timeout"
+	mustReadYAMLRequest(t, "retry: {retries: 1}", opts)
+	assert.Equal(t, 1, opts.ROpts.Retries)
+	assert.Empty(t, opts.ROpts.RetryBackoff, "unset template values should not change options")
+	assert.Equal(t, "timeout", opts.ROpts.RetryOn, "unset template values should not change options")
+}
+
+func TestBenchmarkTemplate(t *testing.T) {
+	opts := newOptions()
+	mustReadYAMLFile(t, "testdata/templates/benchmark.yab", opts)
+
+	assert.Equal(t, BenchmarkOptions{
+		MaxRequests:     1000,
+		MaxDuration:     30 * time.Second,
+		NumCPUs:         2,
+		Connections:     4,
+		WarmupRequests:  0,
+		Concurrency:     8,
+		RPS:             500,
+		Arrival:         "burst",
+		Burst:           50,
+		ArrivalSeed:     7,
+		ReconnectEvery:  100,
+		PeerRefresh:     30 * time.Second,
+		TraceSampleRate: 0.01,
+		Hedge:           "p95",
+		StatsdHostPort:  "localhost:8125",
+		PerPeerStats:    true,
+		Format:          "json",
+	}, opts.BOpts)
+}
+
+func TestBenchmarkTemplateUnset(t *testing.T) {
+	opts := newOptions()
+	mustReadYAMLRequest(t, "benchmark: {rps: 10}", opts)
+
+	want := newOptions().BOpts
+	want.RPS = 10
+	assert.Equal(t, want, opts.BOpts, "unset template values should not change options")
+}
+
 func TestTemplateRequestsField(t *testing.T) {
 	t.Run("only requests field set", func(t *testing.T) {
 		opts := newOptions()
@@ -391,6 +454,10 @@ func TestReadYAMLRequestFails(t *testing.T) {
 			yamlTemplate: "testdata/templates/bad-arg.yaml",
 			wantErr:      "cannot parse",
 		},
+		{
+			yamlTemplate: "testdata/templates/bad-benchmark.yaml",
+			wantErr:      "field requests not found",
+		},
 	}
 
 	for _, tt := range tests {
@@ -25,11 +25,14 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/yarpc/yab/internal/httpclient"
 	"github.com/yarpc/yab/peerprovider"
+	"github.com/yarpc/yab/peerselect"
 	"github.com/yarpc/yab/transport"
 
 	"github.com/opentracing/opentracing-go"
@@ -37,11 +40,12 @@ import (
 )
 
 var (
-	errServiceRequired = errors.New("specify a target service using --service")
-	errCallerRequired  = errors.New("caller name is required")
-	errTracerRequired  = errors.New("tracer is required, or explicit NoopTracer")
-	errPeerRequired    = errors.New("specify at least one peer using --peer or using --peer-list")
-	errPeerOptions     = errors.New("do not specify peers using --peer and --peer-list")
+	errServiceRequired  = errors.New("specify a target service using --service")
+	errCallerRequired   = errors.New("caller name is required")
+	errTracerRequired   = errors.New("tracer is required, or explicit NoopTracer")
+	errPeerRequired     = errors.New("specify at least one peer using --peer or using --peer-list")
+	errPeerOptions      = errors.New("do not specify peers using --peer and --peer-list")
+	errRESTRequiresHTTP = errors.New("--rest can only be used with HTTP peers")
 )
 
 func remapLocalHost(hostPorts []string) {
@@ -63,6 +67,11 @@ func parsePeer(peer string) (protocol, host string) {
 		return "", peer
 	}
 
+	// Peers that listen on a unix domain socket use the socket as the host.
+	if protocol, socket, _, ok := transport.ParseUnixPeer(peer); ok {
+		return protocol, transport.UnixAddress(socket)
+	}
+
 	u, err := url.ParseRequestURI(peer)
 	if err != nil {
 		return "", peer
@@ -71,15 +80,88 @@ func parsePeer(peer string) (protocol, host string) {
 	return u.Scheme, u.Host
 }
 
-// ensureSameProtocol must get at least one host:port.
-func ensureSameProtocol(peers []string) (string, error) {
-	lastProtocol, _ := parsePeer(peers[0])
-	for _, hp := range peers[1:] {
-		if p, _ := parsePeer(hp); lastProtocol != p {
-			return "", fmt.Errorf("found mixed protocols, expected all to be %v, got %v", lastProtocol, p)
+// schemeProtocol returns the protocol for a peer's scheme, or Unknown if
+// the scheme doesn't determine the protocol.
+func schemeProtocol(scheme string) transport.Protocol {
+	switch scheme {
+	case "tchannel":
+		return transport.TChannel
+	case "grpc":
+		return transport.GRPC
+	case "http", "https":
+		return transport.HTTP
+	}
+	return transport.Unknown
+}
+
+// protocolGroup is a group of peers that are called using the same protocol.
+type protocolGroup struct {
+	resolved resolvedProtocolEncoding
+	peers    []int // indexes of the peers in the peer list
+}
+
+// transportOptions returns the options for a transport to the group's peers.
+func (g protocolGroup) transportOptions(opts TransportOptions) TransportOptions {
+	peers := make([]string, len(g.peers))
+	for i, peer := range g.peers {
+		peers[i] = opts.Peers[peer]
+	}
+
+	var weights []int
+	if len(opts.PeerWeights) > 0 {
+		weights = make([]int, len(g.peers))
+		for i, peer := range g.peers {
+			weights[i] = opts.PeerWeights[peer]
+		}
+	}
+
+	opts.Peers = peers
+	opts.PeerWeights = weights
+	return opts
+}
+
+// groupPeersByProtocol groups peers by the protocol used to call them, in the
+// order that protocols are first seen. Peers may use different protocols, but
+// they must all use the same encoding.
+func groupPeersByProtocol(peers []string, rOpts RequestOptions) ([]protocolGroup, error) {
+	var groups []protocolGroup
+	for peerIndex, peer := range peers {
+		scheme, _ := parsePeer(peer)
+		resolved := resolveProtocolEncoding(scheme, rOpts)
+
+		i := 0
+		for i < len(groups) && groups[i].resolved.protocol != resolved.protocol {
+			i++
+		}
+		if i == len(groups) {
+			if len(groups) > 0 && groups[0].resolved.enc != resolved.enc {
+				return nil, fmt.Errorf("%v peers use %v encoding, but %v peers use %v encoding, specify the encoding using --encoding",
+					groups[0].resolved.protocol, groups[0].resolved.enc, resolved.protocol, resolved.enc)
+			}
+			groups = append(groups, protocolGroup{resolved: resolved})
 		}
+		groups[i].peers = append(groups[i].peers, peerIndex)
 	}
-	return lastProtocol, nil
+	return groups, nil
+}
+
+// peersProtocol returns the protocol used to call all of the peers. Peers
+// without a scheme that determines the protocol use the resolved protocol.
+func peersProtocol(peers []string, resolved transport.Protocol) (transport.Protocol, error) {
+	protocol := resolved
+	for i, peer := range peers {
+		scheme, _ := parsePeer(peer)
+		p := schemeProtocol(scheme)
+		if p == transport.Unknown {
+			p = resolved
+		}
+
+		if i > 0 && p != protocol {
+			return transport.Unknown, fmt.Errorf("found mixed protocols, expected all to be %v, got %v", protocol, p)
+		}
+		protocol = p
+	}
+	return protocol, nil
 }
 
 func getHosts(peers []string) []string {
@@ -90,50 +172,103 @@ func getHosts(peers []string) []string {
 	return hosts
 }
 
-func loadTransportPeers(opts TransportOptions) (scheme string, peers []string, _ error) {
-	peers = opts.Peers
-	if opts.PeerList != "" {
-		if len(peers) > 0 {
-			return "", nil, errPeerOptions
-		}
+// loadTransportPeers returns the peers specified by the options, resolving the
+// peer list if one is specified, and then filtering and sampling them. Weights
+// are only returned if the peer list has weights for its peers, e.g., from the
+// weight of SRV records.
+func loadTransportPeers(opts TransportOptions) (peers []string, weights []int, _ error) {
+	resolved, err := resolveTransportPeers(opts)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		u, err := url.Parse(opts.PeerList)
-		if err != nil {
-			return "", nil, fmt.Errorf("could not parse peer provider URL: %v", err)
-		}
+	selected, err := selectPeers(resolved, opts, nil /* prefer */)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
+	peers, weights = splitPeerWeights(selected)
+	return peers, weights, nil
+}
 
-		peers, err = peerprovider.Resolve(ctx, u)
-		if err != nil {
-			return "", nil, err
+func resolveTransportPeers(opts TransportOptions) ([]peerprovider.Peer, error) {
+	if opts.PeerList == "" {
+		if len(opts.Peers) == 0 {
+			return nil, errPeerRequired
 		}
 
-		if len(peers) == 0 {
-			return "", nil, fmt.Errorf("specified peer list is empty: %q", opts.PeerList)
+		peers := make([]peerprovider.Peer, len(opts.Peers))
+		for i, peer := range opts.Peers {
+			peers[i] = peerprovider.Peer{HostPort: peer}
 		}
+		return peers, nil
 	}
 
-	if len(peers) == 0 {
-		return "", nil, errPeerRequired
+	if len(opts.Peers) > 0 {
+		return nil, errPeerOptions
+	}
+
+	u, err := url.Parse(opts.PeerList)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse peer provider URL: %v", err)
+	}
+
+	client, err := opts.providerClient()
+	if err != nil {
+		return nil, err
 	}
 
-	protocolScheme, err := ensureSameProtocol(peers)
+	ctx, cancel := context.WithTimeout(httpclient.WithClient(context.Background(), client), opts.peerListTimeout())
+	defer cancel()
+
+	peers, err := peerprovider.ResolvePeers(ctx, u)
 	if err != nil {
-		return "", nil, err
+		return nil, err
+	}
+
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("specified peer list is empty: %q", opts.PeerList)
 	}
+	return peers, nil
+}
 
-	return protocolScheme, peers, nil
+// peerListTimeout returns the timeout for resolving the peer list, which
+// defaults to a second if it's not set.
+func (o TransportOptions) peerListTimeout() time.Duration {
+	if o.PeerListTimeout <= 0 {
+		return time.Second
+	}
+	return o.PeerListTimeout.Duration()
 }
 
-type transportPeers struct {
-	protocolScheme string // empty if not specified
-	peers          []string
+// providerClient returns the HTTP client used by peer and credential
+// providers, which uses the TLS and proxy options.
+func (o TransportOptions) providerClient() (*http.Client, error) {
+	return transport.NewHTTPClient(transport.TLSOptions(o.TLS), o.Proxy)
+}
+
+func splitPeerWeights(resolved []peerprovider.Peer) (peers []string, weights []int) {
+	peers = make([]string, len(resolved))
+	weights = make([]int, len(resolved))
+	weighted := false
+	for i, p := range resolved {
+		peers[i] = p.HostPort
+		weights[i] = 1
+		if p.HasWeight {
+			weights[i] = p.Weight
+			weighted = true
+		}
+	}
+
+	if !weighted {
+		return peers, nil
+	}
+	return peers, weights
 }
 
 func getTransport(opts TransportOptions, resolved resolvedProtocolEncoding, tracer opentracing.Tracer) (transport.Transport, error) {
-	if opts.ServiceName == "" {
+	// REST APIs are called by path, so they don't need a service name.
+	if opts.ServiceName == "" && !opts.REST {
 		return nil, errServiceRequired
 	}
 
@@ -145,6 +280,24 @@ func getTransport(opts TransportOptions, resolved resolvedProtocolEncoding, trac
 		return nil, errTracerRequired
 	}
 
+	// When peers use mixed protocols, peers with a scheme are called using
+	// the protocol for their scheme rather than the resolved protocol.
+	protocol, err := peersProtocol(opts.Peers, resolved.protocol)
+	if err != nil {
+		return nil, err
+	}
+	resolved.protocol = protocol
+
+	if opts.REST && resolved.protocol != transport.HTTP {
+		return nil, errRESTRequiresHTTP
+	}
+
+	if opts.PeerStrategy != "" {
+		if err := peerselect.Validate(opts.PeerStrategy); err != nil {
+			return nil, err
+		}
+	}
+
 	if resolved.protocol == transport.TChannel {
 		hostPorts := getHosts(opts.Peers)
 		remapLocalHost(hostPorts)
@@ -159,6 +312,7 @@ func getTransport(opts TransportOptions, resolved resolvedProtocolEncoding, trac
 			Encoding:        resolved.enc.String(),
 			TransportOpts:   opts.TransportHeaders,
 			Tracer:          tracer,
+			Proxy:           opts.Proxy,
 		}
 		return transport.NewTChannel(topts)
 	}
@@ -172,9 +326,21 @@ func getTransport(opts TransportOptions, resolved resolvedProtocolEncoding, trac
 			RoutingKey:      opts.RoutingKey,
 			RoutingDelegate: opts.RoutingDelegate,
 			MaxResponseSize: opts.GRPCMaxResponseSize,
+			MaxRequestSize:  opts.GRPCMaxRequestSize,
+			Compressor:      opts.GRPCCompressor,
+			TLS:             grpcTLSOptions(opts),
+			Proxy:           opts.Proxy,
 		})
 	}
 
+	var successCodes transport.StatusCodes
+	if opts.HTTPSuccessCodes != "" {
+		var err error
+		if successCodes, err = transport.ParseStatusCodes(opts.HTTPSuccessCodes); err != nil {
+			return nil, err
+		}
+	}
+
 	hopts := transport.HTTPOptions{
 		Method:          opts.HTTPMethod,
 		SourceService:   opts.CallerName,
@@ -185,6 +351,24 @@ func getTransport(opts TransportOptions, resolved resolvedProtocolEncoding, trac
 		Encoding:        resolved.enc.String(),
 		URLs:            opts.Peers,
 		Tracer:          tracer,
+		TLS:             transport.TLSOptions(opts.TLS),
+		HTTP2:           opts.HTTP2,
+		REST:            opts.REST,
+		SuccessCodes:    successCodes,
+		PeerStrategy:    opts.PeerStrategy,
+		PeerWeights:     opts.PeerWeights,
+		Proxy:           opts.Proxy,
 	}
 	return transport.NewHTTP(hopts)
 }
+
+// grpcTLSOptions returns the TLS options for gRPC peers, or nil if gRPC
+// peers should be called without TLS. The TLS options are shared with https
+// peers, so they only enable TLS for gRPC peers with --grpc-tls.
+func grpcTLSOptions(opts TransportOptions) *transport.TLSOptions {
+	if !opts.GRPCTLS {
+		return nil
+	}
+	tlsOpts := transport.TLSOptions(opts.TLS)
+	return &tlsOpts
+}
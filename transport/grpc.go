@@ -22,19 +22,18 @@ package transport
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
-	"go.uber.org/multierr"
-	apipeer "go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
-	"go.uber.org/yarpc/peer"
-	"go.uber.org/yarpc/peer/hostport"
-	"go.uber.org/yarpc/peer/roundrobin"
-	"go.uber.org/yarpc/transport/grpc"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/encoding"
+
+	// Register the gzip compressor for requests and responses.
+	_ "google.golang.org/grpc/encoding/gzip"
 )
 
 var (
@@ -47,13 +46,32 @@ var (
 
 // GRPCOptions are used to create a GRPC transport.
 type GRPCOptions struct {
-	Addresses       []string
+	// Addresses are host:ports, or UnixAddress for peers that listen on
+	// a unix domain socket.
+	Addresses []string
+
 	Tracer          opentracing.Tracer
 	Caller          string
 	Encoding        string
 	RoutingKey      string
 	RoutingDelegate string
 	MaxResponseSize int
+
+	// MaxRequestSize is the maximum size of request messages. There is no
+	// limit by default.
+	MaxRequestSize int
+
+	// Compressor is the name of a registered gRPC compressor, such as
+	// gzip, used to compress requests. Requests are not compressed by
+	// default, but compressed responses are always accepted.
+	Compressor string
+
+	// TLS enables TLS for connections to the addresses if set.
+	TLS *TLSOptions
+
+	// Proxy is the URL of an HTTP CONNECT or SOCKS5 proxy used to reach
+	// the addresses, if set.
+	Proxy string
 }
 
 // NewGRPC returns a transport that calls a GRPC service.
@@ -62,14 +80,12 @@ func NewGRPC(options GRPCOptions) (TransportCloser, error) {
 }
 
 type grpcTransport struct {
-	Transport       transport.Transport
-	Outbound        transport.UnaryOutbound
-	StreamOutbound  transport.StreamOutbound
 	Caller          string
 	Encoding        string
 	RoutingKey      string
 	RoutingDelegate string
 	tracer          opentracing.Tracer
+	outbound        *grpcOutbound
 }
 
 func newGRPC(options GRPCOptions) (*grpcTransport, error) {
@@ -83,30 +99,38 @@ func newGRPC(options GRPCOptions) (*grpcTransport, error) {
 		return nil, errGRPCNoCaller
 	}
 
-	transportOptions := []grpc.TransportOption{grpc.Tracer(options.Tracer)}
-	if options.MaxResponseSize > 0 {
-		transportOptions = append(transportOptions, grpc.ClientMaxRecvMsgSize(options.MaxResponseSize))
+	if options.Compressor != "" && encoding.GetCompressor(options.Compressor) == nil {
+		return nil, fmt.Errorf("unknown gRPC compressor %q", options.Compressor)
 	}
 
-	transport := grpc.NewTransport(transportOptions...)
-	outbound := transport.NewOutbound(peer.Bind(roundrobin.New(transport), peer.BindPeers(peersToIdentifiers(options.Addresses))))
-	if err := transport.Start(); err != nil {
-		return nil, err
+	var tlsConfig *tls.Config
+	if options.TLS != nil {
+		var err error
+		if tlsConfig, err = options.TLS.Config(); err != nil {
+			return nil, err
+		}
 	}
-	if err := outbound.Start(); err != nil {
-		_ = transport.Stop()
+
+	var dialer grpcDialer
+	if options.Proxy != "" {
+		var err error
+		if dialer, err = NewGRPCDialer(options.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	outbound, err := newGRPCOutbound(options, tlsConfig, dialer)
+	if err != nil {
 		return nil, err
 	}
 
 	return &grpcTransport{
-		Transport:       transport,
-		Outbound:        outbound,
-		StreamOutbound:  outbound,
 		Caller:          options.Caller,
 		Encoding:        options.Encoding,
 		RoutingKey:      options.RoutingKey,
 		RoutingDelegate: options.RoutingDelegate,
 		tracer:          options.Tracer,
+		outbound:        outbound,
 	}, nil
 }
 
@@ -118,6 +142,20 @@ func (t *grpcTransport) Protocol() Protocol {
 	return GRPC
 }
 
+// Connect waits until the HTTP/2 connections to all peers are available.
+func (t *grpcTransport) Connect(ctx context.Context) error {
+	return t.outbound.Connect(ctx)
+}
+
+// WireBytes returns the bytes of request and response messages on the wire,
+// after compression, for both unary calls and streams.
+func (t *grpcTransport) WireBytes() (sent, received int64) {
+	return t.outbound.stats.sent.Load(), t.outbound.stats.received.Load()
+}
+
+// Call makes a unary call. The response metadata and trailers are returned
+// in the transport fields. If the call fails, the response is returned along
+// with the error, so the trailers of failed calls can be displayed.
 func (t *grpcTransport) Call(ctx context.Context, request *Request) (*Response, error) {
 	if request.TargetService == "" {
 		return nil, errGRPCNoService
@@ -128,19 +166,15 @@ func (t *grpcTransport) Call(ctx context.Context, request *Request) (*Response,
 
 	ctx, cancel := requestContextWithTimeout(ctx, request)
 	defer cancel()
-	transportResponse, err := t.Outbound.Call(ctx, t.requestToYARPCRequest(request))
-	if err != nil {
-		return nil, err
-	}
-	return yarpcResponseToResponse(transportResponse)
+	return t.outbound.Call(ctx, t.requestToYARPCRequest(request), request.Body, request.TransportHeaders)
 }
 
 func (t *grpcTransport) CallStream(ctx context.Context, request *StreamRequest) (*transport.ClientStream, error) {
-	return t.StreamOutbound.CallStream(ctx, t.requestToYARPCStreamRequest(request))
+	return t.outbound.CallStream(ctx, t.requestToYARPCStreamRequest(request))
 }
 
 func (t *grpcTransport) Close() error {
-	return multierr.Combine(t.Transport.Stop(), t.Outbound.Stop())
+	return t.outbound.Close()
 }
 
 func (t *grpcTransport) requestToYARPCStreamRequest(streamRequest *StreamRequest) *transport.StreamRequest {
@@ -186,28 +220,3 @@ func requestContextWithTimeout(ctx context.Context, request *Request) (context.C
 	}
 	return context.WithTimeout(ctx, timeout)
 }
-
-func yarpcResponseToResponse(transportResponse *transport.Response) (*Response, error) {
-	response := &Response{
-		Headers: transportResponse.Headers.Items(),
-	}
-	if transportResponse.Body != nil {
-		body, err := ioutil.ReadAll(transportResponse.Body)
-		if err != nil {
-			return nil, err
-		}
-		if err := transportResponse.Body.Close(); err != nil {
-			return nil, err
-		}
-		response.Body = body
-	}
-	return response, nil
-}
-
-func peersToIdentifiers(peers []string) []apipeer.Identifier {
-	identifiers := make([]apipeer.Identifier, len(peers))
-	for i, peer := range peers {
-		identifiers[i] = hostport.Identify(peer)
-	}
-	return identifiers
-}
@@ -0,0 +1,571 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// This file replaces the YARPC gRPC outbound. The YARPC outbound creates its
+// own connections without dial options for stats handlers or interceptors,
+// and only returns response trailers as validated application headers, so it
+// can't send raw metadata, return the response metadata, trailers and status,
+// count bytes on the wire, or share connections between calls and streams.
+//
+// The request metadata, application headers, error conversion and client
+// stream are adapted from go.uber.org/yarpc v1.60.0 transport/grpc:
+// transportRequestToMetadata and getApplicationHeaders in headers.go,
+// invokeErrorToYARPCError in outbound.go, and clientStream in stream.go.
+// Compare them with those functions when upgrading YARPC, so YARPC servers
+// continue to see the same requests.
+
+package transport
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yarpc/yab/peerselect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/atomic"
+	"go.uber.org/multierr"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/pkg/procedure"
+	"go.uber.org/yarpc/transport/grpc"
+	"go.uber.org/yarpc/yarpcerrors"
+	"golang.org/x/net/context"
+	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// grpcOutbound makes unary calls and opens streams using gRPC client
+// connections, rather than the YARPC outbound, so raw metadata can be sent,
+// and the response metadata and trailers are available. Requests use the same
+// metadata as YARPC, so YARPC servers see no difference.
+type grpcOutbound struct {
+	addresses []string
+	conns     []*googlegrpc.ClientConn
+	peers     peerselect.Chooser
+	tracer    opentracing.Tracer
+	stats     *wireStats
+}
+
+// grpcDialer dials connections to gRPC addresses. The default dialer is
+// used if it's nil.
+type grpcDialer func(ctx context.Context, addr string) (net.Conn, error)
+
+func newGRPCOutbound(options GRPCOptions, tlsConfig *tls.Config, dialer grpcDialer) (_ *grpcOutbound, err error) {
+	callOptions := []googlegrpc.CallOption{googlegrpc.ForceCodec(rawCodec{})}
+	if options.MaxResponseSize > 0 {
+		callOptions = append(callOptions, googlegrpc.MaxCallRecvMsgSize(options.MaxResponseSize))
+	}
+	if options.MaxRequestSize > 0 {
+		callOptions = append(callOptions, googlegrpc.MaxCallSendMsgSize(options.MaxRequestSize))
+	}
+	if options.Compressor != "" {
+		callOptions = append(callOptions, googlegrpc.UseCompressor(options.Compressor))
+	}
+
+	wire := &wireStats{}
+	dialOptions := []googlegrpc.DialOption{
+		googlegrpc.WithUserAgent(grpc.UserAgent),
+		googlegrpc.WithDefaultCallOptions(callOptions...),
+		googlegrpc.WithStatsHandler(wire),
+	}
+	if dialer != nil {
+		dialOptions = append(dialOptions, googlegrpc.WithContextDialer(dialer))
+	}
+	if tlsConfig != nil {
+		dialOptions = append(dialOptions, googlegrpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		dialOptions = append(dialOptions, googlegrpc.WithInsecure())
+	}
+
+	peers, err := peerselect.New(peerselect.RoundRobin, options.Addresses, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &grpcOutbound{
+		addresses: options.Addresses,
+		peers:     peers,
+		tracer:    options.Tracer,
+		stats:     wire,
+	}
+	defer func() {
+		if err != nil {
+			o.Close()
+		}
+	}()
+
+	for _, address := range options.Addresses {
+		conn, err := googlegrpc.Dial(address, dialOptions...)
+		if err != nil {
+			return nil, err
+		}
+		o.conns = append(o.conns, conn)
+	}
+	return o, nil
+}
+
+// Connect waits until the connections to all addresses are ready.
+func (o *grpcOutbound) Connect(ctx context.Context) error {
+	for i, conn := range o.conns {
+		for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+			if !conn.WaitForStateChange(ctx, state) {
+				return fmt.Errorf("failed to connect to %v: %v", o.addresses[i], ctx.Err())
+			}
+		}
+	}
+	return nil
+}
+
+// Call makes a unary call. rawMetadata is added to the request metadata
+// as-is, without the validation YARPC applies to headers. The response is
+// returned even if the call fails, so the metadata and trailers are available.
+func (o *grpcOutbound) Call(ctx context.Context, request *transport.Request, body []byte, rawMetadata map[string]string) (_ *Response, err error) {
+	fullMethod, err := grpcFullMethod(request.Procedure)
+	if err != nil {
+		return nil, err
+	}
+
+	wire := startWireCall(ctx, GRPC, fullMethod)
+	defer func() { wire.finish(err) }()
+
+	md, err := requestMetadata(request)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range rawMetadata {
+		md.Append(k, v)
+	}
+
+	ctx, span, err := o.startSpan(ctx, request, md)
+	if err != nil {
+		return nil, err
+	}
+	defer span.Finish()
+
+	peer, done := o.peers.Choose(request.ShardKey)
+	defer done()
+	if wire != nil {
+		wire.setPeer(o.addresses[peer])
+		wire.RequestHeaders = flattenHeaders(md)
+		wire.addReconstructedRequest("message", reconstructGRPCFrame(body))
+	}
+
+	var (
+		responseBody      []byte
+		header, trailer   metadata.MD
+		outgoingCtx       = metadata.NewOutgoingContext(ctx, md)
+		headerOpt, trlOpt = googlegrpc.Header(&header), googlegrpc.Trailer(&trailer)
+	)
+	invokeErr := transport.UpdateSpanWithErr(span,
+		o.conns[peer].Invoke(outgoingCtx, fullMethod, body, &responseBody, headerOpt, trlOpt))
+
+	if wire != nil {
+		wire.ResponseHeaders = flattenHeaders(header)
+		wire.ResponseTrailers = flattenHeaders(trailer)
+		if invokeErr == nil {
+			wire.addReconstructedResponse("message", reconstructGRPCFrame(responseBody))
+		}
+	}
+
+	response := &Response{
+		Body: responseBody,
+		TransportFields: map[string]interface{}{
+			"metadata": metadataOrEmpty(header),
+			"trailers": trailersWithStatus(trailer, status.Convert(invokeErr)),
+		},
+	}
+	if invokeErr != nil {
+		return response, grpcErrorToYARPCError(invokeErr, trailer)
+	}
+
+	if got := trailer.Get(grpc.ServiceHeader); len(got) > 0 && got[0] != request.Service {
+		return response, yarpcerrors.InternalErrorf("service name sent from the request "+
+			"does not match the service name received in the response: sent %q, got: %q", request.Service, got[0])
+	}
+
+	response.Headers, err = applicationHeaders(trailer)
+	return response, err
+}
+
+// CallStream opens a stream to the next peer. Streams use the same metadata as
+// unary calls, and the same connections.
+func (o *grpcOutbound) CallStream(ctx context.Context, request *transport.StreamRequest) (*transport.ClientStream, error) {
+	treq := request.Meta.ToRequest()
+	fullMethod, err := grpcFullMethod(treq.Procedure)
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := requestMetadata(treq)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span, err := o.startSpan(ctx, treq, md)
+	if err != nil {
+		return nil, err
+	}
+
+	peer, done := o.peers.Choose(treq.ShardKey)
+	streamCtx, cancel := context.WithCancel(metadata.NewOutgoingContext(ctx, md))
+	stream, err := o.conns[peer].NewStream(streamCtx, &googlegrpc.StreamDesc{
+		ClientStreams: true,
+		ServerStreams: true,
+	}, fullMethod)
+	if err != nil {
+		cancel()
+		err = transport.UpdateSpanWithErr(span, grpcErrorToYARPCError(err, nil /* trailer */))
+		span.Finish()
+		done()
+		return nil, err
+	}
+
+	s := &grpcClientStream{
+		ctx:    streamCtx,
+		cancel: cancel,
+		req:    request,
+		stream: stream,
+		span:   span,
+		done:   done,
+	}
+	go s.finishOnCancel()
+	return transport.NewClientStream(s)
+}
+
+// startSpan starts the span for a request, and injects it into the metadata.
+func (o *grpcOutbound) startSpan(ctx context.Context, request *transport.Request, md metadata.MD) (context.Context, opentracing.Span, error) {
+	createSpan := &transport.CreateOpenTracingSpan{
+		Tracer:        o.tracer,
+		TransportName: "grpc",
+		StartTime:     time.Now(),
+		ExtraTags:     yarpc.OpentracingTags,
+	}
+	ctx, span := createSpan.Do(ctx, request)
+
+	if err := o.tracer.Inject(span.Context(), opentracing.HTTPHeaders, metadataCarrier(md)); err != nil {
+		span.Finish()
+		return nil, nil, err
+	}
+	return ctx, span, nil
+}
+
+// Close closes the connections to all addresses.
+func (o *grpcOutbound) Close() error {
+	var err error
+	for _, conn := range o.conns {
+		err = multierr.Append(err, conn.Close())
+	}
+	return err
+}
+
+// grpcFullMethod returns the gRPC method name for a YARPC procedure.
+func grpcFullMethod(name string) (string, error) {
+	serviceName, methodName := procedure.FromName(name)
+	if methodName == "" {
+		return "", yarpcerrors.InvalidArgumentErrorf("invalid procedure name: %s", name)
+	}
+	return fmt.Sprintf("/%s/%s", url.QueryEscape(serviceName), url.QueryEscape(methodName)), nil
+}
+
+// requestMetadata returns the metadata that a YARPC outbound sends for the request.
+func requestMetadata(request *transport.Request) (metadata.MD, error) {
+	md := metadata.MD{}
+	for k, v := range map[string]string{
+		grpc.CallerHeader:          request.Caller,
+		grpc.ServiceHeader:         request.Service,
+		grpc.ShardKeyHeader:        request.ShardKey,
+		grpc.RoutingKeyHeader:      request.RoutingKey,
+		grpc.RoutingDelegateHeader: request.RoutingDelegate,
+		grpc.EncodingHeader:        string(request.Encoding),
+	} {
+		if v != "" {
+			md.Set(k, v)
+		}
+	}
+
+	for k, v := range request.Headers.Items() {
+		if isReservedHeader(k) {
+			return nil, yarpcerrors.InvalidArgumentErrorf("cannot use reserved header in application headers: %s", k)
+		}
+		if strings.ContainsAny(v, "\r\n\x00") {
+			return nil, yarpcerrors.InvalidArgumentErrorf("grpc request header value contains invalid characters including ASCII 0xd, 0xa, or 0x0")
+		}
+		md.Set(k, v)
+	}
+	return md, nil
+}
+
+// applicationHeaders returns the response trailers that are not reserved
+// for YARPC, which is where YARPC servers send response headers.
+func applicationHeaders(trailer metadata.MD) (map[string]string, error) {
+	headers := make(map[string]string)
+	for k, values := range trailer {
+		if isReservedHeader(k) || len(values) == 0 {
+			continue
+		}
+		if len(values) > 1 {
+			return nil, yarpcerrors.InvalidArgumentErrorf("header has more than one value: %s:%v", k, values)
+		}
+		headers[transport.CanonicalizeHeaderKey(k)] = values[0]
+	}
+	return headers, nil
+}
+
+func isReservedHeader(k string) bool {
+	return strings.HasPrefix(strings.ToLower(k), "rpc-")
+}
+
+func metadataOrEmpty(md metadata.MD) metadata.MD {
+	if md == nil {
+		return metadata.MD{}
+	}
+	return md
+}
+
+// trailersWithStatus returns the trailers along with the grpc-status and
+// grpc-message trailers, which the gRPC client doesn't include.
+func trailersWithStatus(trailer metadata.MD, st *status.Status) metadata.MD {
+	trailers := metadataOrEmpty(trailer).Copy()
+	trailers.Set("grpc-status", strconv.Itoa(int(st.Code())))
+	if st.Message() != "" {
+		trailers.Set("grpc-message", st.Message())
+	}
+	return trailers
+}
+
+// grpcErrorToYARPCError converts errors from a call into the same errors
+// that the YARPC outbound returns.
+func grpcErrorToYARPCError(err error, trailer metadata.MD) error {
+	if yarpcerrors.IsStatus(err) {
+		return err
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return yarpcerrors.FromError(err)
+	}
+
+	// YARPC codes have the same values as gRPC codes.
+	code := yarpcerrors.Code(st.Code())
+	if code > yarpcerrors.CodeUnauthenticated {
+		code = yarpcerrors.CodeUnknown
+	}
+
+	var name string
+	if names := trailer.Get(grpc.ErrorNameHeader); len(names) == 1 {
+		name = names[0]
+	}
+
+	// Servers prefix the message with the name, which is reported separately.
+	message := st.Message()
+	if name != "" && message != "" && message != name {
+		message = strings.TrimPrefix(message, name+": ")
+	} else if name != "" && message == name {
+		message = ""
+	}
+
+	yarpcErr := yarpcerrors.Newf(code, "%s", message)
+	if name != "" {
+		//lint:ignore SA1019 YARPC servers still send error names.
+		yarpcErr = yarpcErr.WithName(name)
+	}
+	if len(st.Details()) > 0 {
+		details, err := proto.Marshal(st.Proto())
+		if err != nil {
+			return err
+		}
+		yarpcErr = yarpcErr.WithDetails(details)
+	}
+	return yarpcErr
+}
+
+// grpcClientStream is a YARPC stream for a gRPC client stream. The span and
+// the peer are released once the stream ends, when a message can't be sent
+// or received, or when its context is done, but not when the client only
+// closes its side of the stream.
+type grpcClientStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	req    *transport.StreamRequest
+	stream googlegrpc.ClientStream
+	span   opentracing.Span
+	done   func()
+	closed atomic.Bool
+}
+
+func (s *grpcClientStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *grpcClientStream) Request() *transport.StreamRequest {
+	return s.req
+}
+
+func (s *grpcClientStream) SendMessage(_ context.Context, m *transport.StreamMessage) error {
+	if s.closed.Load() {
+		return io.EOF
+	}
+
+	msg, err := ioutil.ReadAll(m.Body)
+	m.Body.Close()
+	if err != nil {
+		return err
+	}
+	if err := s.stream.SendMsg(msg); err != nil {
+		return s.closeWithErr(err)
+	}
+	return nil
+}
+
+func (s *grpcClientStream) ReceiveMessage(context.Context) (*transport.StreamMessage, error) {
+	var msg []byte
+	if err := s.stream.RecvMsg(&msg); err != nil {
+		return nil, s.closeWithErr(err)
+	}
+	return &transport.StreamMessage{Body: ioutil.NopCloser(bytes.NewReader(msg))}, nil
+}
+
+// Close closes the client side of the stream, and responses can still be
+// received until the server ends the stream.
+func (s *grpcClientStream) Close(context.Context) error {
+	return s.stream.CloseSend()
+}
+
+func (s *grpcClientStream) Headers() (transport.Headers, error) {
+	md, err := s.stream.Header()
+	if err != nil {
+		return transport.NewHeaders(), err
+	}
+	headers := transport.NewHeadersWithCapacity(len(md))
+	for k, vs := range md {
+		if len(vs) > 0 {
+			headers = headers.With(k, vs[0])
+		}
+	}
+	return headers, nil
+}
+
+// finishOnCancel finishes the stream when its context is done, for callers
+// that stop receiving before the server ends the stream. Deadlines are
+// recorded as errors, but cancellation is not, since callers cancel the
+// context once they're done with the stream.
+func (s *grpcClientStream) finishOnCancel() {
+	<-s.ctx.Done()
+	if err := s.ctx.Err(); err == context.DeadlineExceeded {
+		s.finish(err)
+	} else {
+		s.finish(nil)
+	}
+}
+
+// closeWithErr finishes the stream, and returns err converted to a YARPC
+// error. io.EOF is returned as-is, as the server ended the stream.
+func (s *grpcClientStream) closeWithErr(err error) error {
+	if err != nil && err != io.EOF {
+		err = grpcErrorToYARPCError(err, s.stream.Trailer())
+	}
+	if err == io.EOF {
+		s.finish(nil)
+	} else {
+		s.finish(err)
+	}
+	return err
+}
+
+// finish finishes the span and releases the peer the first time it's called.
+func (s *grpcClientStream) finish(err error) {
+	if s.closed.Swap(true) {
+		return
+	}
+	transport.UpdateSpanWithErr(s.span, err)
+	s.span.Finish()
+	s.done()
+	s.cancel()
+}
+
+// wireStats counts the bytes of messages sent and received on the wire.
+type wireStats struct {
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func (s *wireStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (s *wireStats) HandleRPC(_ context.Context, rs stats.RPCStats) {
+	switch rs := rs.(type) {
+	case *stats.OutPayload:
+		s.sent.Add(int64(rs.WireLength))
+	case *stats.InPayload:
+		s.received.Add(int64(rs.WireLength))
+	}
+}
+
+func (s *wireStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s *wireStats) HandleConn(context.Context, stats.ConnStats) {}
+
+// metadataCarrier is used to inject tracing headers into metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Set(key, val string) {
+	metadata.MD(c).Set(key, val)
+}
+
+// rawCodec passes request and response bodies through unmodified.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	bs, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("expected []byte to marshal, got %T", v)
+	}
+	return bs, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	bs, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("expected *[]byte to unmarshal, got %T", v)
+	}
+	*bs = data
+	return nil
+}
+
+// Name is empty so the content-type is application/grpc, as YARPC uses.
+func (rawCodec) Name() string {
+	return ""
+}
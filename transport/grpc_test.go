@@ -29,16 +29,22 @@ import (
 	"io"
 	"io/ioutil"
 	"net"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/yarpc/yab/testdata/protobuf/simple"
 	googlegrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"go.uber.org/multierr"
 	"go.uber.org/yarpc/api/transport"
@@ -116,6 +122,122 @@ func TestGRPCSuccess(t *testing.T) {
 		}, 0)
 }
 
+func TestGRPCConnect(t *testing.T) {
+	doWithGRPCTestEnv(t, "example-caller", 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", testBar)},
+		func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+			connector, ok := grpcTestEnv.Transport.(Connector)
+			require.True(t, ok, "gRPC transport should be a Connector")
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			require.NoError(t, connector.Connect(ctx))
+		}, 0)
+}
+
+func TestGRPCConnectFails(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	grpcTransport, err := NewGRPC(GRPCOptions{
+		Addresses: []string{addr},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "example-caller",
+		Encoding:  "json",
+	})
+	require.NoError(t, err)
+	defer grpcTransport.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, grpcTransport.(Connector).Connect(ctx), "Connect to closed port should fail")
+}
+
+func TestGRPCTLS(t *testing.T) {
+	clientTLS := &TLSOptions{
+		CAFile:   _testCA,
+		CertFile: _testClientCert,
+		KeyFile:  _testClientKey,
+	}
+
+	tests := []struct {
+		msg     string
+		opts    *TLSOptions
+		wantErr bool
+	}{
+		{
+			msg:     "plaintext",
+			wantErr: true,
+		},
+		{
+			msg:     "missing client certificate",
+			opts:    &TLSOptions{CAFile: _testCA},
+			wantErr: true,
+		},
+		{
+			msg:     "unknown authority",
+			opts:    &TLSOptions{CertFile: _testClientCert, KeyFile: _testClientKey},
+			wantErr: true,
+		},
+		{
+			msg:  "mutual TLS",
+			opts: clientTLS,
+		},
+	}
+
+	yarpcTransport := grpc.NewTransport()
+	require.NoError(t, yarpcTransport.Start())
+	defer yarpcTransport.Stop()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	inbound := yarpcTransport.NewInbound(listener,
+		grpc.InboundCredentials(credentials.NewTLS(serverTLSConfig(t, true /* requireClientCert */))))
+	inbound.SetRouter(newTestRouter([]transport.Procedure{newTestJSONProcedure("example", "Foo::Bar", testBar)}))
+	require.NoError(t, inbound.Start())
+	defer inbound.Stop()
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			grpcTransport, err := NewGRPC(GRPCOptions{
+				Addresses: []string{listener.Addr().String()},
+				Tracer:    opentracing.NoopTracer{},
+				Caller:    "example-caller",
+				Encoding:  "json",
+				TLS:       tt.opts,
+			})
+			require.NoError(t, err)
+			defer grpcTransport.Close()
+
+			request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+			require.NoError(t, err)
+			request.Timeout = 200 * time.Millisecond
+
+			response, err := grpcTransport.Call(context.Background(), request)
+			if tt.wantErr {
+				assert.Error(t, err, "call should fail")
+				return
+			}
+
+			require.NoError(t, err, "call should succeed")
+			assert.Contains(t, string(response.Body), "hello")
+		})
+	}
+}
+
+func TestGRPCTLSInvalidOptions(t *testing.T) {
+	_, err := NewGRPC(GRPCOptions{
+		Addresses: []string{"127.0.0.1:1"},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "example-caller",
+		TLS:       &TLSOptions{CAFile: "not-found.pem"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read TLS CA file")
+}
+
 type simpleSvc struct {
 	streamsOpened int
 }
@@ -190,6 +312,149 @@ func TestGRPCStream(t *testing.T) {
 	require.NotNil(t, msg)
 	require.NoError(t, stream.Close(ctx))
 	assert.Equal(t, 1, svc.streamsOpened)
+
+	sent, received := client.(WireCounter).WireBytes()
+	assert.True(t, sent > 0, "stream messages should be counted as sent")
+	assert.True(t, received > 0, "stream messages should be counted as received")
+}
+
+func TestGRPCStreamSpan(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := googlegrpc.NewServer()
+	simple.RegisterBarServer(server, &simpleSvc{})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	tracer := mocktracer.New()
+	client, err := NewGRPC(GRPCOptions{
+		Addresses: []string{lis.Addr().String()},
+		Tracer:    tracer,
+		Caller:    "test",
+		Encoding:  "proto",
+	})
+	require.NoError(t, err)
+	defer client.(TransportCloser).Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := client.(StreamTransport).CallStream(ctx, &StreamRequest{
+		Request: &Request{
+			TargetService: "Bar",
+			Method:        "Bar::BidiStream",
+		},
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, opentracing.SpanFromContext(stream.Context()), "stream context should have the span")
+
+	req, err := proto.Marshal(&simple.Foo{Test: 1})
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMessage(ctx, &transport.StreamMessage{
+		Body: ioutil.NopCloser(bytes.NewReader(req)),
+	}))
+	require.NoError(t, stream.Close(ctx))
+	assert.Empty(t, tracer.FinishedSpans(), "span should not finish when the client closes its side")
+
+	_, err = stream.ReceiveMessage(ctx)
+	require.NoError(t, err, "responses should be received after closing the client side")
+	_, err = stream.ReceiveMessage(ctx)
+	assert.Equal(t, io.EOF, err)
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 1, "span should finish when the stream ends")
+	assert.Nil(t, spans[0].Tag("error"), "span should not be marked as failed")
+}
+
+func TestGRPCMetadata(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var gotMD metadata.MD
+	server := googlegrpc.NewServer(googlegrpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *googlegrpc.UnaryServerInfo, handler googlegrpc.UnaryHandler) (interface{}, error) {
+			gotMD, _ = metadata.FromIncomingContext(ctx)
+			googlegrpc.SetHeader(ctx, metadata.Pairs("custom-header", "header-value"))
+			googlegrpc.SetTrailer(ctx, metadata.Pairs("custom-trailer", "trailer-value"))
+			if len(gotMD.Get("fail")) > 0 {
+				return nil, status.Error(codes.PermissionDenied, "denied")
+			}
+			return handler(ctx, req)
+		}))
+	simple.RegisterBarServer(server, &simpleSvc{})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	client, err := NewGRPC(GRPCOptions{
+		Addresses: []string{lis.Addr().String()},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "test",
+		Encoding:  "proto",
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	body, err := proto.Marshal(&simple.Foo{Test: 1})
+	require.NoError(t, err)
+
+	tests := []struct {
+		msg          string
+		rawMetadata  map[string]string
+		wantErr      string
+		wantTrailers metadata.MD
+	}{
+		{
+			msg: "success",
+			rawMetadata: map[string]string{
+				"authorization": "Bearer token",
+				"rpc-raw":       "raw",
+			},
+			wantTrailers: metadata.MD{
+				"custom-trailer": {"trailer-value"},
+				"grpc-status":    {"0"},
+			},
+		},
+		{
+			msg:         "error",
+			rawMetadata: map[string]string{"fail": "true"},
+			wantErr:     "code:permission-denied message:denied",
+			wantTrailers: metadata.MD{
+				"custom-trailer": {"trailer-value"},
+				"grpc-message":   {"denied"},
+				"grpc-status":    {"7"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			res, err := client.Call(context.Background(), &Request{
+				TargetService:    "svc",
+				Method:           "Bar::Baz",
+				Headers:          map[string]string{"app-header": "app-value"},
+				TransportHeaders: tt.rawMetadata,
+				Body:             body,
+			})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.True(t, yarpcerrors.IsPermissionDenied(err), "expected YARPC error")
+			} else {
+				require.NoError(t, err, "Call failed")
+				assert.Equal(t, map[string]string{"custom-trailer": "trailer-value"}, res.Headers)
+			}
+
+			require.NotNil(t, res, "Response should be returned with errors")
+			assert.Equal(t, tt.wantTrailers, res.TransportFields["trailers"], "Unexpected trailers")
+			gotHeaders := res.TransportFields["metadata"].(metadata.MD)
+			assert.Equal(t, []string{"header-value"}, gotHeaders.Get("custom-header"), "Unexpected metadata")
+
+			assert.Equal(t, []string{"test"}, gotMD.Get("rpc-caller"), "Missing YARPC metadata")
+			assert.Equal(t, []string{"app-value"}, gotMD.Get("app-header"), "Missing application header")
+			for k, v := range tt.rawMetadata {
+				assert.Equal(t, []string{v}, gotMD.Get(k), "Missing raw metadata %q", k)
+			}
+		})
+	}
 }
 
 func TestGRPCError(t *testing.T) {
@@ -203,6 +468,72 @@ func TestGRPCError(t *testing.T) {
 	}, 0)
 }
 
+func TestGRPCCompression(t *testing.T) {
+	doWithGRPCTestEnv(t, "example-caller", 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", testBar),
+	}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		call := func(compressor string) (sent, received int64) {
+			grpcTransport, err := NewGRPC(GRPCOptions{
+				Addresses:  []string{grpcTestEnv.YARPCInbounds[0].Addr().String()},
+				Tracer:     opentracing.NoopTracer{},
+				Caller:     "example-caller",
+				Encoding:   "json",
+				Compressor: compressor,
+			})
+			require.NoError(t, err)
+			defer grpcTransport.Close()
+
+			request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: strings.Repeat("hello", 1000)})
+			require.NoError(t, err)
+			response, err := grpcTransport.Call(context.Background(), request)
+			require.NoError(t, err)
+			assert.Contains(t, string(response.Body), "hellohello")
+
+			return grpcTransport.(WireCounter).WireBytes()
+		}
+
+		sent, received := call("")
+		assert.True(t, sent > 5000, "uncompressed request should be larger than its body, got %v", sent)
+		assert.True(t, received > 5000, "uncompressed response should be larger than its body, got %v", received)
+
+		gzipSent, gzipReceived := call("gzip")
+		assert.True(t, gzipSent < sent/10, "gzip request should be compressed, got %v", gzipSent)
+		assert.True(t, gzipReceived < received/10, "gzip response should be compressed, got %v", gzipReceived)
+	}, 0)
+}
+
+func TestGRPCCompressorUnknown(t *testing.T) {
+	_, err := NewGRPC(GRPCOptions{
+		Addresses:  []string{"127.0.0.1:1"},
+		Tracer:     opentracing.NoopTracer{},
+		Caller:     "example-caller",
+		Compressor: "zip",
+	})
+	assert.EqualError(t, err, `unknown gRPC compressor "zip"`)
+}
+
+func TestGRPCMaxRequestSize(t *testing.T) {
+	doWithGRPCTestEnv(t, "example-caller", 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", testBar),
+	}, func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+		grpcTransport, err := NewGRPC(GRPCOptions{
+			Addresses:      []string{grpcTestEnv.YARPCInbounds[0].Addr().String()},
+			Tracer:         opentracing.NoopTracer{},
+			Caller:         "example-caller",
+			Encoding:       "json",
+			MaxRequestSize: 100,
+		})
+		require.NoError(t, err)
+		defer grpcTransport.Close()
+
+		request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: strings.Repeat("a", 100)})
+		require.NoError(t, err)
+		_, err = grpcTransport.Call(context.Background(), request)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "code:resource-exhausted message:trying to send message larger than max")
+	}, 0)
+}
+
 func TestGRPCMaxResponseSize(t *testing.T) {
 	t.Run("With default max response size", func(t *testing.T) {
 		doWithGRPCTestEnv(t, "example-caller", 1, []transport.Procedure{
@@ -381,3 +712,56 @@ func (r *testRouter) Choose(_ context.Context, request *transport.Request) (tran
 	}
 	return transport.HandlerSpec{}, fmt.Errorf("no procedure for service %s and name %s", request.Service, request.Procedure)
 }
+
+func TestGRPCUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "grpc.sock")
+	lis, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	server := googlegrpc.NewServer()
+	svc := &simpleSvc{}
+	simple.RegisterBarServer(server, svc)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	client, err := NewGRPC(GRPCOptions{
+		Addresses: []string{UnixAddress(socket)},
+		Tracer:    opentracing.NoopTracer{},
+		Caller:    "test",
+		Encoding:  "proto",
+	})
+	require.NoError(t, err)
+	defer client.(TransportCloser).Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, client.(Connector).Connect(ctx), "Connect failed")
+
+	req, err := proto.Marshal(&simple.Foo{Test: 1})
+	require.NoError(t, err)
+	res, err := client.Call(ctx, &Request{
+		TargetService: "Bar",
+		Method:        "Bar::Baz",
+		Body:          req,
+		Timeout:       time.Second,
+	})
+	require.NoError(t, err, "unary call should succeed")
+
+	var foo simple.Foo
+	require.NoError(t, proto.Unmarshal(res.Body, &foo))
+	assert.EqualValues(t, 1, foo.Test, "unexpected response")
+
+	stream, err := client.(StreamTransport).CallStream(ctx, &StreamRequest{
+		Request: &Request{
+			TargetService: "Bar",
+			Method:        "Bar::BidiStream",
+		},
+	})
+	require.NoError(t, err, "stream should be created")
+	require.NoError(t, stream.SendMessage(ctx, &transport.StreamMessage{
+		Body: ioutil.NopCloser(bytes.NewReader(req)),
+	}))
+	_, err = stream.ReceiveMessage(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Close(ctx))
+}
@@ -22,28 +22,69 @@ package transport
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/yarpc/yab/peerselect"
+
 	"github.com/opentracing/opentracing-go"
 	"golang.org/x/net/context"
+	"golang.org/x/net/http/httpproxy"
 )
 
 type httpTransport struct {
 	opts   HTTPOptions
 	client *http.Client
 	tracer opentracing.Tracer
+	dialer *net.Dialer
+	peers  peerselect.Chooser
+
+	// tlsConfig is used for the TLS handshake of https URLs.
+	tlsConfig *tls.Config
+
+	// h2c is the pool of HTTP/2 connections used for http URLs if HTTP2
+	// is enabled.
+	h2c *h2cConnPool
+
+	// proxyFunc returns the proxy used to reach a URL, if any. It's
+	// used as the proxy of the HTTP client, which forwards http requests
+	// and tunnels https requests through the proxy.
+	proxyFunc func(*url.URL) (*url.URL, error)
+
+	// sockets maps the placeholder hosts of URLs for peers that listen on a
+	// unix domain socket to their socket.
+	sockets map[string]string
+
+	// connected holds connections established by Connect until the HTTP
+	// client dials their address.
+	connectedMu sync.Mutex
+	connected   map[connectedKey][]net.Conn
+}
+
+// connectedKey is the address of a connection established by Connect, and
+// whether the TLS handshake has been completed on the connection.
+type connectedKey struct {
+	tls  bool
+	addr string
 }
 
 // HTTPOptions are used to create a HTTP transport.
 type HTTPOptions struct {
-	Method          string
-	URLs            []string
+	Method string
+
+	// URLs are the URLs of peers. Peers that listen on a unix domain socket
+	// are specified as unix:// or http+unix:// URLs (see ParseUnixPeer).
+	URLs []string
+
 	SourceService   string
 	TargetService   string
 	RoutingDelegate string
@@ -51,6 +92,35 @@ type HTTPOptions struct {
 	ShardKey        string
 	Encoding        string
 	Tracer          opentracing.Tracer
+
+	// TLS configures connections to https URLs.
+	TLS TLSOptions
+
+	// HTTP2 uses HTTP/2 with prior knowledge (h2c) for http URLs.
+	// HTTP/2 is always negotiated using ALPN for https URLs.
+	HTTP2 bool
+
+	// SuccessCodes are the response status codes that are treated as
+	// a success. Defaults to DefaultSuccessCodes.
+	SuccessCodes StatusCodes
+
+	// REST calls the procedure as a path relative to the URL, such as
+	// /users/{id}, without YARPC headers. Path parameters are filled in
+	// from fields of a JSON request, and for methods without a body,
+	// the remaining fields are sent as query parameters.
+	REST bool
+
+	// PeerStrategy is the peerselect strategy used to choose a URL for
+	// each request. Defaults to random.
+	PeerStrategy string
+
+	// PeerWeights are optional weights for URLs, used by the weighted and
+	// consistent-hash strategies.
+	PeerWeights []int
+
+	// Proxy is the URL of an HTTP or SOCKS5 proxy used to reach all URLs.
+	// If empty, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are used.
+	Proxy string
 }
 
 var (
@@ -63,43 +133,342 @@ func NewHTTP(opts HTTPOptions) (Transport, error) {
 	if len(opts.URLs) == 0 {
 		return nil, errNoURLs
 	}
-	if opts.TargetService == "" {
+	if opts.TargetService == "" && !opts.REST {
 		return nil, errMissingTarget
 	}
 	if opts.Method == "" {
 		opts.Method = "POST"
 	}
+	if len(opts.SuccessCodes) == 0 {
+		opts.SuccessCodes = DefaultSuccessCodes
+	}
+	if opts.PeerStrategy == "" {
+		opts.PeerStrategy = peerselect.Random
+	}
+
+	var sockets map[string]string
+	opts.URLs, sockets = unixURLs(opts.URLs)
+
+	peers, err := peerselect.New(opts.PeerStrategy, opts.URLs, opts.PeerWeights)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &httpTransport{
+		opts:      opts,
+		tracer:    opts.Tracer,
+		dialer:    &net.Dialer{},
+		peers:     peers,
+		sockets:   sockets,
+		connected: make(map[connectedKey][]net.Conn),
+	}
+	if opts.Proxy != "" {
+		proxyURL, err := parseProxy(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		h.proxyFunc = func(*url.URL) (*url.URL, error) { return proxyURL, nil }
+	} else {
+		h.proxyFunc = httpproxy.FromEnvironment().ProxyFunc()
+	}
+
+	h.tlsConfig = &tls.Config{}
+	if opts.TLS.Enabled() {
+		if h.tlsConfig, err = opts.TLS.Config(); err != nil {
+			return nil, err
+		}
+	}
+	h.tlsConfig.NextProtos = []string{"h2", "http/1.1"}
 
-	return &httpTransport{
-		opts: opts,
-		// Use independent HTTP clients for each transport.
-		client: &http.Client{
-			Transport: &http.Transport{},
+	// HTTP/2 is only negotiated by default if the transport doesn't use
+	// custom dialers, so it's forced to keep ALPN for https URLs.
+	// Calls through a proxy dial the proxy, and the TLS handshake for
+	// https URLs is done by the HTTP client using the TLS config.
+	rt := &http.Transport{
+		Proxy:             h.requestProxy,
+		DialContext:       h.dialContext,
+		DialTLSContext:    h.dialTLSContext,
+		TLSClientConfig:   h.tlsConfig,
+		ForceAttemptHTTP2: true,
+	}
+	if opts.HTTP2 {
+		h.h2c = newH2CConnPool(h.dialH2C)
+		rt.RegisterProtocol("http", h.h2c.t)
+	}
+
+	// Use independent HTTP clients for each transport.
+	h.client = &http.Client{Transport: rt}
+	return h, nil
+}
+
+// NewHTTPClient returns a HTTP client for requests that aren't calls to
+// peers, such as fetching credentials or peer lists. It verifies https URLs
+// using the TLS options, and uses the proxy, or the proxy environment
+// variables if no proxy is specified.
+func NewHTTPClient(tlsOpts TLSOptions, proxy string) (*http.Client, error) {
+	envProxy := httpproxy.FromEnvironment().ProxyFunc()
+	rt := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return envProxy(req.URL)
 		},
-		tracer: opts.Tracer,
-	}, nil
+		ForceAttemptHTTP2: true,
+	}
+	if proxy != "" {
+		proxyURL, err := parseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		rt.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	// The server name is only overridden for peers, since other requests
+	// are made to different hosts.
+	tlsOpts.ServerName = ""
+	if tlsOpts.Enabled() {
+		tlsConfig, err := tlsOpts.Config()
+		if err != nil {
+			return nil, err
+		}
+		rt.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+// Connect dials a TCP connection to the host of every URL, and completes
+// the TLS handshake for https URLs. URLs that are called through a proxy
+// connect to the proxy instead. The connections are used by the HTTP client
+// for subsequent calls.
+func (h *httpTransport) Connect(ctx context.Context) error {
+	for _, rawURL := range h.opts.URLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return err
+		}
+
+		key := connectedKey{tls: u.Scheme == "https", addr: urlAddr(u)}
+		dial := h.dial
+		if h.h2c != nil && u.Scheme == "http" {
+			dial = h.dialTunnel
+		} else {
+			proxyURL, err := h.proxyURL(u)
+			if err != nil {
+				return err
+			}
+			if proxyURL != nil {
+				key = connectedKey{tls: proxyURL.Scheme == "https", addr: urlAddr(proxyURL)}
+			}
+		}
+		if key.tls {
+			dial = h.dialTLS
+		}
+		conn, err := dial(ctx, "tcp", key.addr)
+		if err != nil {
+			return err
+		}
+
+		h.connectedMu.Lock()
+		h.connected[key] = append(h.connected[key], conn)
+		h.connectedMu.Unlock()
+	}
+	return nil
+}
+
+func (h *httpTransport) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if conn, ok := h.takeConnected(connectedKey{addr: addr}); ok {
+		return conn, nil
+	}
+	return h.dial(ctx, network, addr)
+}
+
+func (h *httpTransport) dialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if conn, ok := h.takeConnected(connectedKey{tls: true, addr: addr}); ok {
+		return conn, nil
+	}
+	return h.dialTLS(ctx, network, addr)
+}
+
+// takeConnected returns a connection established by Connect, if any.
+func (h *httpTransport) takeConnected(key connectedKey) (net.Conn, bool) {
+	h.connectedMu.Lock()
+	defer h.connectedMu.Unlock()
+
+	conns := h.connected[key]
+	if len(conns) == 0 {
+		return nil, false
+	}
+	h.connected[key] = conns[1:]
+	return conns[0], true
+}
+
+// dialTLS dials the given address and completes the TLS handshake, verifying
+// the server using the host of the address unless a server name is set.
+func (h *httpTransport) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := h.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := h.tlsConfig.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func (h *httpTransport) dialH2C(ctx context.Context, network, addr string) (net.Conn, error) {
+	if conn, ok := h.takeConnected(connectedKey{addr: addr}); ok {
+		return conn, nil
+	}
+	return h.dialTunnel(ctx, network, addr)
+}
+
+// dialTunnel dials the given address through a tunnel using the proxy for
+// the address, if any. It's used for HTTP/2 with prior knowledge, since HTTP
+// proxies can't forward h2c requests.
+func (h *httpTransport) dialTunnel(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxyURL, err := h.proxyURL(&url.URL{Scheme: "http", Host: addr})
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL != nil {
+		if proxyURL, err = parseProxy(proxyURL.String()); err != nil {
+			return nil, err
+		}
+		return dialProxy(ctx, h.dialer, proxyURL, addr)
+	}
+	return h.dial(ctx, network, addr)
+}
+
+// dial dials the given address, or the unix domain socket for placeholder
+// hosts of unix socket URLs.
+func (h *httpTransport) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if socket, ok := h.sockets[host]; ok {
+			return h.dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+	return h.dialer.DialContext(ctx, network, addr)
+}
+
+// requestProxy returns the proxy used for a request, if any.
+func (h *httpTransport) requestProxy(req *http.Request) (*url.URL, error) {
+	return h.proxyURL(req.URL)
+}
+
+// proxyURL returns the proxy used to reach the given URL, if any. Peers
+// that listen on a unix domain socket are never called through a proxy.
+func (h *httpTransport) proxyURL(u *url.URL) (*url.URL, error) {
+	if _, ok := h.sockets[u.Hostname()]; ok {
+		return nil, nil
+	}
+
+	proxyURL, err := h.proxyFunc(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy for %v: %v", u, err)
+	}
+	return proxyURL, nil
+}
+
+// urlAddr returns the host:port dialed for a URL, or a proxy URL.
+func urlAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	port := "80"
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "socks5":
+		port = "1080"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// unixURLs replaces URLs for peers that listen on a unix domain socket with
+// http URLs using a placeholder host, and returns the socket for each host.
+func unixURLs(urls []string) ([]string, map[string]string) {
+	var (
+		replaced = make([]string, len(urls))
+		sockets  = make(map[string]string)
+		hosts    = make(map[string]string)
+	)
+	for i, u := range urls {
+		protocol, socket, path, ok := ParseUnixPeer(u)
+		if !ok || (protocol != "" && protocol != "http") {
+			replaced[i] = u
+			continue
+		}
+
+		host, ok := hosts[socket]
+		if !ok {
+			host = fmt.Sprintf("unix-socket-%d", len(hosts))
+			hosts[socket] = host
+			sockets[host] = socket
+		}
+		replaced[i] = "http://" + host + path
+	}
+	return replaced, sockets
+}
+
+// Close closes idle connections, including any that were never used.
+func (h *httpTransport) Close() error {
+	h.client.CloseIdleConnections()
+	if h.h2c != nil {
+		h.h2c.Close()
+	}
+
+	h.connectedMu.Lock()
+	defer h.connectedMu.Unlock()
+	for key, conns := range h.connected {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		delete(h.connected, key)
+	}
+	return nil
 }
 
 func (h *httpTransport) Tracer() opentracing.Tracer {
 	return h.tracer
 }
 
-func (h *httpTransport) newReq(ctx context.Context, r *Request) (*http.Request, error) {
-	url := h.opts.URLs[rand.Intn(len(h.opts.URLs))]
+func (h *httpTransport) newReq(ctx context.Context, url string, r *Request) (*http.Request, error) {
+	body := r.Body
+	if h.opts.REST {
+		var err error
+		url, body, err = restRequest(url, h.opts.Method, r.Method, h.opts.Encoding, body)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// TODO: We should envelope Thrift payloads here.
-	req, err := http.NewRequest(h.opts.Method, url, bytes.NewReader(r.Body))
+	req, err := http.NewRequest(h.opts.Method, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := h.sockets[req.URL.Hostname()]; ok {
+		// Placeholder hosts are only used to pick a socket to dial.
+		req.Host = "localhost"
+	}
 
 	timeout := time.Second
 	if deadline, ok := ctx.Deadline(); ok {
 		timeout = deadline.Sub(time.Now())
 	}
 
-	// TODO: We shouldn't always set YARPC headers, bit maybe have a flag to enable these.
-	h.applyRPCHeaders(req.Header, r, req, timeout)
+	if h.opts.REST {
+		h.applyRESTHeaders(req, r, body)
+	} else {
+		h.applyRPCHeaders(req.Header, r, req, timeout)
+	}
 
 	for key, val := range r.TransportHeaders {
 		req.Header.Add(key, val)
@@ -138,15 +507,45 @@ func (h *httpTransport) applyRPCHeaders(headers http.Header, r *Request, req *ht
 	}
 }
 
+// applyRESTHeaders adds application headers without any prefix.
+func (h *httpTransport) applyRESTHeaders(req *http.Request, r *Request, body []byte) {
+	if h.opts.Encoding == "json" && len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	for key, val := range r.Headers {
+		req.Header.Add(key, val)
+	}
+}
+
 func (h *httpTransport) Protocol() Protocol {
 	return HTTP
 }
 
-func (h *httpTransport) Call(ctx context.Context, r *Request) (*Response, error) {
-	req, err := h.newReq(ctx, r)
+func (h *httpTransport) Call(ctx context.Context, r *Request) (_ *Response, err error) {
+	wire := startWireCall(ctx, HTTP, r.Method)
+	defer func() { wire.finish(err) }()
+
+	// Shard keys are per-transport, so all requests from this transport
+	// use the same peer with the consistent-hash strategy.
+	peer, done := h.peers.Choose(h.opts.ShardKey)
+	defer done()
+
+	req, err := h.newReq(ctx, h.opts.URLs[peer], r)
 	if err != nil {
 		return nil, err
 	}
+	if wire != nil {
+		// The request is reconstructed in HTTP/1.1 format, even if it's
+		// sent using HTTP/2, so the protocol used is recorded separately.
+		dump, err := httputil.DumpRequestOut(req, true /* body */)
+		if err != nil {
+			return nil, err
+		}
+		wire.setPeer(h.opts.URLs[peer])
+		wire.RequestHeaders = flattenHeaders(req.Header)
+		wire.addReconstructedRequest("http", dump)
+	}
 
 	resp, err := h.client.Do(req.WithContext(ctx))
 	if err != nil {
@@ -154,12 +553,12 @@ func (h *httpTransport) Call(ctx context.Context, r *Request) (*Response, error)
 	}
 	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("HTTP call got non-success response code: %v, body: %s", resp.StatusCode, body)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to read HTTP response body: %v", err)
+	body, readErr := ioutil.ReadAll(resp.Body)
+	if wire != nil {
+		head, _ := httputil.DumpResponse(resp, false /* body */)
+		wire.WireProtocol = resp.Proto
+		wire.ResponseHeaders = flattenHeaders(resp.Header)
+		wire.addReconstructedResponse("http", append(head, body...))
 	}
 
 	headers := make(map[string]string)
@@ -167,11 +566,20 @@ func (h *httpTransport) Call(ctx context.Context, r *Request) (*Response, error)
 		headers[headerKey] = resp.Header.Get(headerKey)
 	}
 
-	return &Response{
+	res := &Response{
 		Headers: headers,
 		Body:    body,
 		TransportFields: map[string]interface{}{
 			"statusCode": resp.StatusCode,
+			"protocol":   resp.Proto,
 		},
-	}, nil
+	}
+	if !h.opts.SuccessCodes.Contains(resp.StatusCode) {
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Response: res}
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read HTTP response body: %v", readErr)
+	}
+
+	return res, nil
 }
@@ -0,0 +1,98 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+)
+
+// h2cConnPool is a http2.ClientConnPool for HTTP/2 with prior knowledge that
+// dials using the context of the request, so request timeouts apply to dials.
+type h2cConnPool struct {
+	t    *http2.Transport
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	mu    sync.Mutex
+	conns map[string]*http2.ClientConn
+}
+
+func newH2CConnPool(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *h2cConnPool {
+	p := &h2cConnPool{
+		dial:  dial,
+		conns: make(map[string]*http2.ClientConn),
+	}
+	p.t = &http2.Transport{
+		AllowHTTP: true,
+		ConnPool:  p,
+	}
+	return p
+}
+
+// GetClientConn returns the connection to addr if it can take another
+// request, and dials a new connection otherwise.
+func (p *h2cConnPool) GetClientConn(req *http.Request, addr string) (*http2.ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cc, ok := p.conns[addr]; ok && cc.CanTakeNewRequest() {
+		return cc, nil
+	}
+
+	conn, err := p.dial(req.Context(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := p.t.NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	p.conns[addr] = cc
+	return cc, nil
+}
+
+// MarkDead removes a connection that can't be used from the pool.
+func (p *h2cConnPool) MarkDead(cc *http2.ClientConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for addr, c := range p.conns {
+		if c == cc {
+			delete(p.conns, addr)
+		}
+	}
+}
+
+// Close closes all connections in the pool.
+func (p *h2cConnPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for addr, cc := range p.conns {
+		cc.Close()
+		delete(p.conns, addr)
+	}
+}
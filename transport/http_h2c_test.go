@@ -0,0 +1,56 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestH2CConnPoolDialUsesRequestContext(t *testing.T) {
+	type ctxKey struct{}
+
+	var gotCtx context.Context
+	pool := newH2CConnPool(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		gotCtx = ctx
+		return nil, errors.New("dial failed")
+	})
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "v"), time.Second)
+	defer cancel()
+	req, err := http.NewRequest("POST", "http://localhost:1/rpc", nil)
+	require.NoError(t, err, "NewRequest failed")
+
+	_, err = pool.t.RoundTrip(req.WithContext(ctx))
+	require.Error(t, err, "RoundTrip should fail")
+	assert.Contains(t, err.Error(), "dial failed", "unexpected error")
+	require.NotNil(t, gotCtx, "dial was not called")
+	assert.Equal(t, "v", gotCtx.Value(ctxKey{}), "dial should use the request context")
+	_, hasDeadline := gotCtx.Deadline()
+	assert.True(t, hasDeadline, "dial should use the request deadline")
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// restRequest returns the URL and body for a REST request to the procedure
+// path relative to baseURL. Path parameters such as {id} are replaced by
+// fields of a JSON object body. For methods that don't have a body, the
+// remaining fields are sent as query parameters.
+func restRequest(baseURL, method, procedure, encoding string, body []byte) (string, []byte, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var fields map[string]interface{}
+	if encoding == "json" && len(body) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+
+		// Bodies that are not JSON objects are sent as-is.
+		if err := decoder.Decode(&fields); err != nil {
+			fields = nil
+		}
+	}
+
+	path, rawQuery := procedure, ""
+	if i := strings.IndexByte(procedure, '?'); i >= 0 {
+		path, rawQuery = procedure[:i], procedure[i+1:]
+	}
+
+	path, err = expandPath(path, fields)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Path parameters are escaped, so set both the escaped and unescaped path.
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + strings.TrimPrefix(path, "/")
+	if u.Path, err = url.PathUnescape(u.RawPath); err != nil {
+		return "", nil, fmt.Errorf("invalid path in procedure %q: %v", procedure, err)
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid query in procedure %q: %v", procedure, err)
+	}
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			query.Add(k, v)
+		}
+	}
+
+	if fields != nil {
+		if methodHasBody(method) {
+			if body, err = json.Marshal(fields); err != nil {
+				return "", nil, err
+			}
+		} else {
+			for k, v := range fields {
+				addQueryValues(query, k, v)
+			}
+			body = nil
+		}
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String(), body, nil
+}
+
+// expandPath replaces path parameters such as {id} with the field of the
+// same name, removing the field so it is not sent again.
+func expandPath(path string, fields map[string]interface{}) (string, error) {
+	var expanded strings.Builder
+	for {
+		start := strings.IndexByte(path, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(path[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated path parameter in %q", path)
+		}
+		end += start
+
+		name := path[start+1 : end]
+		v, ok := fields[name]
+		if !ok {
+			return "", fmt.Errorf("missing request field %q for path parameter", name)
+		}
+		delete(fields, name)
+
+		expanded.WriteString(path[:start])
+		expanded.WriteString(url.PathEscape(formatQueryValue(v)))
+		path = path[end+1:]
+	}
+	expanded.WriteString(path)
+	return expanded.String(), nil
+}
+
+func addQueryValues(query url.Values, key string, v interface{}) {
+	if vs, ok := v.([]interface{}); ok {
+		for _, v := range vs {
+			query.Add(key, formatQueryValue(v))
+		}
+		return
+	}
+	query.Add(key, formatQueryValue(v))
+}
+
+func formatQueryValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+
+	// Objects and nested lists are sent as JSON.
+	bs, _ := json.Marshal(v)
+	return string(bs)
+}
+
+func methodHasBody(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRESTRequest(t *testing.T) {
+	tests := []struct {
+		msg       string
+		baseURL   string
+		method    string
+		procedure string
+		encoding  string
+		body      string
+		wantURL   string
+		wantBody  string
+		wantErr   string
+	}{
+		{
+			msg:       "path parameter and query",
+			baseURL:   "http://localhost:8080",
+			method:    "GET",
+			procedure: "/users/{id}",
+			encoding:  "json",
+			body:      `{"id": 12345678901234567890, "verbose": true, "tags": ["a", "b"]}`,
+			wantURL:   "http://localhost:8080/users/12345678901234567890?tags=a&tags=b&verbose=true",
+		},
+		{
+			msg:       "base path and procedure query",
+			baseURL:   "http://localhost:8080/api/?key=k",
+			method:    "GET",
+			procedure: "users/{name}?limit=10",
+			encoding:  "json",
+			body:      `{"name": "a b/c"}`,
+			wantURL:   "http://localhost:8080/api/users/a%20b%2Fc?key=k&limit=10",
+		},
+		{
+			msg:       "body for POST",
+			baseURL:   "http://localhost:8080",
+			method:    "POST",
+			procedure: "/users/{id}/posts",
+			encoding:  "json",
+			body:      `{"id": 1, "post": {"title": "hello"}}`,
+			wantURL:   "http://localhost:8080/users/1/posts",
+			wantBody:  `{"post":{"title":"hello"}}`,
+		},
+		{
+			msg:       "nested object in query",
+			baseURL:   "http://localhost:8080",
+			method:    "DELETE",
+			procedure: "/items",
+			encoding:  "json",
+			body:      `{"filter": {"a": 1}, "empty": null}`,
+			wantURL:   "http://localhost:8080/items?empty=&filter=%7B%22a%22%3A1%7D",
+		},
+		{
+			msg:       "raw body is sent as-is",
+			baseURL:   "http://localhost:8080",
+			method:    "PUT",
+			procedure: "/blob",
+			encoding:  "raw",
+			body:      `{"id": 1}`,
+			wantURL:   "http://localhost:8080/blob",
+			wantBody:  `{"id": 1}`,
+		},
+		{
+			msg:       "JSON array body is sent as-is",
+			baseURL:   "http://localhost:8080",
+			method:    "POST",
+			procedure: "/batch",
+			encoding:  "json",
+			body:      `[1,2]`,
+			wantURL:   "http://localhost:8080/batch",
+			wantBody:  `[1,2]`,
+		},
+		{
+			msg:       "missing path parameter",
+			baseURL:   "http://localhost:8080",
+			method:    "GET",
+			procedure: "/users/{id}",
+			encoding:  "json",
+			body:      `{}`,
+			wantErr:   `missing request field "id"`,
+		},
+		{
+			msg:       "unterminated path parameter",
+			baseURL:   "http://localhost:8080",
+			method:    "GET",
+			procedure: "/users/{id",
+			encoding:  "json",
+			body:      `{"id": 1}`,
+			wantErr:   "unterminated path parameter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			gotURL, gotBody, err := restRequest(tt.baseURL, tt.method, tt.procedure, tt.encoding, []byte(tt.body))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantURL, gotURL, "URL")
+			assert.Equal(t, tt.wantBody, string(gotBody), "body")
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HTTPStatusError is returned for HTTP responses with a status code that is
+// not a success. It contains the response, so it can still be displayed.
+type HTTPStatusError struct {
+	StatusCode int
+	Response   *Response
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP call got non-success response code: %v, body: %s", e.StatusCode, e.Response.Body)
+}
+
+// StatusCodeRange is an inclusive range of HTTP status codes.
+type StatusCodeRange struct {
+	Min, Max int
+}
+
+// StatusCodes is a set of HTTP status codes.
+type StatusCodes []StatusCodeRange
+
+// DefaultSuccessCodes are the status codes treated as a success if none
+// are specified.
+var DefaultSuccessCodes = StatusCodes{{Min: 200, Max: 299}}
+
+// ParseStatusCodes parses a comma-separated list of HTTP status codes and
+// ranges, such as "200-299,404".
+func ParseStatusCodes(s string) (StatusCodes, error) {
+	var codes StatusCodes
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		minStr, maxStr := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			minStr, maxStr = part[:i], part[i+1:]
+		}
+
+		min, err := strconv.Atoi(minStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q in %q", minStr, s)
+		}
+		max, err := strconv.Atoi(maxStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q in %q", maxStr, s)
+		}
+		if min > max {
+			return nil, fmt.Errorf("invalid status code range %q in %q", part, s)
+		}
+
+		codes = append(codes, StatusCodeRange{Min: min, Max: max})
+	}
+	return codes, nil
+}
+
+// Contains returns whether the status code is in the set.
+func (c StatusCodes) Contains(code int) bool {
+	for _, r := range c {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
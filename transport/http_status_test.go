@@ -0,0 +1,79 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	tests := []struct {
+		codes    string
+		contains []int
+		excludes []int
+		wantErr  string
+	}{
+		{
+			codes:    "200-299",
+			contains: []int{200, 204, 299},
+			excludes: []int{199, 300, 404},
+		},
+		{
+			codes:    "200-299, 404,409",
+			contains: []int{200, 404, 409},
+			excludes: []int{400, 500},
+		},
+		{
+			codes:   "200-",
+			wantErr: `invalid status code ""`,
+		},
+		{
+			codes:   "ok",
+			wantErr: `invalid status code "ok"`,
+		},
+		{
+			codes:   "299-200",
+			wantErr: "invalid status code range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.codes, func(t *testing.T) {
+			codes, err := ParseStatusCodes(tt.codes)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			for _, code := range tt.contains {
+				assert.True(t, codes.Contains(code), "%v should contain %v", tt.codes, code)
+			}
+			for _, code := range tt.excludes {
+				assert.False(t, codes.Contains(code), "%v should not contain %v", tt.codes, code)
+			}
+		})
+	}
+}
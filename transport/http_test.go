@@ -21,19 +21,28 @@
 package transport
 
 import (
+	"crypto/tls"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 )
 
 func TestHTTPConstructor(t *testing.T) {
@@ -52,6 +61,17 @@ func TestHTTPConstructor(t *testing.T) {
 		{
 			opts: HTTPOptions{TargetService: "svc", URLs: []string{"http://localhost"}},
 		},
+		{
+			opts: HTTPOptions{URLs: []string{"http://localhost"}, REST: true},
+		},
+		{
+			opts:   HTTPOptions{TargetService: "svc", URLs: []string{"http://localhost"}, PeerStrategy: "fastest"},
+			errMsg: `unknown peer strategy "fastest"`,
+		},
+		{
+			opts:   HTTPOptions{TargetService: "svc", URLs: []string{"http://localhost"}, PeerWeights: []int{1, 2}},
+			errMsg: "got 2 peer weights for 1 peers",
+		},
 	}
 
 	for _, tt := range tests {
@@ -254,3 +274,591 @@ func TestHTTPCall(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPTLS(t *testing.T) {
+	tests := []struct {
+		msg               string
+		requireClientCert bool
+		opts              TLSOptions
+		wantErr           string
+	}{
+		{
+			msg:     "unknown authority",
+			wantErr: "certificate",
+		},
+		{
+			msg:  "custom CA",
+			opts: TLSOptions{CAFile: _testCA},
+		},
+		{
+			msg:  "insecure skip verify",
+			opts: TLSOptions{InsecureSkipVerify: true},
+		},
+		{
+			msg:  "server name",
+			opts: TLSOptions{CAFile: _testCA, ServerName: "yab.test"},
+		},
+		{
+			msg:     "mismatched server name",
+			opts:    TLSOptions{CAFile: _testCA, ServerName: "other.test"},
+			wantErr: "certificate",
+		},
+		{
+			msg:               "missing client certificate",
+			requireClientCert: true,
+			opts:              TLSOptions{CAFile: _testCA},
+			wantErr:           "tls",
+		},
+		{
+			msg:               "client certificate",
+			requireClientCert: true,
+			opts: TLSOptions{
+				CAFile:   _testCA,
+				CertFile: _testClientCert,
+				KeyFile:  _testClientKey,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "ok")
+			}))
+			svr.TLS = serverTLSConfig(t, tt.requireClientCert)
+			svr.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+			svr.StartTLS()
+			defer svr.Close()
+
+			transport, err := NewHTTP(HTTPOptions{
+				URLs:          []string{svr.URL + "/rpc"},
+				SourceService: "source",
+				TargetService: "target",
+				TLS:           tt.opts,
+			})
+			require.NoError(t, err, "Failed to create HTTP transport")
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			res, err := transport.Call(ctx, &Request{Method: "method"})
+			if tt.wantErr != "" {
+				require.Error(t, err, "Call should fail")
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err, "Call failed")
+			assert.Equal(t, "ok", string(res.Body))
+		})
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	svr.TLS = serverTLSConfig(t, true /* requireClientCert */)
+	svr.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	svr.StartTLS()
+	defer svr.Close()
+
+	tlsOpts := TLSOptions{
+		CAFile:   _testCA,
+		CertFile: _testClientCert,
+		KeyFile:  _testClientKey,
+		// The server name is only used for peers.
+		ServerName: "other.test",
+	}
+	for proxyURL, proxy := range newTestProxies(t) {
+		t.Run(proxyURL, func(t *testing.T) {
+			client, err := NewHTTPClient(tlsOpts, proxyURL)
+			require.NoError(t, err, "Failed to create HTTP client")
+
+			res, err := client.Get(svr.URL)
+			require.NoError(t, err, "Request failed")
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "ok", string(body))
+			assert.Equal(t, []string{svr.Listener.Addr().String()}, proxy.Targets(), "request should use the proxy")
+		})
+	}
+
+	client, err := NewHTTPClient(TLSOptions{}, "")
+	require.NoError(t, err, "Failed to create HTTP client")
+	_, err = client.Get(svr.URL)
+	assert.Error(t, err, "request should fail without the TLS options")
+
+	_, err = NewHTTPClient(TLSOptions{CAFile: "not-found.pem"}, "")
+	assert.Error(t, err, "invalid TLS options should fail")
+	_, err = NewHTTPClient(TLSOptions{}, "ftp://localhost:21")
+	assert.Error(t, err, "invalid proxy should fail")
+}
+
+func TestHTTPTLSInvalidOptions(t *testing.T) {
+	_, err := NewHTTP(HTTPOptions{
+		URLs:          []string{"https://localhost"},
+		TargetService: "target",
+		TLS:           TLSOptions{CAFile: "not-found.pem"},
+	})
+	require.Error(t, err, "NewHTTP should fail")
+	assert.Contains(t, err.Error(), "failed to read TLS CA file")
+}
+
+func TestHTTP2(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	})
+
+	tests := []struct {
+		msg          string
+		newServer    func() *httptest.Server
+		http2        bool
+		wantProtocol string
+	}{
+		{
+			msg: "HTTP/1.1 server",
+			newServer: func() *httptest.Server {
+				return httptest.NewServer(handler)
+			},
+			wantProtocol: "HTTP/1.1",
+		},
+		{
+			msg: "h2c server without HTTP/2",
+			newServer: func() *httptest.Server {
+				return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+			},
+			wantProtocol: "HTTP/1.1",
+		},
+		{
+			msg: "h2c server with HTTP/2",
+			newServer: func() *httptest.Server {
+				return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+			},
+			http2:        true,
+			wantProtocol: "HTTP/2.0",
+		},
+		{
+			msg: "TLS server",
+			newServer: func() *httptest.Server {
+				svr := httptest.NewUnstartedServer(handler)
+				svr.EnableHTTP2 = true
+				svr.StartTLS()
+				return svr
+			},
+			wantProtocol: "HTTP/2.0",
+		},
+		{
+			msg: "TLS server without HTTP/2 support",
+			newServer: func() *httptest.Server {
+				return httptest.NewTLSServer(handler)
+			},
+			wantProtocol: "HTTP/1.1",
+		},
+		{
+			msg: "TLS server with HTTP/2",
+			newServer: func() *httptest.Server {
+				svr := httptest.NewUnstartedServer(handler)
+				svr.EnableHTTP2 = true
+				svr.StartTLS()
+				return svr
+			},
+			http2:        true,
+			wantProtocol: "HTTP/2.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			svr := tt.newServer()
+			defer svr.Close()
+
+			transport, err := NewHTTP(HTTPOptions{
+				URLs:          []string{svr.URL + "/rpc"},
+				SourceService: "source",
+				TargetService: "target",
+				TLS:           TLSOptions{InsecureSkipVerify: true},
+				HTTP2:         tt.http2,
+			})
+			require.NoError(t, err, "Failed to create HTTP transport")
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			res, err := transport.Call(ctx, &Request{Method: "method"})
+			require.NoError(t, err, "Call failed")
+			assert.Equal(t, tt.wantProtocol, string(res.Body), "unexpected protocol seen by server")
+			assert.Equal(t, tt.wantProtocol, res.TransportFields["protocol"], "unexpected protocol in transport fields")
+		})
+	}
+}
+
+func TestHTTP2Connect(t *testing.T) {
+	var conns atomic.Int32
+	svr := httptest.NewUnstartedServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}), &http2.Server{}))
+	svr.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Inc()
+		}
+	}
+	svr.Start()
+	defer svr.Close()
+
+	transport, err := NewHTTP(HTTPOptions{
+		URLs:          []string{svr.URL + "/rpc"},
+		SourceService: "source",
+		TargetService: "target",
+		HTTP2:         true,
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+	defer transport.(TransportCloser).Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, transport.(Connector).Connect(ctx), "Connect failed")
+
+	for i := 0; i < 3; i++ {
+		res, err := transport.Call(ctx, &Request{Method: "method"})
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "HTTP/2.0", res.TransportFields["protocol"])
+	}
+	assert.EqualValues(t, 1, conns.Load(), "calls should be multiplexed on the connection from Connect")
+}
+
+func TestHTTPREST(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = ioutil.ReadAll(r.Body)
+		io.WriteString(w, `{"ok": true}`)
+	}))
+	defer svr.Close()
+
+	tests := []struct {
+		method    string
+		wantQuery string
+		wantBody  string
+	}{
+		{
+			method:    "GET",
+			wantQuery: "verbose=true",
+		},
+		{
+			method:   "POST",
+			wantBody: `{"verbose":true}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			transport, err := NewHTTP(HTTPOptions{
+				Method:        tt.method,
+				URLs:          []string{svr.URL},
+				SourceService: "source",
+				TargetService: "target",
+				Encoding:      "json",
+				REST:          true,
+			})
+			require.NoError(t, err, "Failed to create HTTP transport")
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			res, err := transport.Call(ctx, &Request{
+				Method:  "/users/{id}",
+				Headers: map[string]string{"Authorization": "Bearer token"},
+				Body:    []byte(`{"id":"u1","verbose":true}`),
+			})
+			require.NoError(t, err, "Call failed")
+			assert.Equal(t, `{"ok": true}`, string(res.Body))
+
+			assert.Equal(t, tt.method, got.Method, "method")
+			assert.Equal(t, "/users/u1", got.URL.Path, "path")
+			assert.Equal(t, tt.wantQuery, got.URL.RawQuery, "query")
+			assert.Equal(t, tt.wantBody, string(gotBody), "body")
+			assert.Equal(t, "Bearer token", got.Header.Get("Authorization"), "headers should not be prefixed")
+			for k := range got.Header {
+				assert.NotContains(t, strings.ToLower(k), "rpc-", "YARPC headers should not be sent")
+				assert.NotEqual(t, "Context-Ttl-Ms", k, "YARPC headers should not be sent")
+			}
+		})
+	}
+}
+
+func TestHTTPSuccessCodes(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Custom-Header", "value")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error": "not found"}`)
+	}))
+	defer svr.Close()
+
+	tests := []struct {
+		msg          string
+		successCodes StatusCodes
+		wantErr      bool
+	}{
+		{
+			msg:     "default success codes",
+			wantErr: true,
+		},
+		{
+			msg:          "404 is a success",
+			successCodes: StatusCodes{{Min: 200, Max: 299}, {Min: 404, Max: 404}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			transport, err := NewHTTP(HTTPOptions{
+				URLs:          []string{svr.URL},
+				SourceService: "source",
+				TargetService: "target",
+				SuccessCodes:  tt.successCodes,
+			})
+			require.NoError(t, err, "Failed to create HTTP transport")
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			res, err := transport.Call(ctx, &Request{Method: "method"})
+			if tt.wantErr {
+				require.Error(t, err, "Call should fail")
+				statusErr, ok := err.(*HTTPStatusError)
+				require.True(t, ok, "expected HTTPStatusError, got %T", err)
+				assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+				res = statusErr.Response
+			} else {
+				require.NoError(t, err, "Call failed")
+			}
+
+			assert.Equal(t, `{"error": "not found"}`, string(res.Body))
+			assert.Equal(t, "value", res.Headers["Custom-Header"])
+			assert.Equal(t, http.StatusNotFound, res.TransportFields["statusCode"])
+		})
+	}
+}
+
+func TestHTTPPeerStrategy(t *testing.T) {
+	const numServers = 3
+
+	var urls []string
+	counters := make([]*atomic.Int32, numServers)
+	for i := range counters {
+		counter := atomic.NewInt32(0)
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counter.Inc()
+		}))
+		defer svr.Close()
+
+		counters[i] = counter
+		urls = append(urls, svr.URL)
+	}
+
+	tests := []struct {
+		strategy string
+		weights  []int
+		want     func(t *testing.T, counts []int32)
+	}{
+		{
+			strategy: "round-robin",
+			want: func(t *testing.T, counts []int32) {
+				assert.Equal(t, []int32{4, 4, 4}, counts, "round-robin should spread requests evenly")
+			},
+		},
+		{
+			strategy: "least-pending",
+			want: func(t *testing.T, counts []int32) {
+				assert.Equal(t, []int32{4, 4, 4}, counts, "sequential requests should be spread evenly")
+			},
+		},
+		{
+			strategy: "consistent-hash",
+			want: func(t *testing.T, counts []int32) {
+				assert.Contains(t, counts, int32(12), "all requests should go to a single peer")
+			},
+		},
+		{
+			strategy: "weighted",
+			weights:  []int{0, 1, 0},
+			want: func(t *testing.T, counts []int32) {
+				assert.Equal(t, []int32{0, 12, 0}, counts, "requests should only go to weighted peers")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			for _, c := range counters {
+				c.Store(0)
+			}
+
+			transport, err := NewHTTP(HTTPOptions{
+				URLs:          urls,
+				SourceService: "source",
+				TargetService: "target",
+				ShardKey:      "sk",
+				PeerStrategy:  tt.strategy,
+				PeerWeights:   tt.weights,
+			})
+			require.NoError(t, err, "Failed to create HTTP transport")
+
+			for i := 0; i < 12; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				_, err := transport.Call(ctx, &Request{Method: "method"})
+				cancel()
+				require.NoError(t, err, "Call failed")
+			}
+
+			counts := make([]int32, numServers)
+			for i, c := range counters {
+				counts[i] = c.Load()
+			}
+			tt.want(t, counts)
+		})
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	var conns atomic.Int32
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	svr.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Inc()
+		}
+	}
+	svr.Start()
+	defer svr.Close()
+
+	transport, err := NewHTTP(HTTPOptions{
+		URLs:          []string{svr.URL + "/rpc"},
+		SourceService: "source",
+		TargetService: "target",
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, transport.(Connector).Connect(ctx), "Connect failed")
+	assert.EqualValues(t, 1, conns.Load(), "Connect should establish a connection")
+
+	// The call should use the connection established by Connect.
+	_, err = transport.Call(ctx, &Request{Method: "method"})
+	require.NoError(t, err, "Call failed")
+	assert.EqualValues(t, 1, conns.Load(), "Call should reuse the connection")
+
+	assert.NoError(t, transport.(TransportCloser).Close(), "Close failed")
+}
+
+func TestHTTPConnectTLS(t *testing.T) {
+	var handshakes atomic.Int32
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	svr.EnableHTTP2 = true
+	svr.TLS = &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			handshakes.Inc()
+			return nil, nil
+		},
+	}
+	svr.StartTLS()
+	defer svr.Close()
+
+	transport, err := NewHTTP(HTTPOptions{
+		URLs:          []string{svr.URL + "/rpc"},
+		SourceService: "source",
+		TargetService: "target",
+		TLS:           TLSOptions{InsecureSkipVerify: true},
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+	defer transport.(TransportCloser).Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, transport.(Connector).Connect(ctx), "Connect failed")
+	assert.EqualValues(t, 1, handshakes.Load(), "Connect should complete the TLS handshake")
+
+	for i := 0; i < 3; i++ {
+		res, err := transport.Call(ctx, &Request{Method: "method"})
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "HTTP/2.0", string(res.Body), "unexpected protocol seen by server")
+	}
+	assert.EqualValues(t, 1, handshakes.Load(), "calls should use the connection from Connect")
+}
+
+func TestHTTPConnectFails(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	closedURL := "http://" + ln.Addr().String()
+	require.NoError(t, ln.Close(), "Close listener failed")
+
+	transport, err := NewHTTP(HTTPOptions{
+		URLs:          []string{closedURL},
+		TargetService: "target",
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = transport.(Connector).Connect(ctx)
+	require.Error(t, err, "Connect to closed port should fail")
+	assert.Contains(t, err.Error(), "connection refused", "Unexpected error")
+}
+
+func TestHTTPUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "http.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err, "Listen failed")
+
+	var conns atomic.Int32
+	svr := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%v %v", r.Host, r.URL.Path)
+		}),
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				conns.Inc()
+			}
+		},
+	}
+	go svr.Serve(ln)
+	defer svr.Close()
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "unix://" + socket, want: "localhost /"},
+		{url: "http+unix://" + socket + ":/rpc", want: "localhost /rpc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			transport, err := NewHTTP(HTTPOptions{
+				URLs:          []string{tt.url},
+				SourceService: "source",
+				TargetService: "target",
+			})
+			require.NoError(t, err, "Failed to create HTTP transport")
+			defer transport.(TransportCloser).Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			before := conns.Load()
+			require.NoError(t, transport.(Connector).Connect(ctx), "Connect failed")
+
+			res, err := transport.Call(ctx, &Request{Method: "method"})
+			require.NoError(t, err, "Call failed")
+			assert.Equal(t, tt.want, string(res.Body), "Unexpected response")
+			assert.Equal(t, before+1, conns.Load(), "Call should reuse the connection from Connect")
+		})
+	}
+}
@@ -66,6 +66,18 @@ const (
 	GRPC
 )
 
+func (p Protocol) String() string {
+	switch p {
+	case TChannel:
+		return "tchannel"
+	case HTTP:
+		return "http"
+	case GRPC:
+		return "grpc"
+	}
+	return "unknown"
+}
+
 // Transport defines the interface for the underlying transport over which
 // unary calls are made.
 type Transport interface {
@@ -85,3 +97,21 @@ type TransportCloser interface {
 	Transport
 	io.Closer
 }
+
+// Connector is a Transport that can establish connections to its peers
+// before any calls are made, so connection setup can be measured separately.
+type Connector interface {
+	Transport
+
+	// Connect blocks until the transport has a connection ready for calls.
+	Connect(ctx context.Context) error
+}
+
+// WireCounter is a Transport that counts the bytes of messages it sends and
+// receives on the wire, after compression.
+type WireCounter interface {
+	Transport
+
+	// WireBytes returns the total bytes of messages sent and received.
+	WireBytes() (sent, received int64)
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/proxy"
+)
+
+// newDialer returns a dialer for peers that connects through the proxy, if
+// one is specified. Addresses returned by UnixAddress are dialed directly.
+func newDialer(proxy string) (contextDialer, error) {
+	dialer := &net.Dialer{}
+	if proxy == "" {
+		return dialUnixAddresses(dialer.DialContext), nil
+	}
+
+	proxyURL, err := parseProxy(proxy)
+	if err != nil {
+		return nil, err
+	}
+	return dialUnixAddresses(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// Unix sockets are local, so they're never reached through the proxy.
+		if network == unixScheme {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return dialProxy(ctx, dialer, proxyURL, addr)
+	}), nil
+}
+
+// NewGRPCDialer returns a dialer for gRPC connections that connects through
+// the proxy, if one is specified, and dials addresses returned by UnixAddress
+// using unix domain sockets.
+func NewGRPCDialer(proxy string) (func(ctx context.Context, addr string) (net.Conn, error), error) {
+	dial, err := newDialer(proxy)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return dial(ctx, "tcp", addr)
+	}, nil
+}
+
+// parseProxy parses the URL of a HTTP CONNECT or SOCKS5 proxy. Proxies
+// without a scheme are assumed to be HTTP proxies.
+func parseProxy(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", proxy, err)
+	}
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "socks5" {
+		return nil, fmt.Errorf("unsupported proxy scheme %q, must be http or socks5", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", proxy)
+	}
+	return proxyURL, nil
+}
+
+// dialProxy connects to addr through the given proxy.
+func dialProxy(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if proxyURL.Scheme == "socks5" {
+		conn, err = dialSOCKS5(ctx, dialer, proxyURL, addr)
+	} else {
+		conn, err = dialConnect(ctx, dialer, proxyURL, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %v through proxy %v: %v", addr, proxyURL.Host, err)
+	}
+	return conn, nil
+}
+
+func dialSOCKS5(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		auth = &proxy.Auth{User: user.Username(), Password: password}
+	}
+
+	socks, err := proxy.SOCKS5("tcp", proxyAddr(proxyURL, "1080"), auth, dialer)
+	if err != nil {
+		return nil, err
+	}
+	return socks.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+}
+
+func dialConnect(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (_ net.Conn, err error) {
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr(proxyURL, "80"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT failed: %v", res.Status)
+	}
+
+	// The peer may have already written data that was buffered.
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// proxyAddr returns the host:port of the proxy, using the default port if
+// the URL doesn't specify one.
+func proxyAddr(proxyURL *url.URL, defaultPort string) string {
+	if proxyURL.Port() != "" {
+		return proxyURL.Host
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), defaultPort)
+}
+
+// bufferedConn is a net.Conn that reads from a buffered reader.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
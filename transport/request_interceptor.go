@@ -1,19 +1,63 @@
 package transport
 
-import "context"
+import (
+	"context"
+	"sync"
+)
 
-// stores the currently registered middleware
-var registeredInterceptor RequestInterceptor
+// registeredInterceptor is an entry in the interceptor chain. Entries are
+// compared by pointer so they can be removed in any order.
+type registeredInterceptor struct {
+	request  RequestInterceptor
+	response ResponseInterceptor
+}
+
+var (
+	// interceptorsMu guards registeredInterceptors, since interceptors may
+	// be registered or restored while other goroutines make calls.
+	interceptorsMu sync.RWMutex
+
+	// stores the currently registered middleware, in the order it was registered
+	registeredInterceptors []*registeredInterceptor
+)
 
-// RegisterInterceptor sets the provided request interceptor to be used on future
-// calls to ApplyInterceptor(). Calls to RegisterInterceptor() will overwrite previously
-// registered interceptors; that is, only one interceptor is allowed at a time.
+// RegisterInterceptor adds the provided request interceptor to the end of
+// the chain used by future calls to ApplyInterceptor() and Call(). If the
+// interceptor also implements ResponseInterceptor, it's also used by
+// ApplyResponseInterceptors(). Interceptors should be registered before
+// any calls are made, but it's safe to register them concurrently with
+// calls, which use the interceptors registered when they start.
 // Returns a function to undo the change made by this call.
 func RegisterInterceptor(newRI RequestInterceptor) (restore func()) {
-	oldRI := registeredInterceptor
-	registeredInterceptor = newRI
+	entry := &registeredInterceptor{request: newRI}
+	if response, ok := newRI.(ResponseInterceptor); ok {
+		entry.response = response
+	}
+	return register(entry)
+}
+
+// RegisterResponseInterceptor adds the provided response interceptor to the
+// end of the chain used by future calls to ApplyResponseInterceptors().
+// Returns a function to undo the change made by this call.
+func RegisterResponseInterceptor(newRI ResponseInterceptor) (restore func()) {
+	return register(&registeredInterceptor{response: newRI})
+}
+
+func register(entry *registeredInterceptor) (restore func()) {
+	interceptorsMu.Lock()
+	defer interceptorsMu.Unlock()
+
+	registeredInterceptors = append(registeredInterceptors, entry)
 	return func() {
-		registeredInterceptor = oldRI
+		interceptorsMu.Lock()
+		defer interceptorsMu.Unlock()
+
+		for i, ri := range registeredInterceptors {
+			if ri == entry {
+				registeredInterceptors = append(registeredInterceptors[:i:i], registeredInterceptors[i+1:]...)
+				return
+			}
+		}
 	}
 }
 
@@ -23,10 +67,118 @@ type RequestInterceptor interface {
 	Apply(ctx context.Context, req *Request) (*Request, error)
 }
 
-// ApplyInterceptor mutates a Request using the previously registered RequestInterceptor.
+// ResponseInterceptor allows for its implementors to observe or modify the
+// result of a call, which is either a Response or an error.
+type ResponseInterceptor interface {
+	// ApplyResponse is passed the request and the result of the call, and
+	// returns the result passed to the next interceptor. The response is
+	// always nil for streams, which are intercepted once they end.
+	ApplyResponse(ctx context.Context, req *Request, res *Response, err error) (*Response, error)
+}
+
+// ApplyInterceptor mutates a Request using the registered RequestInterceptors,
+// in the order they were registered. If any interceptor fails, the error is
+// returned and the remaining interceptors are not applied.
 func ApplyInterceptor(ctx context.Context, req *Request) (*Request, error) {
-	if registeredInterceptor == nil {
-		return req, nil
+	for _, ri := range interceptors() {
+		if ri.request == nil {
+			continue
+		}
+
+		var err error
+		if req, err = ri.request.Apply(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// ApplyResponseInterceptors passes the result of a call through the
+// registered ResponseInterceptors in the reverse order they were registered,
+// so the first interceptor registered sees the final result.
+func ApplyResponseInterceptors(ctx context.Context, req *Request, res *Response, err error) (*Response, error) {
+	registered := interceptors()
+	for i := len(registered) - 1; i >= 0; i-- {
+		if ri := registered[i].response; ri != nil {
+			res, err = ri.ApplyResponse(ctx, req, res, err)
+		}
+	}
+	return res, err
+}
+
+// interceptors returns the registered interceptors. Registering or
+// restoring an interceptor doesn't modify the returned slice, so it can be
+// used without holding the lock.
+func interceptors() []*registeredInterceptor {
+	interceptorsMu.RLock()
+	defer interceptorsMu.RUnlock()
+	return registeredInterceptors
+}
+
+type protocolKey struct{}
+
+// ProtocolFromContext returns the protocol used for the request being
+// intercepted, or Unknown if it's not set. It's set in the context passed to
+// RequestInterceptors by Call and InterceptStreamRequest.
+func ProtocolFromContext(ctx context.Context) Protocol {
+	p, _ := ctx.Value(protocolKey{}).(Protocol)
+	return p
+}
+
+// InterceptRequest applies the registered RequestInterceptors to a copy of
+// the request, so the same request can be shared by concurrent calls.
+func InterceptRequest(ctx context.Context, req *Request) (*Request, error) {
+	for _, ri := range interceptors() {
+		if ri.request != nil {
+			return ApplyInterceptor(ctx, copyRequest(req))
+		}
+	}
+	return req, nil
+}
+
+// InterceptStreamRequest is InterceptRequest for stream requests made using
+// the given transport.
+func InterceptStreamRequest(ctx context.Context, t Transport, streamReq *StreamRequest) (*StreamRequest, error) {
+	ctx = context.WithValue(ctx, protocolKey{}, t.Protocol())
+	req, err := InterceptRequest(ctx, streamReq.Request)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamRequest{Request: req}, nil
+}
+
+// Call makes a call using the given transport. The registered
+// RequestInterceptors are applied to the request for each call, and the
+// ResponseInterceptors are applied to the result. If a RequestInterceptor
+// fails, the call is not made.
+func Call(ctx context.Context, t Transport, req *Request) (*Response, error) {
+	req, err := InterceptRequest(context.WithValue(ctx, protocolKey{}, t.Protocol()), req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.Call(ctx, req)
+	return ApplyResponseInterceptors(ctx, req, res, err)
+}
+
+// copyRequest returns a copy of the request with copies of the header maps,
+// so they can be modified by interceptors.
+func copyRequest(req *Request) *Request {
+	copied := *req
+	copied.Headers = copyHeaders(req.Headers)
+	copied.Baggage = copyHeaders(req.Baggage)
+	copied.TransportHeaders = copyHeaders(req.TransportHeaders)
+	return &copied
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
 	}
-	return registeredInterceptor.Apply(ctx, req)
+	return copied
 }
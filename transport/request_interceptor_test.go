@@ -3,8 +3,11 @@ package transport
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -39,7 +42,8 @@ func TestRequestInterceptor(t *testing.T) {
 		}
 		if !tt.dontRegister {
 			restore = RegisterInterceptor(ri)
-			require.Equal(t, ri, registeredInterceptor)
+			require.Len(t, registeredInterceptors, 1)
+			require.Equal(t, ri, registeredInterceptors[0].request)
 		}
 
 		// create test request
@@ -73,3 +77,208 @@ func TestRequestInterceptor(t *testing.T) {
 		assert.Equal(t, "bar", req.Headers["foo"], "[%d] test interceptor should have applied", idx)
 	}
 }
+
+// chainInterceptor appends its name to the request's method and to the
+// response body, so the order interceptors are applied in can be checked.
+type chainInterceptor struct {
+	name    string
+	wantErr error
+}
+
+func (ci chainInterceptor) Apply(ctx context.Context, req *Request) (*Request, error) {
+	if ci.wantErr != nil {
+		return nil, ci.wantErr
+	}
+	req.Method += ci.name
+	return req, nil
+}
+
+func (ci chainInterceptor) ApplyResponse(ctx context.Context, req *Request, res *Response, err error) (*Response, error) {
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ci.name, err)
+	}
+	if ci.wantErr != nil {
+		return nil, ci.wantErr
+	}
+	res.Body = append(res.Body, ci.name...)
+	return res, nil
+}
+
+type responseInterceptor func(ctx context.Context, req *Request, res *Response, err error) (*Response, error)
+
+func (f responseInterceptor) ApplyResponse(ctx context.Context, req *Request, res *Response, err error) (*Response, error) {
+	return f(ctx, req, res, err)
+}
+
+func TestInterceptorChain(t *testing.T) {
+	restoreA := RegisterInterceptor(chainInterceptor{name: "a"})
+	restoreB := RegisterInterceptor(chainInterceptor{name: "b"})
+	restoreC := RegisterResponseInterceptor(responseInterceptor(func(ctx context.Context, req *Request, res *Response, err error) (*Response, error) {
+		if res != nil {
+			res.Body = append(res.Body, 'c')
+		}
+		return res, err
+	}))
+	defer restoreC()
+
+	req, err := ApplyInterceptor(context.Background(), &Request{Method: "m"})
+	require.NoError(t, err)
+	assert.Equal(t, "mab", req.Method, "Request interceptors should be applied in order")
+
+	res, err := ApplyResponseInterceptors(context.Background(), req, &Response{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "cba", string(res.Body), "Response interceptors should be applied in reverse order")
+
+	_, err = ApplyResponseInterceptors(context.Background(), req, nil, errors.New("failed"))
+	assert.EqualError(t, err, "a: b: failed", "Response interceptors should see errors")
+
+	// Interceptors can be removed in any order.
+	restoreA()
+	req, err = ApplyInterceptor(context.Background(), &Request{Method: "m"})
+	require.NoError(t, err)
+	assert.Equal(t, "mb", req.Method)
+
+	restoreB()
+	req, err = ApplyInterceptor(context.Background(), &Request{Method: "m"})
+	require.NoError(t, err)
+	assert.Equal(t, "m", req.Method)
+	require.Len(t, registeredInterceptors, 1, "Only the response interceptor should remain")
+}
+
+func TestInterceptorChainErrors(t *testing.T) {
+	restoreA := RegisterInterceptor(chainInterceptor{name: "a", wantErr: errors.New("bad a")})
+	defer restoreA()
+	restoreB := RegisterInterceptor(chainInterceptor{name: "b"})
+	defer restoreB()
+
+	req := &Request{Method: "m"}
+	_, err := ApplyInterceptor(context.Background(), req)
+	assert.EqualError(t, err, "bad a")
+	assert.Equal(t, "m", req.Method, "Interceptors after a failure should not be applied")
+
+	_, err = ApplyResponseInterceptors(context.Background(), req, &Response{}, nil)
+	assert.EqualError(t, err, "bad a", "Response interceptors can fail successful calls")
+}
+
+func TestCallAppliesResponseInterceptors(t *testing.T) {
+	var gotReq *Request
+	restore := RegisterResponseInterceptor(responseInterceptor(func(ctx context.Context, req *Request, res *Response, err error) (*Response, error) {
+		gotReq = req
+		if err != nil {
+			return &Response{Body: []byte("recovered")}, nil
+		}
+		return res, err
+	}))
+	defer restore()
+
+	req := &Request{Method: "m"}
+	res, err := Call(context.Background(), errTransport{errors.New("failed")}, req)
+	require.NoError(t, err)
+	assert.Equal(t, "recovered", string(res.Body))
+	assert.Equal(t, req, gotReq, "Response interceptor should get the request")
+}
+
+type errTransport struct {
+	err error
+}
+
+func (t errTransport) Call(ctx context.Context, r *Request) (*Response, error) {
+	return nil, t.err
+}
+
+func (t errTransport) Protocol() Protocol { return Unknown }
+
+func (t errTransport) Tracer() opentracing.Tracer { return nil }
+
+func TestCallInterceptsCopy(t *testing.T) {
+	restore := RegisterInterceptor(headerRequestInterceptor{})
+	defer restore()
+
+	var got *Request
+	tr := transportFunc(func(ctx context.Context, req *Request) (*Response, error) {
+		got = req
+		return &Response{}, nil
+	})
+
+	req := &Request{Headers: map[string]string{"zim": "zam"}}
+	_, err := Call(context.Background(), tr, req)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"zim": "zam", "foo": "bar"}, got.Headers, "Interceptor should be applied to the call")
+	assert.Equal(t, map[string]string{"zim": "zam"}, req.Headers, "Interceptor should not modify the original request")
+}
+
+func TestCallInterceptorFails(t *testing.T) {
+	restore := RegisterInterceptor(headerRequestInterceptor{wantErr: true})
+	defer restore()
+
+	tr := transportFunc(func(ctx context.Context, req *Request) (*Response, error) {
+		t.Fatal("Call should not be made if an interceptor fails")
+		return nil, nil
+	})
+
+	_, err := Call(context.Background(), tr, &Request{Headers: map[string]string{}})
+	assert.EqualError(t, err, "bad apply")
+}
+
+func TestRegisterInterceptorConcurrentCalls(t *testing.T) {
+	tr := transportFunc(func(ctx context.Context, req *Request) (*Response, error) {
+		return &Response{}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			restore := RegisterInterceptor(headerRequestInterceptor{})
+			restore()
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := Call(context.Background(), tr, &Request{Headers: map[string]string{}})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Empty(t, registeredInterceptors, "All interceptors should be restored")
+}
+
+type transportFunc func(ctx context.Context, req *Request) (*Response, error)
+
+func (f transportFunc) Call(ctx context.Context, req *Request) (*Response, error) {
+	return f(ctx, req)
+}
+
+func (f transportFunc) Protocol() Protocol { return Unknown }
+
+func (f transportFunc) Tracer() opentracing.Tracer { return nil }
+
+func TestInterceptorProtocol(t *testing.T) {
+	var got []Protocol
+	restore := RegisterInterceptor(requestInterceptor(func(ctx context.Context, req *Request) (*Request, error) {
+		got = append(got, ProtocolFromContext(ctx))
+		return req, nil
+	}))
+	defer restore()
+
+	_, err := Call(context.Background(), protocolTransport{p: HTTP}, &Request{})
+	require.NoError(t, err)
+	_, err = InterceptStreamRequest(context.Background(), protocolTransport{p: GRPC}, &StreamRequest{Request: &Request{}})
+	require.NoError(t, err)
+	_, err = InterceptRequest(context.Background(), &Request{})
+	require.NoError(t, err)
+	assert.Equal(t, []Protocol{HTTP, GRPC, Unknown}, got)
+}
+
+type requestInterceptor func(ctx context.Context, req *Request) (*Request, error)
+
+func (f requestInterceptor) Apply(ctx context.Context, req *Request) (*Request, error) {
+	return f(ctx, req)
+}
+
+type protocolTransport struct {
+	errTransport
+	p Protocol
+}
+
+func (t protocolTransport) Protocol() Protocol { return t.p }
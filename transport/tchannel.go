@@ -24,7 +24,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 
@@ -39,7 +38,9 @@ import (
 const rawHeadersKey = "_raw_"
 
 type tchan struct {
+	ch          *tchannel.Channel
 	sc          *tchannel.SubChannel
+	peers       []string
 	callOptions *tchannel.CallOptions
 	tracer      opentracing.Tracer
 }
@@ -68,7 +69,8 @@ type TChannelOptions struct {
 	// LogLevel overrides the default LogLevel (Warn).
 	LogLevel *tchannel.LogLevel
 
-	// Peers is a list of host:ports to add to the channel.
+	// Peers is a list of host:ports to add to the channel. Peers that listen
+	// on a unix domain socket are specified using UnixAddress.
 	Peers []string
 
 	// Encoding is used to set the TChannel format ("as" header).
@@ -84,6 +86,10 @@ type TChannelOptions struct {
 	// Tracer is an instance of an opentracing tracer for baggage propagation
 	// and/or span submission.
 	Tracer opentracing.Tracer
+
+	// Proxy is the URL of an HTTP CONNECT or SOCKS5 proxy used to reach
+	// the peers, if set.
+	Proxy string
 }
 
 // NewTChannel returns a Transport that calls a TChannel service.
@@ -104,10 +110,16 @@ func NewTChannel(opts TChannelOptions) (Transport, error) {
 	}
 	processName := fmt.Sprintf("%v@%v:%v[%v]", os.Getenv("USER"), hostname, os.Args[0], os.Getpid())
 
+	dialer, err := newDialer(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
 	ch, err := tchannel.NewChannel(callerName, &tchannel.ChannelOptions{
 		Logger:      tchannel.NewLevelLogger(tchannel.SimpleLogger, level),
 		ProcessName: processName,
 		Tracer:      opts.Tracer,
+		Dialer:      dialer,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TChannel: %v", err)
@@ -124,7 +136,9 @@ func NewTChannel(opts TChannelOptions) (Transport, error) {
 	applyTChanOptions(callOpts, opts.TransportOpts)
 
 	return &tchan{
+		ch:          ch,
 		sc:          ch.GetSubChannel(opts.TargetService),
+		peers:       opts.Peers,
 		callOptions: callOpts,
 		tracer:      opts.Tracer,
 	}, nil
@@ -138,7 +152,25 @@ func (t *tchan) Protocol() Protocol {
 	return TChannel
 }
 
-func (t *tchan) Call(ctx context.Context, r *Request) (*Response, error) {
+// Connect completes the TChannel init handshake with every peer.
+func (t *tchan) Connect(ctx context.Context) error {
+	for _, hp := range t.peers {
+		if _, err := t.ch.Peers().GetOrAdd(hp).GetConnection(ctx); err != nil {
+			return fmt.Errorf("failed to connect to %v: %v", hp, err)
+		}
+	}
+	return nil
+}
+
+func (t *tchan) Close() error {
+	t.ch.Close()
+	return nil
+}
+
+func (t *tchan) Call(ctx context.Context, r *Request) (_ *Response, err error) {
+	wire := startWireCall(ctx, TChannel, r.Method)
+	defer func() { wire.finish(err) }()
+
 	// We must create a shallow copy of the request headers because, at time of
 	// writing, we cannot prepare the trace headers before obtaining a TChannel
 	// call object. Consequently, we have to inject the headers and alter the
@@ -150,16 +182,21 @@ func (t *tchan) Call(ctx context.Context, r *Request) (*Response, error) {
 	call, err := t.sc.BeginCall(ctx, req.Method, t.callOptions)
 
 	if err != nil {
-		return nil, fmt.Errorf("begin call failed: %v", err)
+		return nil, fmt.Errorf("begin call failed: %w", err)
 	}
 
 	req.Headers = tchannel.InjectOutboundSpan(call.Response(), req.Headers)
+	if wire != nil {
+		wire.setPeer(call.RemotePeer().HostPort)
+		wire.RequestHeaders = req.Headers
+		wire.addRequest("arg1", []byte(req.Method))
+	}
 
-	if err := t.writeArgs(call, &req); err != nil {
+	if err := t.writeArgs(call, &req, wire); err != nil {
 		return nil, err
 	}
 
-	res, err := t.readResponse(call)
+	res, err := t.readResponse(call, wire)
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +206,7 @@ func (t *tchan) Call(ctx context.Context, r *Request) (*Response, error) {
 	return res, nil
 }
 
-func (t *tchan) readResponse(call *tchannel.OutboundCall) (*Response, error) {
+func (t *tchan) readResponse(call *tchannel.OutboundCall, wire *WireCall) (*Response, error) {
 	response := call.Response()
 
 	annotateError := func(msg string, err error) error {
@@ -185,6 +222,7 @@ func (t *tchan) readResponse(call *tchannel.OutboundCall) (*Response, error) {
 		if err != nil {
 			return err
 		}
+		wire.addResponse("arg2", headerBytes)
 
 		if len(headerBytes) == 0 {
 			return nil
@@ -211,6 +249,10 @@ func (t *tchan) readResponse(call *tchannel.OutboundCall) (*Response, error) {
 	if err := tchannel.NewArgReader(response.Arg3Reader()).Read(&responseBytes); err != nil {
 		return nil, annotateError("failed to read response body", err)
 	}
+	wire.addResponse("arg3", responseBytes)
+	if wire != nil {
+		wire.ResponseHeaders = headers
+	}
 
 	return &Response{
 		Headers: headers,
@@ -221,26 +263,21 @@ func (t *tchan) readResponse(call *tchannel.OutboundCall) (*Response, error) {
 	}, nil
 }
 
-func (t *tchan) writeArgs(call *tchannel.OutboundCall, r *Request) error {
-	if err := writeHelper(call.Arg2Writer, func(writer tchannel.ArgWriter) error {
-		switch t.callOptions.Format {
-		case tchannel.JSON:
-			encoder := json.NewEncoder(writer)
-			return encoder.Encode(r.Headers)
-		case tchannel.Raw:
-			if v, ok := r.Headers[rawHeadersKey]; ok {
-				_, err := io.WriteString(writer, v)
-				return err
-			}
+func (t *tchan) writeArgs(call *tchannel.OutboundCall, r *Request, wire *WireCall) error {
+	headerBytes, err := t.encodeHeaders(r.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to write headers: %v", err)
+	}
+	wire.addRequest("arg2", headerBytes)
 
-			fallthrough
-		default:
-			return thrift.WriteHeaders(writer, r.Headers)
-		}
+	if err := writeHelper(call.Arg2Writer, func(writer tchannel.ArgWriter) error {
+		_, err := writer.Write(headerBytes)
+		return err
 	}); err != nil {
 		return fmt.Errorf("failed to write headers: %v", err)
 	}
 
+	wire.addRequest("arg3", r.Body)
 	if err := writeHelper(call.Arg3Writer, func(writer tchannel.ArgWriter) error {
 		_, err := writer.Write(r.Body)
 		return err
@@ -251,6 +288,27 @@ func (t *tchan) writeArgs(call *tchannel.OutboundCall, r *Request) error {
 	return nil
 }
 
+// encodeHeaders returns the arg2 bytes for the headers in the call format.
+func (t *tchan) encodeHeaders(headers map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch t.callOptions.Format {
+	case tchannel.JSON:
+		if err := json.NewEncoder(&buf).Encode(headers); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case tchannel.Raw:
+		if v, ok := headers[rawHeadersKey]; ok {
+			return []byte(v), nil
+		}
+	}
+
+	if err := thrift.WriteHeaders(&buf, headers); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func applyRPCOptions(callOpts *tchannel.CallOptions, opts TChannelOptions) {
 	callOpts.RoutingDelegate = opts.RoutingDelegate
 	callOpts.RoutingKey = opts.RoutingKey
@@ -24,6 +24,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -341,3 +343,73 @@ func thriftEncodedHeaders(t *testing.T, headers map[string]string) []byte {
 	require.NoError(t, thrift.WriteHeaders(&buf, headers), "WriteHeaders failed")
 	return buf.Bytes()
 }
+
+func TestTChannelConnect(t *testing.T) {
+	svr, transport := setupServerAndTransport(t)
+	defer svr.Close()
+
+	connector, ok := transport.(Connector)
+	require.True(t, ok, "TChannel transport should be a Connector")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, connector.Connect(ctx), "Connect failed")
+
+	testutils.WaitFor(time.Second, func() bool {
+		return len(svr.IntrospectState(nil).RootPeers) == 1
+	})
+	assert.Len(t, svr.IntrospectState(nil).RootPeers, 1, "Server should have an inbound connection")
+
+	closer, ok := transport.(TransportCloser)
+	require.True(t, ok, "TChannel transport should be a TransportCloser")
+	assert.NoError(t, closer.Close(), "Close failed")
+}
+
+func TestTChannelConnectFails(t *testing.T) {
+	transport, err := NewTChannel(TChannelOptions{
+		SourceService: "yab",
+		TargetService: "svc",
+		Peers:         []string{testutils.GetClosedHostPort(t)},
+	})
+	require.NoError(t, err, "Failed to create TChannel transport")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = transport.(Connector).Connect(ctx)
+	require.Error(t, err, "Connect to closed port should fail")
+	assert.Contains(t, err.Error(), "connection refused", "Unexpected error")
+}
+
+func TestTChannelUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "tchannel.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err, "Listen failed")
+
+	svr, err := tchannel.NewChannel("svc", nil)
+	require.NoError(t, err, "Failed to create TChannel")
+	defer svr.Close()
+	require.NoError(t, svr.Serve(ln), "Serve failed")
+
+	testutils.RegisterFunc(svr, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	transport, err := NewTChannel(TChannelOptions{
+		SourceService: "yab",
+		TargetService: svr.ServiceName(),
+		Peers:         []string{UnixAddress(socket)},
+		Encoding:      "raw",
+	})
+	require.NoError(t, err, "Failed to create TChannel transport")
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+
+	res, err := transport.Call(ctx, &Request{
+		Method:  "echo",
+		Headers: map[string]string{rawHeadersKey: ""},
+		Body:    []byte{1, 2, 3, 4},
+	})
+	require.NoError(t, err, "Call failed")
+	assert.Equal(t, []byte{1, 2, 3, 4}, res.Body, "Response body mismatch")
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	_testCA         = "../testdata/tls/ca.pem"
+	_testServerCert = "../testdata/tls/server.pem"
+	_testServerKey  = "../testdata/tls/server-key.pem"
+	_testClientCert = "../testdata/tls/client.pem"
+	_testClientKey  = "../testdata/tls/client-key.pem"
+)
+
+// serverTLSConfig returns a TLS config for test servers that uses the test
+// server certificate, and optionally requires a client certificate signed
+// by the test CA.
+func serverTLSConfig(t *testing.T, requireClientCert bool) *tls.Config {
+	cert, err := tls.LoadX509KeyPair(_testServerCert, _testServerKey)
+	require.NoError(t, err, "Failed to load server certificate")
+
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if requireClientCert {
+		caCfg, err := TLSOptions{CAFile: _testCA}.Config()
+		require.NoError(t, err, "Failed to load CA")
+
+		cfg.ClientCAs = caCfg.RootCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg
+}
+
+func TestTLSOptionsEnabled(t *testing.T) {
+	assert.False(t, TLSOptions{}.Enabled(), "empty options should not enable TLS")
+	assert.True(t, TLSOptions{InsecureSkipVerify: true}.Enabled(), "insecure should enable TLS")
+	assert.True(t, TLSOptions{CAFile: _testCA}.Enabled(), "CA should enable TLS")
+}
+
+func TestTLSOptionsConfig(t *testing.T) {
+	tests := []struct {
+		msg      string
+		opts     TLSOptions
+		wantErr  string
+		wantCA   bool
+		wantCert bool
+	}{
+		{
+			msg:  "no files",
+			opts: TLSOptions{ServerName: "foo", InsecureSkipVerify: true},
+		},
+		{
+			msg:    "CA file",
+			opts:   TLSOptions{CAFile: _testCA},
+			wantCA: true,
+		},
+		{
+			msg:      "client certificate",
+			opts:     TLSOptions{CertFile: _testClientCert, KeyFile: _testClientKey},
+			wantCert: true,
+		},
+		{
+			msg:     "CA file not found",
+			opts:    TLSOptions{CAFile: "not-found.pem"},
+			wantErr: "failed to read TLS CA file",
+		},
+		{
+			msg:     "CA file has no certificates",
+			opts:    TLSOptions{CAFile: _testClientKey},
+			wantErr: "no certificates found",
+		},
+		{
+			msg:     "certificate without key",
+			opts:    TLSOptions{CertFile: _testClientCert},
+			wantErr: errTLSCertKey.Error(),
+		},
+		{
+			msg:     "mismatched key",
+			opts:    TLSOptions{CertFile: _testClientCert, KeyFile: _testServerKey},
+			wantErr: "failed to load TLS client certificate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			cfg, err := tt.opts.Config()
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.opts.ServerName, cfg.ServerName, "server name")
+			assert.Equal(t, tt.opts.InsecureSkipVerify, cfg.InsecureSkipVerify, "insecure")
+			assert.Equal(t, tt.wantCA, cfg.RootCAs != nil, "root CAs")
+			assert.Equal(t, tt.wantCert, len(cfg.Certificates) > 0, "client certificates")
+		})
+	}
+}
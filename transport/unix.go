@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	unixScheme = "unix"
+	unixPrefix = unixScheme + "://"
+)
+
+// ParseUnixPeer parses a peer that listens on a unix domain socket, such as
+// unix:///var/run/svc.sock or grpc+unix:///var/run/svc.sock. The protocol is
+// the scheme before "+unix", and is empty for unix:// peers. HTTP peers may
+// specify a request path after the socket, separated by a colon, such as
+// http+unix:///var/run/svc.sock:/rpc.
+func ParseUnixPeer(peer string) (protocol, socket, path string, ok bool) {
+	i := strings.Index(peer, "://")
+	if i < 0 {
+		return "", "", "", false
+	}
+
+	scheme, rest := peer[:i], peer[i+len("://"):]
+	if scheme != unixScheme {
+		protocol = strings.TrimSuffix(scheme, "+"+unixScheme)
+		if protocol == scheme || protocol == "" {
+			return "", "", "", false
+		}
+	}
+
+	socket = rest
+	if i := strings.Index(rest, ":/"); i >= 0 {
+		socket, path = rest[:i], rest[i+1:]
+	}
+	return protocol, socket, path, socket != ""
+}
+
+// UnixAddress returns the address that transports use for a unix socket.
+func UnixAddress(socket string) string {
+	return unixPrefix + socket
+}
+
+// unixSocket returns the socket for an address returned by UnixAddress.
+func unixSocket(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, unixPrefix), true
+}
+
+// contextDialer dials a network address.
+type contextDialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialUnixAddresses wraps a dialer to dial addresses returned by UnixAddress
+// using unix domain sockets.
+func dialUnixAddresses(dial contextDialer) contextDialer {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if socket, ok := unixSocket(addr); ok {
+			return dial(ctx, "unix", socket)
+		}
+		return dial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUnixPeer(t *testing.T) {
+	tests := []struct {
+		peer         string
+		wantProtocol string
+		wantSocket   string
+		wantPath     string
+		wantOK       bool
+	}{
+		{peer: "1.1.1.1:1234"},
+		{peer: "http://1.1.1.1:1234/rpc"},
+		{peer: "unix://"},
+		{peer: "+unix:///var/run/svc.sock"},
+		{peer: "unixfoo:///var/run/svc.sock"},
+		{
+			peer:       "unix:///var/run/svc.sock",
+			wantSocket: "/var/run/svc.sock",
+			wantOK:     true,
+		},
+		{
+			peer:       "unix://svc.sock",
+			wantSocket: "svc.sock",
+			wantOK:     true,
+		},
+		{
+			peer:         "http+unix:///var/run/svc.sock:/rpc/v1",
+			wantProtocol: "http",
+			wantSocket:   "/var/run/svc.sock",
+			wantPath:     "/rpc/v1",
+			wantOK:       true,
+		},
+		{
+			peer:         "grpc+unix:///var/run/svc.sock",
+			wantProtocol: "grpc",
+			wantSocket:   "/var/run/svc.sock",
+			wantOK:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.peer, func(t *testing.T) {
+			protocol, socket, path, ok := ParseUnixPeer(tt.peer)
+			assert.Equal(t, tt.wantOK, ok, "unexpected ok")
+			assert.Equal(t, tt.wantProtocol, protocol, "unexpected protocol")
+			assert.Equal(t, tt.wantSocket, socket, "unexpected socket")
+			assert.Equal(t, tt.wantPath, path, "unexpected path")
+		})
+	}
+}
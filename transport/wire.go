@@ -0,0 +1,156 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type wireRecorderKey struct{}
+
+// WireRecorder is called with the raw bytes of each call made using a
+// context returned by WithWireRecorder.
+type WireRecorder func(*WireCall)
+
+// WithWireRecorder returns a context that records the raw bytes of calls
+// made using it. Only unary calls are recorded.
+func WithWireRecorder(ctx context.Context, r WireRecorder) context.Context {
+	return context.WithValue(ctx, wireRecorderKey{}, r)
+}
+
+// WireCall is the raw bytes of a call, as sent and received on the wire.
+type WireCall struct {
+	Protocol Protocol
+	Method   string
+	Peer     string
+	Start    time.Time
+	Duration time.Duration
+
+	// Error is the error that the call failed with, if any.
+	Error error
+
+	// WireProtocol is the protocol version used on the wire, such as
+	// HTTP/1.1 or HTTP/2.0 for HTTP calls. It's empty if it's not known.
+	WireProtocol string
+
+	RequestHeaders   map[string]string
+	ResponseHeaders  map[string]string
+	ResponseTrailers map[string]string
+
+	// Request and Response are the frames sent and received, such as the
+	// TChannel arguments, the HTTP message, or the gRPC messages. Frames
+	// that yab can't capture from the wire are reconstructed.
+	Request  []WireFrame
+	Response []WireFrame
+
+	record WireRecorder
+}
+
+// WireFrame is a part of a call sent or received on the wire.
+type WireFrame struct {
+	Name  string
+	Bytes []byte
+
+	// Reconstructed is set for frames that are rebuilt from the message
+	// rather than captured from the wire. HTTP messages are reconstructed
+	// in HTTP/1.1 format, even when HTTP/2 is used, and gRPC frames are
+	// reconstructed from the uncompressed message.
+	Reconstructed bool
+}
+
+// startWireCall returns a WireCall to record a call if the context has a
+// recorder, and nil otherwise. All methods are no-ops on a nil WireCall.
+func startWireCall(ctx context.Context, p Protocol, method string) *WireCall {
+	record, ok := ctx.Value(wireRecorderKey{}).(WireRecorder)
+	if !ok || record == nil {
+		return nil
+	}
+	return &WireCall{
+		Protocol: p,
+		Method:   method,
+		Start:    time.Now(),
+		record:   record,
+	}
+}
+
+func (c *WireCall) setPeer(peer string) {
+	if c != nil {
+		c.Peer = peer
+	}
+}
+
+func (c *WireCall) addRequest(name string, bs []byte) {
+	if c != nil {
+		c.Request = append(c.Request, WireFrame{Name: name, Bytes: bs})
+	}
+}
+
+func (c *WireCall) addResponse(name string, bs []byte) {
+	if c != nil {
+		c.Response = append(c.Response, WireFrame{Name: name, Bytes: bs})
+	}
+}
+
+func (c *WireCall) addReconstructedRequest(name string, bs []byte) {
+	if c != nil {
+		c.Request = append(c.Request, WireFrame{Name: name, Bytes: bs, Reconstructed: true})
+	}
+}
+
+func (c *WireCall) addReconstructedResponse(name string, bs []byte) {
+	if c != nil {
+		c.Response = append(c.Response, WireFrame{Name: name, Bytes: bs, Reconstructed: true})
+	}
+}
+
+// finish records the call, which took until now.
+func (c *WireCall) finish(err error) {
+	if c == nil {
+		return
+	}
+	c.Duration = time.Since(c.Start)
+	c.Error = err
+	c.record(c)
+}
+
+// reconstructGRPCFrame returns the gRPC length-prefixed frame for an
+// uncompressed message. Messages compressed on the wire have a different
+// length and flags.
+func reconstructGRPCFrame(msg []byte) []byte {
+	frame := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+	return frame
+}
+
+// flattenHeaders returns headers with multiple values joined by commas,
+// as they are in HTTP headers and gRPC metadata.
+func flattenHeaders(headers map[string][]string) map[string]string {
+	flat := make(map[string]string, len(headers))
+	for k, values := range headers {
+		flat[k] = strings.Join(values, ",")
+	}
+	return flat
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/raw"
+	"github.com/uber/tchannel-go/testutils"
+	"go.uber.org/yarpc/api/transport"
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// recordWire returns a context that records calls to the returned slice.
+func recordWire(ctx context.Context) (context.Context, *[]*WireCall) {
+	var calls []*WireCall
+	return WithWireRecorder(ctx, func(c *WireCall) {
+		calls = append(calls, c)
+	}), &calls
+}
+
+func TestWireCallNotRecorded(t *testing.T) {
+	wire := startWireCall(context.Background(), HTTP, "foo")
+	assert.Nil(t, wire, "calls should only be recorded if the context has a recorder")
+
+	// Methods on a nil WireCall are no-ops.
+	wire.setPeer("1.1.1.1:1")
+	wire.addRequest("foo", nil)
+	wire.addResponse("foo", nil)
+	wire.addReconstructedRequest("foo", nil)
+	wire.addReconstructedResponse("foo", nil)
+	wire.finish(errors.New("failed"))
+}
+
+func TestReconstructGRPCFrame(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 0, 3, 'f', 'o', 'o'}, reconstructGRPCFrame([]byte("foo")))
+	assert.Equal(t, []byte{0, 0, 0, 0, 0}, reconstructGRPCFrame(nil))
+}
+
+func TestTChannelWire(t *testing.T) {
+	svr, transport := setupServerAndTransport(t)
+	defer svr.Close()
+
+	testutils.RegisterFunc(svr, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: []byte("response")}, nil
+	})
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+	ctx, calls := recordWire(ctx)
+
+	headers := map[string]string{"k": "v"}
+	_, err := transport.Call(ctx, &Request{
+		Method:  "echo",
+		Headers: headers,
+		Body:    []byte("request"),
+	})
+	require.NoError(t, err, "Call failed")
+	require.Len(t, *calls, 1, "expected call to be recorded")
+
+	call := (*calls)[0]
+	assert.Equal(t, TChannel, call.Protocol)
+	assert.Equal(t, "echo", call.Method)
+	assert.Equal(t, svr.PeerInfo().HostPort, call.Peer)
+	assert.NoError(t, call.Error)
+	assert.NotZero(t, call.Duration)
+	assert.Equal(t, headers, call.RequestHeaders)
+	assert.Equal(t, headers, call.ResponseHeaders)
+	assert.Equal(t, []WireFrame{
+		{Name: "arg1", Bytes: []byte("echo")},
+		{Name: "arg2", Bytes: thriftEncodedHeaders(t, headers)},
+		{Name: "arg3", Bytes: []byte("request")},
+	}, call.Request)
+	assert.Equal(t, []WireFrame{
+		{Name: "arg2", Bytes: thriftEncodedHeaders(t, headers)},
+		{Name: "arg3", Bytes: []byte("response")},
+	}, call.Response)
+}
+
+func TestTChannelWireError(t *testing.T) {
+	svr, transport := setupServerAndTransport(t)
+	defer svr.Close()
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+	ctx, calls := recordWire(ctx)
+
+	_, err := transport.Call(ctx, &Request{Method: "unknown"})
+	require.Error(t, err, "Call should fail")
+	require.Len(t, *calls, 1, "expected failed call to be recorded")
+	assert.Equal(t, err, (*calls)[0].Error)
+	assert.Len(t, (*calls)[0].Request, 3, "request should be recorded")
+	assert.Empty(t, (*calls)[0].Response, "no response was received")
+}
+
+func TestHTTPWire(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Custom-Header", "value")
+		io.WriteString(w, "response")
+	}))
+	defer svr.Close()
+
+	transport, err := NewHTTP(HTTPOptions{
+		Method:        "POST",
+		URLs:          []string{svr.URL + "/rpc"},
+		SourceService: "source",
+		TargetService: "target",
+		Encoding:      "raw",
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctx, calls := recordWire(ctx)
+
+	_, err = transport.Call(ctx, &Request{
+		Method:  "foo",
+		Headers: map[string]string{"k": "v"},
+		Body:    []byte("request"),
+	})
+	require.NoError(t, err, "Call failed")
+	require.Len(t, *calls, 1, "expected call to be recorded")
+
+	call := (*calls)[0]
+	assert.Equal(t, HTTP, call.Protocol)
+	assert.Equal(t, "foo", call.Method)
+	assert.Equal(t, svr.URL+"/rpc", call.Peer)
+	assert.Equal(t, "v", call.RequestHeaders["Rpc-Header-K"])
+	assert.Equal(t, "value", call.ResponseHeaders["Custom-Header"])
+	assert.Equal(t, "HTTP/1.1", call.WireProtocol)
+
+	require.Len(t, call.Request, 1)
+	assert.True(t, call.Request[0].Reconstructed, "HTTP requests should be reconstructed")
+	request := string(call.Request[0].Bytes)
+	assert.True(t, strings.HasPrefix(request, "POST /rpc HTTP/1.1\r\n"), "unexpected request: %q", request)
+	assert.Contains(t, request, "Rpc-Procedure: foo\r\n")
+	assert.True(t, strings.HasSuffix(request, "\r\n\r\nrequest"), "unexpected request: %q", request)
+
+	require.Len(t, call.Response, 1)
+	response := string(call.Response[0].Bytes)
+	assert.True(t, strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n"), "unexpected response: %q", response)
+	assert.Contains(t, response, "Custom-Header: value\r\n")
+	assert.True(t, strings.HasSuffix(response, "\r\n\r\nresponse"), "unexpected response: %q", response)
+}
+
+func TestHTTP2Wire(t *testing.T) {
+	svr := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "response")
+	}), &http2.Server{}))
+	defer svr.Close()
+
+	transport, err := NewHTTP(HTTPOptions{
+		Method:        "POST",
+		URLs:          []string{svr.URL},
+		SourceService: "source",
+		TargetService: "target",
+		HTTP2:         true,
+	})
+	require.NoError(t, err, "Failed to create HTTP transport")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctx, calls := recordWire(ctx)
+
+	_, err = transport.Call(ctx, &Request{Method: "foo", Body: []byte("request")})
+	require.NoError(t, err, "Call failed")
+	require.Len(t, *calls, 1, "expected call to be recorded")
+
+	call := (*calls)[0]
+	assert.Equal(t, "HTTP/2.0", call.WireProtocol, "protocol used on the wire should be recorded")
+	require.Len(t, call.Response, 1)
+	assert.True(t, call.Response[0].Reconstructed, "HTTP/2 responses should be reconstructed")
+}
+
+func TestGRPCWire(t *testing.T) {
+	doWithGRPCTestEnv(t, "example-caller", 1, []transport.Procedure{
+		newTestJSONProcedure("example", "Foo::Bar", testBar)},
+		func(t *testing.T, grpcTestEnv *grpcTestEnv) {
+			request, err := newTestJSONRequest("example", "Foo::Bar", &testBarRequest{One: "hello"})
+			require.NoError(t, err)
+			request.Headers = map[string]string{"k": "v"}
+
+			ctx, calls := recordWire(context.Background())
+			response, err := grpcTestEnv.Transport.Call(ctx, request)
+			require.NoError(t, err)
+			require.Len(t, *calls, 1, "expected call to be recorded")
+
+			call := (*calls)[0]
+			assert.Equal(t, GRPC, call.Protocol)
+			assert.Equal(t, "/Foo/Bar", call.Method)
+			assert.Equal(t, grpcTestEnv.YARPCInbounds[0].Addr().String(), call.Peer)
+			assert.Equal(t, "v", call.RequestHeaders["k"])
+			assert.Equal(t, "example", call.ResponseTrailers["rpc-service"])
+			assert.Equal(t, []WireFrame{{Name: "message", Bytes: reconstructGRPCFrame(request.Body), Reconstructed: true}}, call.Request)
+			assert.Equal(t, []WireFrame{{Name: "message", Bytes: reconstructGRPCFrame(response.Body), Reconstructed: true}}, call.Response)
+
+			var got testBarResponse
+			require.NoError(t, json.Unmarshal(response.Body, &got))
+			assert.Equal(t, "hello", got.One)
+		}, 0)
+}
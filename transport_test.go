@@ -22,11 +22,14 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/yarpc/yab/encoding"
+	"github.com/yarpc/yab/peerprovider"
 	"github.com/yarpc/yab/transport"
 
 	"github.com/opentracing/opentracing-go"
@@ -53,6 +56,10 @@ func TestParsePeer(t *testing.T) {
 		{"http://1.1.1.1:8080", "http", "1.1.1.1:8080"},
 		{"grpc://1.1.1.1:8080", "grpc", "1.1.1.1:8080"},
 		{"://asd", "", "://asd"},
+		{"unix:///var/run/svc.sock", "", "unix:///var/run/svc.sock"},
+		{"http+unix:///var/run/svc.sock:/rpc", "http", "unix:///var/run/svc.sock"},
+		{"grpc+unix:///var/run/svc.sock", "grpc", "unix:///var/run/svc.sock"},
+		{"tchannel+unix://svc.sock", "tchannel", "unix://svc.sock"},
 	}
 
 	for _, tt := range tests {
@@ -64,60 +71,145 @@ func TestParsePeer(t *testing.T) {
 	}
 }
 
-func TestEnsureSameProtocol(t *testing.T) {
+func TestGroupPeersByProtocol(t *testing.T) {
+	var (
+		thriftOpts = RequestOptions{Encoding: encoding.Thrift}
+		protoOpts  = RequestOptions{Encoding: encoding.Protobuf}
+
+		tchannelThrift = _resolvedTChannelThrift
+		grpcThrift     = resolvedProtocolEncoding{protocol: transport.GRPC, enc: encoding.Thrift}
+		httpThrift     = resolvedProtocolEncoding{protocol: transport.HTTP, enc: encoding.Thrift}
+		httpJSON       = resolvedProtocolEncoding{protocol: transport.HTTP, enc: encoding.JSON}
+	)
+
 	tests := []struct {
 		msg     string
 		peers   []string
-		want    string
-		wantErr bool
+		rOpts   RequestOptions
+		want    []protocolGroup
+		wantErr string
 	}{
 		{
 			msg:   "host:ports without transport",
 			peers: []string{"1.1.1.1:1234", "2.2.2.2:1234"},
-			want:  "",
+			rOpts: thriftOpts,
+			want:  []protocolGroup{{tchannelThrift, []int{0, 1}}},
 		},
 		{
 			msg:   "only hosts",
 			peers: []string{"1.1.1.1", "2.2.2.2"},
-			want:  "",
+			rOpts: thriftOpts,
+			want:  []protocolGroup{{tchannelThrift, []int{0, 1}}},
 		},
 		{
 			msg:   "http urls",
 			peers: []string{"http://1.1.1.1", "http://2.2.2.2:8080"},
-			want:  "http",
+			want:  []protocolGroup{{httpJSON, []int{0, 1}}},
 		},
 		{
 			msg:   "grpc urls",
 			peers: []string{"grpc://1.1.1.1", "grpc://2.2.2.2:8080"},
-			want:  "grpc",
+			want:  []protocolGroup{{_resolvedGrpcProto, []int{0, 1}}},
+		},
+		{
+			msg:   "mix of http and https",
+			peers: []string{"https://1.1.1.1", "http://2.2.2.2:8080"},
+			want:  []protocolGroup{{httpJSON, []int{0, 1}}},
+		},
+		{
+			msg:   "mix of host:ports and grpc urls",
+			peers: []string{"1.1.1.1:1234", "grpc://2.2.2.2:8080"},
+			rOpts: protoOpts,
+			want:  []protocolGroup{{_resolvedGrpcProto, []int{0, 1}}},
 		},
 		{
-			msg:     "mix of http and https",
-			peers:   []string{"https://1.1.1.1", "http://2.2.2.2:8080"},
-			wantErr: true,
+			msg:   "mix of host:ports and unix sockets",
+			peers: []string{"1.1.1.1:1234", "unix:///var/run/svc.sock"},
+			rOpts: thriftOpts,
+			want:  []protocolGroup{{tchannelThrift, []int{0, 1}}},
 		},
 		{
-			msg:   "mix of host:ports and hosts",
-			peers: []string{"1.1.1.1:1234", "1.1.1.1"},
-			want:  "",
+			msg:   "mix of grpc urls and grpc unix sockets",
+			peers: []string{"grpc://1.1.1.1:1234", "grpc+unix:///var/run/svc.sock"},
+			want:  []protocolGroup{{_resolvedGrpcProto, []int{0, 1}}},
+		},
+		{
+			msg:   "mixed protocols",
+			peers: []string{"tchannel://1.1.1.1:1", "http://2.2.2.2:2", "grpc://3.3.3.3:3", "4.4.4.4:4", "http+unix:///var/run/http.sock"},
+			rOpts: thriftOpts,
+			want: []protocolGroup{
+				{tchannelThrift, []int{0, 3}},
+				{httpThrift, []int{1, 4}},
+				{grpcThrift, []int{2}},
+			},
+		},
+		{
+			msg:     "mixed protocols with different encodings",
+			peers:   []string{"tchannel://1.1.1.1:1", "grpc://2.2.2.2:2"},
+			wantErr: "tchannel peers use thrift encoding, but grpc peers use proto encoding",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.msg, func(t *testing.T) {
-			got, err := ensureSameProtocol(tt.peers)
-			if tt.wantErr {
-				assert.Error(t, err, "Expect error for %v", tt.peers)
+			got, err := groupPeersByProtocol(tt.peers, tt.rOpts)
+			if tt.wantErr != "" {
+				require.Error(t, err, "Expect error for %v", tt.peers)
+				assert.Contains(t, err.Error(), tt.wantErr)
 				return
 			}
 
-			if assert.NoError(t, err, "Expect no error for %v", tt.peers) {
-				assert.Equal(t, tt.want, got, "Wrong protocol for %v", tt.peers)
-			}
+			require.NoError(t, err, "Expect no error for %v", tt.peers)
+			assert.Equal(t, tt.want, got, "Wrong groups for %v", tt.peers)
 		})
 	}
 }
 
+func TestProtocolGroupTransportOptions(t *testing.T) {
+	opts := TransportOptions{
+		ServiceName: "svc",
+		Peers:       []string{"tchannel://1.1.1.1:1", "grpc://2.2.2.2:2", "tchannel://3.3.3.3:3"},
+		PeerWeights: []int{1, 2, 3},
+	}
+
+	got := protocolGroup{peers: []int{0, 2}}.transportOptions(opts)
+	assert.Equal(t, "svc", got.ServiceName)
+	assert.Equal(t, []string{"tchannel://1.1.1.1:1", "tchannel://3.3.3.3:3"}, got.Peers)
+	assert.Equal(t, []int{1, 3}, got.PeerWeights)
+	assert.Len(t, opts.Peers, 3, "Options should not be modified")
+
+	opts.PeerWeights = nil
+	got = protocolGroup{peers: []int{1}}.transportOptions(opts)
+	assert.Equal(t, []string{"grpc://2.2.2.2:2"}, got.Peers)
+	assert.Nil(t, got.PeerWeights)
+}
+
+func TestPeersProtocol(t *testing.T) {
+	tests := []struct {
+		peers   []string
+		want    transport.Protocol
+		wantErr bool
+	}{
+		{peers: nil, want: transport.TChannel},
+		{peers: []string{"1.1.1.1:1", "tchannel://2.2.2.2:2"}, want: transport.TChannel},
+		{peers: []string{"grpc://1.1.1.1:1", "grpc+unix:///var/run/svc.sock"}, want: transport.GRPC},
+		{peers: []string{"http://1.1.1.1", "https://2.2.2.2"}, want: transport.HTTP},
+		{peers: []string{"ftp://1.1.1.1"}, want: transport.TChannel},
+		{peers: []string{"1.1.1.1:1", "grpc://2.2.2.2:2"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := peersProtocol(tt.peers, transport.TChannel)
+		if tt.wantErr {
+			assert.Error(t, err, "Expect error for %v", tt.peers)
+			continue
+		}
+
+		require.NoError(t, err, "Expect no error for %v", tt.peers)
+		assert.Equal(t, tt.want, got, "Wrong protocol for %v", tt.peers)
+	}
+}
+
 func TestGetHosts(t *testing.T) {
 	peers := []string{
 		"1.1.1.1",
@@ -139,11 +231,11 @@ func TestGetHosts(t *testing.T) {
 
 func TestLoadTransportPeers(t *testing.T) {
 	tests := []struct {
-		msg        string
-		opts       TransportOptions
-		wantScheme string
-		wantPeers  []string
-		errMsg     string
+		msg         string
+		opts        TransportOptions
+		wantPeers   []string
+		wantWeights []int
+		errMsg      string
 	}{
 		{
 			msg:    "no peers specified",
@@ -151,16 +243,14 @@ func TestLoadTransportPeers(t *testing.T) {
 			errMsg: errPeerRequired.Error(),
 		},
 		{
-			msg:        "inline peers with ip:port",
-			opts:       TransportOptions{Peers: []string{"1.1.1.1:1"}},
-			wantScheme: "",
-			wantPeers:  []string{"1.1.1.1:1"},
+			msg:       "inline peers with ip:port",
+			opts:      TransportOptions{Peers: []string{"1.1.1.1:1"}},
+			wantPeers: []string{"1.1.1.1:1"},
 		},
 		{
-			msg:        "inline peers with localhost:port",
-			opts:       TransportOptions{Peers: []string{"localhost:1234"}},
-			wantScheme: "",
-			wantPeers:  []string{"localhost:1234"},
+			msg:       "inline peers with localhost:port",
+			opts:      TransportOptions{Peers: []string{"localhost:1234"}},
+			wantPeers: []string{"localhost:1234"},
 		},
 		{
 			msg:       "valid peerlist",
@@ -187,27 +277,72 @@ func TestLoadTransportPeers(t *testing.T) {
 			opts:   TransportOptions{PeerList: "testdata/empty.txt"},
 			errMsg: "specified peer list is empty",
 		},
+		{
+			msg:       "exec peer list",
+			opts:      TransportOptions{PeerList: "exec:cat testdata/valid_peerlist.txt"},
+			wantPeers: []string{"1.1.1.1:1", "2.2.2.2:2"},
+		},
+		{
+			msg: "peer list timeout",
+			opts: TransportOptions{
+				PeerList:        "exec:sleep 1",
+				PeerListTimeout: timeMillisFlag(10 * time.Millisecond),
+			},
+			errMsg: "deadline exceeded",
+		},
+		{
+			msg:         "peer list with metadata",
+			opts:        TransportOptions{PeerList: "testdata/valid_metadata_peerlist.yaml"},
+			wantPeers:   []string{"1.1.1.1:1", "2.2.2.2:2", "3.3.3.3:3"},
+			wantWeights: []int{3, 1, 1},
+		},
+		{
+			msg: "peer list filtered by zone",
+			opts: TransportOptions{
+				PeerList:   "testdata/valid_metadata_peerlist.json",
+				PeerFilter: []string{"zone=us-west"},
+			},
+			wantPeers:   []string{"2.2.2.2:2"},
+			wantWeights: []int{1},
+		},
+		{
+			msg: "peer list sampled",
+			opts: TransportOptions{
+				PeerList:   "testdata/valid_metadata_peerlist.yaml",
+				PeerFilter: []string{"version=1.3"},
+				PeerSample: 1,
+			},
+			wantPeers:   []string{"2.2.2.2:2"},
+			wantWeights: []int{1},
+		},
+		{
+			msg: "peer filter without metadata",
+			opts: TransportOptions{
+				Peers:      []string{"1.1.1.1:1"},
+				PeerFilter: []string{"zone=us-west"},
+			},
+			errMsg: "no peers match the peer filter",
+		},
 		{
 			msg:    "both peers and peer list specified",
 			opts:   TransportOptions{Peers: []string{"1.1.1.1:1"}, PeerList: "testdata/valid_peerlist.json"},
 			errMsg: errPeerOptions.Error(),
 		},
 		{
-			msg:        "URL peer list",
-			opts:       TransportOptions{Peers: []string{"http://1.1.1.1"}},
-			wantScheme: "http",
-			wantPeers:  []string{"http://1.1.1.1"},
+			msg:       "URL peer list",
+			opts:      TransportOptions{Peers: []string{"http://1.1.1.1"}},
+			wantPeers: []string{"http://1.1.1.1"},
 		},
 		{
-			msg:    "URL and host:port in peer list",
-			opts:   TransportOptions{Peers: []string{"1.1.1.1:1", "http://1.1.1.1"}},
-			errMsg: "found mixed protocols",
+			msg:       "URL and host:port in peer list",
+			opts:      TransportOptions{Peers: []string{"1.1.1.1:1", "http://1.1.1.1"}},
+			wantPeers: []string{"1.1.1.1:1", "http://1.1.1.1"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.msg, func(t *testing.T) {
-			scheme, peers, err := loadTransportPeers(tt.opts)
+			peers, weights, err := loadTransportPeers(tt.opts)
 			if tt.errMsg != "" {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), tt.errMsg, "Unexpected error")
@@ -215,13 +350,50 @@ func TestLoadTransportPeers(t *testing.T) {
 			}
 
 			require.NoError(t, err)
-			assert.Equal(t, tt.wantScheme, scheme, "unexpected scheme")
-			assert.Equal(t, tt.wantPeers, peers, "unexpected scheme")
+			assert.Equal(t, tt.wantPeers, peers, "unexpected peers")
+			assert.Equal(t, tt.wantWeights, weights, "unexpected weights")
 		})
 	}
 
 }
 
+func TestLoadTransportPeersTLS(t *testing.T) {
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1.1.1.1:1\n2.2.2.2:2\n"))
+	}))
+	defer svr.Close()
+
+	_, _, err := loadTransportPeers(TransportOptions{PeerList: svr.URL})
+	require.Error(t, err, "peer list should fail without the TLS options")
+
+	peers, _, err := loadTransportPeers(TransportOptions{
+		PeerList: svr.URL,
+		TLS:      TLSOptions{InsecureSkipVerify: true},
+	})
+	require.NoError(t, err, "peer list should use the TLS options")
+	assert.Equal(t, []string{"1.1.1.1:1", "2.2.2.2:2"}, peers, "unexpected peers")
+
+	_, _, err = loadTransportPeers(TransportOptions{
+		PeerList: svr.URL,
+		Proxy:    "ftp://proxy",
+	})
+	assert.Error(t, err, "invalid proxy should fail")
+}
+
+func TestSplitPeerWeights(t *testing.T) {
+	peers, weights := splitPeerWeights([]peerprovider.Peer{{HostPort: "1.1.1.1:1"}, {HostPort: "2.2.2.2:2"}})
+	assert.Equal(t, []string{"1.1.1.1:1", "2.2.2.2:2"}, peers)
+	assert.Nil(t, weights, "unweighted peers should have no weights")
+
+	peers, weights = splitPeerWeights([]peerprovider.Peer{
+		{HostPort: "1.1.1.1:1", Weight: 10, HasWeight: true},
+		{HostPort: "2.2.2.2:2"},
+		{HostPort: "3.3.3.3:3", HasWeight: true},
+	})
+	assert.Equal(t, []string{"1.1.1.1:1", "2.2.2.2:2", "3.3.3.3:3"}, peers)
+	assert.Equal(t, []int{10, 1, 0}, weights, "peers without a weight should have a weight of 1")
+}
+
 func TestGetTransport(t *testing.T) {
 	tests := []struct {
 		msg      string
@@ -295,6 +467,71 @@ func TestGetTransport(t *testing.T) {
 			},
 			resolved: resolvedProtocolEncoding{protocol: transport.GRPC, enc: encoding.Protobuf},
 		},
+		{
+			msg: "gRPC URL with invalid TLS options",
+			opts: TransportOptions{
+				ServiceName: "svc",
+				CallerName:  "caller",
+				Peers:       []string{"grpc://localhost:1234"},
+				GRPCTLS:     true,
+				TLS:         TLSOptions{CAFile: "not-found.pem"},
+			},
+			resolved: resolvedProtocolEncoding{protocol: transport.GRPC, enc: encoding.Protobuf},
+			errMsg:   "failed to read TLS CA file",
+		},
+		{
+			msg: "invalid peer strategy",
+			opts: TransportOptions{
+				ServiceName:  "svc",
+				CallerName:   "caller",
+				Peers:        []string{"1.1.1.1:1"},
+				PeerStrategy: "fastest",
+			},
+			resolved: _resolvedTChannelThrift,
+			errMsg:   `unknown peer strategy "fastest"`,
+		},
+		{
+			msg: "HTTP with invalid success codes",
+			opts: TransportOptions{
+				ServiceName:      "svc",
+				CallerName:       "caller",
+				Peers:            []string{"http://1.1.1.1"},
+				HTTPSuccessCodes: "2xx",
+			},
+			resolved: resolvedProtocolEncoding{protocol: transport.HTTP, enc: encoding.JSON},
+			errMsg:   `invalid status code "2xx"`,
+		},
+		{
+			msg: "TChannel with invalid proxy",
+			opts: TransportOptions{
+				ServiceName: "svc",
+				CallerName:  "caller",
+				Peers:       []string{"1.1.1.1:1234"},
+				Proxy:       "ftp://proxy:21",
+			},
+			resolved: resolvedProtocolEncoding{protocol: transport.TChannel, enc: encoding.Thrift},
+			errMsg:   `unsupported proxy scheme "ftp"`,
+		},
+		{
+			msg: "REST without service",
+			opts: TransportOptions{
+				CallerName: "caller",
+				Peers:      []string{"http://1.1.1.1"},
+				REST:       true,
+			},
+			resolved: resolvedProtocolEncoding{protocol: transport.HTTP, enc: encoding.JSON},
+		},
+		{
+			msg: "REST with TChannel",
+			opts: TransportOptions{
+				ServiceName: "svc",
+				CallerName:  "caller",
+				Peers:       []string{"1.1.1.1:1"},
+				REST:        true,
+			},
+			resolved: _resolvedTChannelThrift,
+			errMsg:   errRESTRequiresHTTP.Error(),
+		},
 		{
 			msg: "HTTP JSON URL",
 			opts: TransportOptions{
@@ -327,6 +564,38 @@ func TestGetTransport(t *testing.T) {
 	}
 }
 
+func TestGRPCTLSOptions(t *testing.T) {
+	tests := []struct {
+		msg  string
+		opts TransportOptions
+		want *transport.TLSOptions
+	}{
+		{
+			msg: "no TLS options",
+		},
+		{
+			msg:  "gRPC TLS enabled",
+			opts: TransportOptions{GRPCTLS: true},
+			want: &transport.TLSOptions{},
+		},
+		{
+			msg:  "TLS options without gRPC TLS",
+			opts: TransportOptions{TLS: TLSOptions{ServerName: "foo"}},
+		},
+		{
+			msg:  "TLS options with gRPC TLS",
+			opts: TransportOptions{GRPCTLS: true, TLS: TLSOptions{ServerName: "foo"}},
+			want: &transport.TLSOptions{ServerName: "foo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			assert.Equal(t, tt.want, grpcTLSOptions(tt.opts))
+		})
+	}
+}
+
 func TestGetTransportCallerName(t *testing.T) {
 	tests := []struct {
 		caller    string
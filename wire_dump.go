@@ -0,0 +1,203 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+var errHexdumpVerbose = errors.New("--hexdump requires verbose mode (-v)")
+
+// _wireDumpRunFormat is the time format of the prefix of wire dump files,
+// so runs that use the same directory don't overwrite each other's files.
+const _wireDumpRunFormat = "20060102-150405.000000"
+
+// wireDumper writes the raw bytes of each call to files in a directory,
+// and prints hex dumps of them.
+type wireDumper struct {
+	out     output
+	logger  *zap.Logger
+	dir     string
+	prefix  string
+	hexdump bool
+
+	calls atomic.Int32
+}
+
+// wireDump is the metadata written for each call, which lists the files
+// that contain the bytes of each frame.
+type wireDump struct {
+	Protocol         string            `json:"protocol"`
+	Method           string            `json:"method"`
+	Peer             string            `json:"peer"`
+	Start            time.Time         `json:"start"`
+	Duration         string            `json:"duration"`
+	Error            string            `json:"error,omitempty"`
+	WireProtocol     string            `json:"wireProtocol,omitempty"`
+	RequestHeaders   map[string]string `json:"requestHeaders,omitempty"`
+	ResponseHeaders  map[string]string `json:"responseHeaders,omitempty"`
+	ResponseTrailers map[string]string `json:"responseTrailers,omitempty"`
+	Request          []wireDumpFrame   `json:"request"`
+	Response         []wireDumpFrame   `json:"response"`
+}
+
+type wireDumpFrame struct {
+	Name          string `json:"name"`
+	File          string `json:"file"`
+	Bytes         int    `json:"bytes"`
+	Reconstructed bool   `json:"reconstructed,omitempty"`
+}
+
+// newWireDumper returns a wireDumper, or nil if calls shouldn't be dumped.
+func newWireDumper(opts Options, out output, logger *zap.Logger) (*wireDumper, error) {
+	if opts.DumpWire == "" && !opts.Hexdump {
+		return nil, nil
+	}
+	if opts.Hexdump && len(opts.Verbosity) == 0 {
+		return nil, errHexdumpVerbose
+	}
+
+	if opts.DumpWire != "" {
+		if err := os.MkdirAll(opts.DumpWire, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create wire dump directory: %v", err)
+		}
+	}
+
+	return &wireDumper{
+		out:     out,
+		logger:  logger,
+		dir:     opts.DumpWire,
+		prefix:  time.Now().Format(_wireDumpRunFormat),
+		hexdump: opts.Hexdump,
+	}, nil
+}
+
+// recorder returns the recorder to make calls with, which is nil if calls
+// aren't dumped.
+func (d *wireDumper) recorder() transport.WireRecorder {
+	if d == nil {
+		return nil
+	}
+	return d.record
+}
+
+func (d *wireDumper) record(call *transport.WireCall) {
+	n := int(d.calls.Inc())
+	if d.hexdump {
+		d.printHexdump(n, call)
+	}
+	if d.dir != "" {
+		if err := d.write(n, call); err != nil {
+			d.logger.Warn("Failed to write wire dump.", zap.Int("call", n), zap.Error(err))
+		}
+	}
+}
+
+// write writes the metadata of the call to RUN-call-N.json, and each frame
+// to RUN-call-N.request.NAME or RUN-call-N.response.NAME, where RUN is the
+// time the dumper was created.
+func (d *wireDumper) write(n int, call *transport.WireCall) error {
+	dump := wireDump{
+		Protocol:         call.Protocol.String(),
+		Method:           call.Method,
+		Peer:             call.Peer,
+		Start:            call.Start,
+		Duration:         call.Duration.String(),
+		WireProtocol:     call.WireProtocol,
+		RequestHeaders:   call.RequestHeaders,
+		ResponseHeaders:  call.ResponseHeaders,
+		ResponseTrailers: call.ResponseTrailers,
+	}
+	if call.Error != nil {
+		dump.Error = call.Error.Error()
+	}
+
+	var err error
+	if dump.Request, err = d.writeFrames(n, "request", call.Request); err != nil {
+		return err
+	}
+	if dump.Response, err = d.writeFrames(n, "response", call.Response); err != nil {
+		return err
+	}
+
+	bs, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(d.dir, d.fileName(n, "json")), bs, 0644)
+}
+
+func (d *wireDumper) writeFrames(n int, direction string, frames []transport.WireFrame) ([]wireDumpFrame, error) {
+	written := make([]wireDumpFrame, 0, len(frames))
+	for _, f := range frames {
+		file := d.fileName(n, direction+"."+f.Name)
+		if err := ioutil.WriteFile(filepath.Join(d.dir, file), f.Bytes, 0644); err != nil {
+			return nil, err
+		}
+		written = append(written, wireDumpFrame{
+			Name:          f.Name,
+			File:          file,
+			Bytes:         len(f.Bytes),
+			Reconstructed: f.Reconstructed,
+		})
+	}
+	return written, nil
+}
+
+func (d *wireDumper) fileName(n int, suffix string) string {
+	return fmt.Sprintf("%s-call-%d.%s", d.prefix, n, suffix)
+}
+
+func (d *wireDumper) printHexdump(n int, call *transport.WireCall) {
+	protocol := call.Protocol.String()
+	if call.WireProtocol != "" {
+		protocol += " (" + call.WireProtocol + ")"
+	}
+	d.out.Warnf("Call %d: %v %v to %v in %v\n", n, protocol, call.Method, call.Peer, call.Duration)
+	if call.Error != nil {
+		d.out.Warnf("Call %d failed: %v\n", n, call.Error)
+	}
+	for _, f := range call.Request {
+		d.out.Warnf("Request %v (%v):\n%s", f.Name, frameDescription(f), hex.Dump(f.Bytes))
+	}
+	for _, f := range call.Response {
+		d.out.Warnf("Response %v (%v):\n%s", f.Name, frameDescription(f), hex.Dump(f.Bytes))
+	}
+}
+
+func frameDescription(f transport.WireFrame) string {
+	if f.Reconstructed {
+		return fmt.Sprintf("%d bytes, reconstructed", len(f.Bytes))
+	}
+	return fmt.Sprintf("%d bytes", len(f.Bytes))
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yarpc/yab/transport"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWireDumper(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+
+	tests := []struct {
+		msg     string
+		opts    Options
+		wantNil bool
+		wantErr string
+	}{
+		{
+			msg:     "disabled",
+			wantNil: true,
+		},
+		{
+			msg:     "hexdump without verbose",
+			opts:    Options{Hexdump: true},
+			wantErr: "--hexdump requires verbose mode (-v)",
+		},
+		{
+			msg:  "hexdump",
+			opts: Options{Hexdump: true, Verbosity: []bool{true}},
+		},
+		{
+			msg:     "dump directory is a file",
+			opts:    Options{DumpWire: filepath.Join(file, "dump")},
+			wantErr: "failed to create wire dump directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, _, out := getOutput(t)
+			d, err := newWireDumper(tt.opts, out, _testLogger)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, d)
+				assert.Nil(t, d.recorder(), "disabled dumper should not record calls")
+				return
+			}
+			assert.NotNil(t, d.recorder())
+		})
+	}
+}
+
+func TestWireDumperWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dump")
+	_, warnBuf, out := getOutput(t)
+	d, err := newWireDumper(Options{DumpWire: dir}, out, _testLogger)
+	require.NoError(t, err)
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	d.record(&transport.WireCall{
+		Protocol:        transport.HTTP,
+		Method:          "foo",
+		Peer:            "http://1.1.1.1:1",
+		Start:           start,
+		Duration:        time.Millisecond,
+		Error:           errors.New("failed"),
+		RequestHeaders:  map[string]string{"K": "v"},
+		ResponseHeaders: map[string]string{"R": "v"},
+		WireProtocol:    "HTTP/2.0",
+		Request:         []transport.WireFrame{{Name: "http", Bytes: []byte("request"), Reconstructed: true}},
+		Response:        []transport.WireFrame{{Name: "http", Bytes: []byte("response")}},
+	})
+	assert.Empty(t, warnBuf.String(), "hex dumps should not be printed")
+
+	prefix := d.prefix + "-"
+	bs, err := ioutil.ReadFile(filepath.Join(dir, prefix+"call-1.json"))
+	require.NoError(t, err, "failed to read metadata")
+	var got wireDump
+	require.NoError(t, json.Unmarshal(bs, &got))
+	assert.Equal(t, wireDump{
+		Protocol:        "http",
+		Method:          "foo",
+		Peer:            "http://1.1.1.1:1",
+		Start:           start,
+		Duration:        "1ms",
+		Error:           "failed",
+		RequestHeaders:  map[string]string{"K": "v"},
+		ResponseHeaders: map[string]string{"R": "v"},
+		WireProtocol:    "HTTP/2.0",
+		Request:         []wireDumpFrame{{Name: "http", File: prefix + "call-1.request.http", Bytes: 7, Reconstructed: true}},
+		Response:        []wireDumpFrame{{Name: "http", File: prefix + "call-1.response.http", Bytes: 8}},
+	}, got)
+
+	for file, want := range map[string]string{
+		prefix + "call-1.request.http":  "request",
+		prefix + "call-1.response.http": "response",
+	} {
+		bs, err := ioutil.ReadFile(filepath.Join(dir, file))
+		require.NoError(t, err, "failed to read %v", file)
+		assert.Equal(t, want, string(bs), "unexpected contents of %v", file)
+	}
+}
+
+func TestWireDump(t *testing.T) {
+	s := newServer(t)
+	defer s.shutdown()
+	s.register(fooMethod, methods.echo())
+
+	dir := t.TempDir()
+	buf, warnBuf, out := getOutput(t)
+	runWithOptions(Options{
+		ROpts: RequestOptions{
+			ThriftFile: validThrift,
+			Procedure:  fooMethod,
+		},
+		TOpts:     s.transportOpts(),
+		DumpWire:  dir,
+		Hexdump:   true,
+		Verbosity: []bool{true},
+	}, out, _testLogger)
+	assert.Contains(t, buf.String(), "{}", "unexpected response")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*-call-1.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1, "expected metadata for one call")
+	bs, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err, "failed to read metadata")
+	var got wireDump
+	require.NoError(t, json.Unmarshal(bs, &got))
+	assert.Equal(t, "tchannel", got.Protocol)
+	assert.Equal(t, fooMethod, got.Method)
+	assert.Equal(t, s.hostPort(), got.Peer)
+	assert.Empty(t, got.Error)
+	assert.Len(t, got.Request, 3, "expected arg1, arg2 and arg3")
+	assert.Len(t, got.Response, 2, "expected arg2 and arg3")
+
+	arg1, err := ioutil.ReadFile(filepath.Join(dir, got.Request[0].File))
+	require.NoError(t, err)
+	assert.Equal(t, fooMethod, string(arg1))
+
+	assert.Contains(t, warnBuf.String(), "Call 1: tchannel "+fooMethod+" to "+s.hostPort())
+	assert.Contains(t, warnBuf.String(), "Request arg1 (11 bytes):\n00000000  ")
+	assert.Contains(t, warnBuf.String(), "Response arg3 (")
+}